@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/egnyte/ax/pkg/alert"
@@ -45,13 +46,27 @@ func watchAlerts(ctx context.Context, rc config.RuntimeConfig, alertConfig confi
 	query := querySelectorsToQuery(&alertConfig.Selector)
 	query.Follow = true
 	query.MaxResults = 100
-	client := determineClient(rc.Config.Environments[alertConfig.Env])
+	envNames, err := config.ResolveEnvs(rc.Config, strings.Split(alertConfig.Env, ","))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	var client common.Client
+	if len(envNames) == 1 {
+		client = determineClient(rc.Config.Environments[envNames[0]])
+	} else {
+		envs := make(map[string]config.EnvMap)
+		for _, name := range envNames {
+			envs[name] = rc.Config.Environments[name]
+		}
+		client = determineMultiClient(envs)
+	}
 	if client == nil {
 		fmt.Println("Cannot obtain a client for", alertConfig)
 		return
 	}
 	fmt.Println("Now waiting for alerts for", alertConfig.Name)
-	for message := range client.Query(ctx, query) {
+	for message := range common.QueryWithFallback(ctx, client, query) {
 		fmt.Printf("[%s] Sending alert to %s: %+v\n", alertConfig.Name, alertConfig.Service["backend"], message.Map())
 		err := alerter.SendAlert(message)
 		if err != nil {
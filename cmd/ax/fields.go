@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+	"github.com/egnyte/ax/pkg/complete"
+	"github.com/egnyte/ax/pkg/config"
+)
+
+var (
+	fieldsFlagOutputFormat string
+)
+
+func init() {
+	fieldsCommand.Flag("output", "Output format: text|json|yaml").Short('o').Default("text").EnumVar(&fieldsFlagOutputFormat, "text", "yaml", "json", "pretty-json")
+}
+
+type typeCount struct {
+	Type  string
+	Count int
+}
+
+type fieldRow struct {
+	Name     string
+	Present  int // Number of messages the field was seen in
+	Observed int // Number of messages the field could have been seen in
+	Types    []typeCount
+	Samples  []string
+	Mapping  string // Type according to the backend, if it has a mapping
+}
+
+// Combines the fields seen in messages with those in the backend's mapping (if any), ordered by name
+func fieldRows(stats complete.FieldStats, mapping map[string]string) []fieldRow {
+	rows := make([]fieldRow, 0, len(stats.Fields))
+	for name, info := range stats.Fields {
+		row := fieldRow{Name: name, Present: info.Count, Observed: stats.Observed(name), Samples: info.Samples, Mapping: mapping[name]}
+		for t, count := range info.Types {
+			row.Types = append(row.Types, typeCount{t, count})
+		}
+		sort.Slice(row.Types, func(i, j int) bool {
+			if row.Types[i].Count != row.Types[j].Count {
+				return row.Types[i].Count > row.Types[j].Count
+			}
+			return row.Types[i].Type < row.Types[j].Type
+		})
+		rows = append(rows, row)
+	}
+	for name, fieldType := range mapping {
+		if _, ok := stats.Fields[name]; !ok {
+			rows = append(rows, fieldRow{Name: name, Observed: stats.Messages, Mapping: fieldType})
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].Name < rows[j].Name
+	})
+	return rows
+}
+
+// Formats types like "number (67%), string (33%)", or just "number" if there's only one
+func formatTypes(types []typeCount, present int) string {
+	if len(types) == 1 {
+		return types[0].Type
+	}
+	formatted := make([]string, len(types))
+	for i, t := range types {
+		formatted[i] = fmt.Sprintf("%s (%s)", t.Type, percentage(t.Count, present))
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// Shortens samples for the table, as values can be up to 100 characters
+func formatSamples(samples []string) string {
+	const maxLength = 30
+	formatted := make([]string, len(samples))
+	for i, sample := range samples {
+		if len(sample) > maxLength {
+			sample = sample[:maxLength-3] + "..."
+		}
+		formatted[i] = sample
+	}
+	return strings.Join(formatted, ", ")
+}
+
+func fieldRowMap(row fieldRow) map[string]interface{} {
+	types := make(map[string]int)
+	for _, t := range row.Types {
+		types[t.Type] = t.Count
+	}
+	m := map[string]interface{}{
+		"field":   row.Name,
+		"present": row.Present,
+		"types":   types,
+		"samples": row.Samples,
+	}
+	if row.Observed > 0 {
+		m["percentage"] = float64(row.Present) * 100 / float64(row.Observed)
+	}
+	if row.Mapping != "" {
+		m["mapping"] = row.Mapping
+	}
+	return m
+}
+
+func printFields(rows []fieldRow, messages int, hasMapping bool, outputFormat string) {
+	switch outputFormat {
+	case "text":
+		if len(rows) == 0 {
+			fmt.Println("No fields seen yet in this environment, run a query first")
+			return
+		}
+		table := tablewriter.NewWriter(os.Stdout)
+		header := []string{"Field", "Types", "Present", "Samples"}
+		if hasMapping {
+			header = append(header, "Mapping")
+		}
+		table.SetHeader(header)
+		table.SetAutoWrapText(false)
+		for _, row := range rows {
+			present := strconv.Itoa(row.Present)
+			if row.Observed > 0 {
+				present = percentage(row.Present, row.Observed)
+			}
+			line := []string{row.Name, formatTypes(row.Types, row.Present), present, formatSamples(row.Samples)}
+			if hasMapping {
+				line = append(line, row.Mapping)
+			}
+			table.Append(line)
+		}
+		table.Render()
+		fmt.Printf("Based on %d messages\n", messages)
+	case "json", "pretty-json":
+		encoder := json.NewEncoder(os.Stdout)
+		if outputFormat == "pretty-json" {
+			encoder.SetIndent("", "  ")
+		}
+		for _, row := range rows {
+			if err := encoder.Encode(fieldRowMap(row)); err != nil {
+				fmt.Println("Error JSON encoding")
+			}
+		}
+	case "yaml":
+		for _, row := range rows {
+			buf, err := yaml.Marshal(fieldRowMap(row))
+			if err != nil {
+				fmt.Println("Error YAML encoding")
+			}
+			fmt.Printf("---\n%s", string(buf))
+		}
+	}
+}
+
+func fieldsMain(rc config.RuntimeConfig, client common.Client) {
+	stats := complete.GetFieldStats(rc)
+	var mapping map[string]string
+	if fieldLister, ok := client.(common.FieldLister); ok {
+		var err error
+		mapping, err = fieldLister.ListFields()
+		if err != nil {
+			fmt.Println("Could not fetch field mapping:", err)
+		}
+	}
+	printFields(fieldRows(stats, mapping), stats.Messages, mapping != nil, fieldsFlagOutputFormat)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/egnyte/ax/pkg/complete"
+)
+
+func TestFieldRows(t *testing.T) {
+	stats := complete.FieldStats{
+		Messages: 4,
+		Fields: map[string]*complete.FieldInfo{
+			"status":  {Count: 3, Types: map[string]int{"string": 1, "number": 2}, Samples: []string{"200", "timeout"}},
+			"message": {Count: 4, Types: map[string]int{"string": 4}, Samples: []string{"Sup"}},
+			"took":    {Count: 2, Selected: 2, Types: map[string]int{"number": 2}},
+		},
+	}
+	rows := fieldRows(stats, map[string]string{"message": "string", "took": "number", "trace_id": "keyword"})
+	expected := []fieldRow{
+		{Name: "message", Present: 4, Observed: 4, Types: []typeCount{{"string", 4}}, Samples: []string{"Sup"}, Mapping: "string"},
+		{Name: "status", Present: 3, Observed: 4, Types: []typeCount{{"number", 2}, {"string", 1}}, Samples: []string{"200", "timeout"}},
+		{Name: "took", Present: 2, Observed: 6, Types: []typeCount{{"number", 2}}, Mapping: "number"},
+		{Name: "trace_id", Observed: 4, Mapping: "keyword"},
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Unexpected rows: %+v", rows)
+	}
+	if types := formatTypes(rows[1].Types, rows[1].Present); types != "number (66.7%), string (33.3%)" {
+		t.Errorf("Unexpected types: %s", types)
+	}
+	if types := formatTypes(rows[0].Types, rows[0].Present); types != "string" {
+		t.Errorf("Unexpected types: %s", types)
+	}
+}
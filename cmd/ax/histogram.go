@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh/terminal"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+	"github.com/egnyte/ax/pkg/config"
+)
+
+const (
+	// Number of buckets aimed for when no interval is given
+	histogramTargetBuckets = 60
+	// Upper bound on the number of buckets, to catch intervals that are too small for the time range
+	histogramMaxBuckets = 10000
+)
+
+var sparklineTicks = []rune("▁▂▃▄▅▆▇█")
+
+var (
+	histogramFlags            = addQueryFlags(histogramCommand)
+	histogramFlagInterval     string
+	histogramFlagMaxResults   int
+	histogramFlagOutputFormat string
+)
+
+func init() {
+	histogramCommand.Flag("interval", "Bucket size, e.g. 1m (picked based on the time range by default)").StringVar(&histogramFlagInterval)
+	histogramCommand.Flag("results", "Maximum number of messages to count, for backends that can't count natively").Short('n').Default("10000").IntVar(&histogramFlagMaxResults)
+	histogramCommand.Flag("output", "Output format: text|sparkline|json|yaml").Short('o').Default("text").EnumVar(&histogramFlagOutputFormat, "text", "sparkline", "yaml", "json", "pretty-json")
+}
+
+func histogramMaxCount(buckets []common.HistogramBucket) int {
+	max := 0
+	for _, bucket := range buckets {
+		if bucket.Count > max {
+			max = bucket.Count
+		}
+	}
+	return max
+}
+
+func terminalWidth() int {
+	width, _, err := terminal.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width <= 0 {
+		return 80
+	}
+	return width
+}
+
+// Renders one sparkline character per bucket, empty buckets are left blank
+func sparkline(buckets []common.HistogramBucket) string {
+	max := histogramMaxCount(buckets)
+	line := make([]rune, 0, len(buckets))
+	for _, bucket := range buckets {
+		if bucket.Count == 0 {
+			line = append(line, ' ')
+			continue
+		}
+		line = append(line, sparklineTicks[(bucket.Count*len(sparklineTicks)-1)/max])
+	}
+	return string(line)
+}
+
+// Scales a count to a bar of at most width characters, non-empty buckets always get at least one
+func barLength(count, max, width int) int {
+	if count == 0 {
+		return 0
+	}
+	length := count * width / max
+	if length == 0 {
+		return 1
+	}
+	return length
+}
+
+func histogramTotal(buckets []common.HistogramBucket) int {
+	total := 0
+	for _, bucket := range buckets {
+		total += bucket.Count
+	}
+	return total
+}
+
+func printHistogram(buckets []common.HistogramBucket, interval time.Duration, outputFormat string, colorConfig config.ColorConfig) {
+	timestampColor := config.ColorToTermColor(colorConfig.Timestamp)
+	switch outputFormat {
+	case "text":
+		if len(buckets) == 0 {
+			fmt.Println("No messages found")
+			return
+		}
+		max := histogramMaxCount(buckets)
+		countWidth := len(fmt.Sprintf("%d", max))
+		// [timestamp] count bars
+		barWidth := terminalWidth() - len(common.TimeFormat) - countWidth - 8
+		if barWidth < 10 {
+			barWidth = 10
+		}
+		for _, bucket := range buckets {
+			fmt.Printf("%s %*d %s\n", timestampColor.Sprintf("[%s]", bucket.Start.Format(common.TimeFormat)), countWidth,
+				bucket.Count, strings.Repeat("#", barLength(bucket.Count, max, barWidth)))
+		}
+		fmt.Printf("%d messages, at most %d per %s\n", histogramTotal(buckets), max, interval)
+	case "sparkline":
+		if len(buckets) == 0 {
+			fmt.Println("No messages found")
+			return
+		}
+		fmt.Printf("%s %s %s %d messages, at most %d per %s\n",
+			timestampColor.Sprintf("[%s]", buckets[0].Start.Format(common.TimeFormat)), sparkline(buckets),
+			timestampColor.Sprintf("[%s]", buckets[len(buckets)-1].Start.Add(interval).Format(common.TimeFormat)),
+			histogramTotal(buckets), histogramMaxCount(buckets), interval)
+	case "json", "pretty-json":
+		encoder := json.NewEncoder(os.Stdout)
+		if outputFormat == "pretty-json" {
+			encoder.SetIndent("", "  ")
+		}
+		for _, bucket := range buckets {
+			if err := encoder.Encode(histogramBucketMap(bucket)); err != nil {
+				fmt.Println("Error JSON encoding")
+			}
+		}
+	case "yaml":
+		for _, bucket := range buckets {
+			buf, err := yaml.Marshal(histogramBucketMap(bucket))
+			if err != nil {
+				fmt.Println("Error YAML encoding")
+			}
+			fmt.Printf("---\n%s", string(buf))
+		}
+	}
+}
+
+func histogramBucketMap(bucket common.HistogramBucket) map[string]interface{} {
+	return map[string]interface{}{
+		"@timestamp": bucket.Start.Format(common.TimeFormat),
+		"count":      bucket.Count,
+	}
+}
+
+// Returns the interval to use for a time range, either the one given or one giving a reasonable
+// number of buckets. A zero after means the time range has no start.
+func histogramInterval(rawInterval string, after, before time.Time) (time.Duration, error) {
+	if rawInterval == "" {
+		if after.IsZero() {
+			return 0, fmt.Errorf("an interval is required without a start of the time range")
+		}
+		return common.HistogramInterval(before.Sub(after), histogramTargetBuckets), nil
+	}
+	interval, err := parseOptionalDuration(rawInterval)
+	if err != nil {
+		return 0, err
+	}
+	if !after.IsZero() && before.Sub(after)/interval > histogramMaxBuckets {
+		return 0, fmt.Errorf("%s results in more than %d buckets for this time range", rawInterval, histogramMaxBuckets)
+	}
+	return interval, nil
+}
+
+// Counts the results of a regular query, with an interval based on the query's time range,
+// or on the time between the first and last message for the ends that aren't set
+func bucketQueryResults(messageChan <-chan common.LogMessage, query common.Query) ([]common.HistogramBucket, time.Duration) {
+	messages := make([]common.LogMessage, 0, query.MaxResults)
+	for message := range messageChan {
+		messages = append(messages, message)
+	}
+	if len(messages) == 0 {
+		return []common.HistogramBucket{}, 0
+	}
+	after, before := messages[0].Timestamp, messages[len(messages)-1].Timestamp
+	if query.After != nil {
+		after = *query.After
+	}
+	if query.Before != nil {
+		before = *query.Before
+	}
+	histogramQuery := common.HistogramQuery{Query: query, Interval: common.HistogramInterval(before.Sub(after), histogramTargetBuckets)}
+	bucketChan := make(chan common.LogMessage, len(messages))
+	for _, message := range messages {
+		bucketChan <- message
+	}
+	close(bucketChan)
+	return common.BucketMessages(bucketChan, histogramQuery), histogramQuery.Interval
+}
+
+func histogramMain(ctx context.Context, rc config.RuntimeConfig, client common.Client) {
+	if histogramFlags.Last == "" && histogramFlags.After == "" && histogramFlags.Before == "" {
+		histogramFlags.Last = "1 hour"
+	}
+	query := common.HistogramQuery{Query: querySelectorsToQuery(histogramFlags)}
+	query.MaxResults = histogramFlagMaxResults
+	after, before := time.Time{}, timeNow()
+	if query.After != nil {
+		after = *query.After
+	}
+	if query.Before != nil {
+		before = *query.Before
+	}
+	interval, err := histogramInterval(histogramFlagInterval, after, before)
+	if err != nil {
+		fmt.Println("Invalid interval:", err)
+		os.Exit(1)
+	}
+	query.Interval = interval
+	buckets, err := common.QueryHistogram(ctx, client, query)
+	if err != nil {
+		fmt.Println("Could not count messages:", err)
+		os.Exit(1)
+	}
+	printHistogram(buckets, interval, histogramFlagOutputFormat, rc.Config.Colors)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+)
+
+func TestSparkline(t *testing.T) {
+	buckets := []common.HistogramBucket{{Count: 1}, {Count: 0}, {Count: 50}, {Count: 100}}
+	if line := sparkline(buckets); line != "▁ ▄█" {
+		t.Errorf("Unexpected sparkline: %q", line)
+	}
+}
+
+func TestBarLength(t *testing.T) {
+	if length := barLength(0, 100, 50); length != 0 {
+		t.Errorf("Expected no bar for an empty bucket, got %d", length)
+	}
+	if length := barLength(1, 1000, 50); length != 1 {
+		t.Errorf("Expected a bar of at least 1, got %d", length)
+	}
+	if length := barLength(100, 100, 50); length != 50 {
+		t.Errorf("Expected a full bar, got %d", length)
+	}
+}
+
+func TestHistogramInterval(t *testing.T) {
+	before := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	after := before.Add(-time.Hour)
+	if interval, err := histogramInterval("", after, before); err != nil || interval != time.Minute {
+		t.Errorf("Expected a 1m interval for an hour, got %s (%v)", interval, err)
+	}
+	if interval, err := histogramInterval("5m", after, before); err != nil || interval != 5*time.Minute {
+		t.Errorf("Expected the given interval, got %s (%v)", interval, err)
+	}
+	if _, err := histogramInterval("100ms", after, before); err == nil {
+		t.Error("Expected an error for too many buckets")
+	}
+	if _, err := histogramInterval("", time.Time{}, before); err == nil {
+		t.Error("Expected an error without an interval or a start of the time range")
+	}
+	if interval, err := histogramInterval("1h", time.Time{}, before); err != nil || interval != time.Hour {
+		t.Errorf("Expected the given interval without a start of the time range, got %s (%v)", interval, err)
+	}
+}
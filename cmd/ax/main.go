@@ -13,46 +13,89 @@ import (
 	"github.com/egnyte/ax/pkg/backend/cloudwatch"
 	"github.com/egnyte/ax/pkg/backend/common"
 	"github.com/egnyte/ax/pkg/backend/docker"
+	"github.com/egnyte/ax/pkg/backend/elasticsearch"
+	"github.com/egnyte/ax/pkg/backend/file"
+	"github.com/egnyte/ax/pkg/backend/journal"
 	"github.com/egnyte/ax/pkg/backend/kibana"
+	"github.com/egnyte/ax/pkg/backend/kubernetes"
+	"github.com/egnyte/ax/pkg/backend/loki"
+	"github.com/egnyte/ax/pkg/backend/multi"
 	"github.com/egnyte/ax/pkg/backend/stackdriver"
 	"github.com/egnyte/ax/pkg/backend/stream"
 	"github.com/egnyte/ax/pkg/backend/subprocess"
+	"github.com/egnyte/ax/pkg/backend/syslog"
 	"github.com/egnyte/ax/pkg/config"
 )
 
 var (
-	queryCommand    = kingpin.Command("query", "Query logs").Default()
-	alertCommand    = kingpin.Command("alert", "Be alerted when logs match a query")
-	alertDCommand   = kingpin.Command("alertd", "Be alerted when logs match a query")
-	versionCommand  = kingpin.Command("version", "Show the ax version")
-	upgrade         = kingpin.Command("upgrade", "Upgrade Ax if a new version is available")
-	addAlertCommand = alertCommand.Command("add", "Add new alert")
-	version         = "dev"
-	versionFlag     = kingpin.Version(version)
+	queryCommand     = kingpin.Command("query", "Query logs").Default()
+	alertCommand     = kingpin.Command("alert", "Be alerted when logs match a query")
+	alertDCommand    = kingpin.Command("alertd", "Be alerted when logs match a query")
+	versionCommand   = kingpin.Command("version", "Show the ax version")
+	upgrade          = kingpin.Command("upgrade", "Upgrade Ax if a new version is available")
+	addAlertCommand  = alertCommand.Command("add", "Add new alert")
+	traceCommand     = kingpin.Command("trace", "Show the logs of a request across environments as one timeline")
+	statsCommand     = kingpin.Command("stats", "Count messages per group, with statistics over numeric fields")
+	histogramCommand = kingpin.Command("histogram", "Show the number of matching messages over time")
+	patternsCommand  = kingpin.Command("patterns", "Group matching messages by pattern, masking numbers, IDs and such")
+	topCommand       = kingpin.Command("top", "Show the most frequent values of fields")
+	fieldsCommand    = kingpin.Command("fields", "Show the fields seen in the environment's logs, with their types and sample values")
+	version          = "dev"
+	versionFlag      = kingpin.Version(version)
 )
 
 func determineClient(em config.EnvMap) common.Client {
 	stat, _ := os.Stdin.Stat()
-	var client common.Client
 	if (stat.Mode() & os.ModeCharDevice) == 0 {
-		client = stream.New(os.Stdin)
-	} else {
-		switch em["backend"] {
-		case "docker":
-			client = docker.New(em["pattern"])
-		case "kibana":
-			client = kibana.New(em["url"], em["auth"], em["index"])
-		case "cloudwatch":
-			client = cloudwatch.New(em["accesskey"], em["accesssecretkey"], em["region"], em["groupname"])
-		case "stackdriver":
-			client = stackdriver.New(em["credentials"], em["project"], em["log"])
-		case "subprocess":
-			client = subprocess.New(strings.Split(em["command"], " "))
-		}
+		return stream.New(os.Stdin)
+	}
+	return determineEnvClient(em)
+}
+
+// Returns the client for an environment's backend, or nil if it's not supported
+func determineEnvClient(em config.EnvMap) common.Client {
+	var client common.Client
+	switch em["backend"] {
+	case "docker":
+		client = docker.New(em["pattern"])
+	case "kubernetes":
+		client = kubernetes.New(em["namespace"], em["selector"], em["pattern"])
+	case "kibana":
+		client = kibana.New(em["url"], em["auth"], em["index"])
+	case "elasticsearch":
+		client = elasticsearch.New(em["url"], em["auth"], em["index"])
+	case "loki":
+		client = loki.New(em["url"], em["auth"], em["selector"])
+	case "cloudwatch":
+		client = cloudwatch.New(em["accesskey"], em["accesssecretkey"], em["region"], em["groupname"])
+	case "stackdriver":
+		client = stackdriver.New(em["credentials"], em["project"], em["log"])
+	case "file":
+		client = file.New(em["pattern"])
+	case "journal":
+		client = journal.New(strings.Split(em["command"], " "))
+	case "syslog":
+		client = syslog.New(em["address"])
+	case "subprocess":
+		client = subprocess.New(strings.Split(em["command"], " "))
 	}
 	return client
 }
 
+// Returns a client querying all of the environments at once, merging their messages by timestamp
+func determineMultiClient(envs map[string]config.EnvMap) common.Client {
+	clients := make(map[string]common.Client)
+	for name, em := range envs {
+		client := determineEnvClient(em)
+		if client == nil {
+			fmt.Println("Unsupported backend for environment:", name)
+			os.Exit(1)
+		}
+		clients[name] = client
+	}
+	return multi.New(clients)
+}
+
 func sigtermContextHandler(ctx context.Context) context.Context {
 	ctx, cancel := context.WithCancel(ctx)
 
@@ -72,13 +115,33 @@ func sigtermContextHandler(ctx context.Context) context.Context {
 }
 
 func main() {
-	cmd := kingpin.Parse()
+	savedQuery, err := parseSavedQueryCommand(os.Args[1:], config.LoadConfig().Queries)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if savedQuery.completions != nil {
+		fmt.Print(strings.Join(savedQuery.completions, "\n"))
+		return
+	}
+	if savedQuery.list {
+		listSavedQueries(config.LoadConfig().Queries)
+		return
+	}
+	cmd := kingpin.MustParse(kingpin.CommandLine.Parse(savedQuery.args))
 
 	rc := config.BuildConfig()
 	client := determineClient(rc.Env)
+	if client == nil && len(rc.Envs) > 0 {
+		client = determineMultiClient(rc.Envs)
+	}
 
 	switch cmd {
 	case "query":
+		if savedQuery.saveAs != "" {
+			saveQuery(savedQuery.saveAs)
+			return
+		}
 		ctx := sigtermContextHandler(context.Background())
 		if client == nil {
 			if len(rc.Config.Environments) == 0 {
@@ -91,6 +154,38 @@ func main() {
 			return
 		}
 		queryMain(ctx, rc, client)
+	case "stats":
+		if client == nil {
+			fmt.Println("No default environment set, please use the --env flag to set one. Exiting.")
+			return
+		}
+		statsMain(sigtermContextHandler(context.Background()), rc, client)
+	case "histogram":
+		if client == nil {
+			fmt.Println("No default environment set, please use the --env flag to set one. Exiting.")
+			return
+		}
+		histogramMain(sigtermContextHandler(context.Background()), rc, client)
+	case "patterns":
+		if client == nil {
+			fmt.Println("No default environment set, please use the --env flag to set one. Exiting.")
+			return
+		}
+		patternsMain(sigtermContextHandler(context.Background()), rc, client)
+	case "top":
+		if client == nil {
+			fmt.Println("No default environment set, please use the --env flag to set one. Exiting.")
+			return
+		}
+		topMain(sigtermContextHandler(context.Background()), rc, client)
+	case "fields":
+		if client == nil {
+			fmt.Println("No default environment set, please use the --env flag to set one. Exiting.")
+			return
+		}
+		fieldsMain(rc, client)
+	case "trace":
+		traceMain(sigtermContextHandler(context.Background()), rc)
 	case "env add":
 		config.AddEnv()
 	case "env list":
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+	"github.com/egnyte/ax/pkg/complete"
+	"github.com/egnyte/ax/pkg/config"
+	"github.com/egnyte/ax/pkg/patterns"
+)
+
+var (
+	patternsFlags            = addQueryFlags(patternsCommand)
+	patternsFlagField        string
+	patternsFlagMaxResults   int
+	patternsFlagMaxPatterns  int
+	patternsFlagOutputFormat string
+)
+
+func init() {
+	patternsCommand.Flag("field", "Field to find patterns in").Default("message").HintAction(selectHintAction).StringVar(&patternsFlagField)
+	patternsCommand.Flag("results", "Maximum number of messages to analyze").Short('n').Default("10000").IntVar(&patternsFlagMaxResults)
+	patternsCommand.Flag("limit", "Maximum number of patterns, the most frequent are shown").Default("50").IntVar(&patternsFlagMaxPatterns)
+	patternsCommand.Flag("output", "Output format: text|json|yaml").Short('o').Default("text").EnumVar(&patternsFlagOutputFormat, "text", "yaml", "json", "pretty-json")
+}
+
+func patternMap(pattern patterns.Pattern) map[string]interface{} {
+	return map[string]interface{}{
+		"template":   pattern.Template,
+		"count":      pattern.Count,
+		"first_seen": pattern.FirstSeen.Format(common.TimeFormat),
+		"last_seen":  pattern.LastSeen.Format(common.TimeFormat),
+		"example":    pattern.Example.Map(),
+	}
+}
+
+func printPatterns(found []patterns.Pattern, field string, outputFormat string, colorConfig config.ColorConfig) {
+	switch outputFormat {
+	case "text":
+		if len(found) == 0 {
+			fmt.Println("No messages found")
+			return
+		}
+		countWidth := len(fmt.Sprintf("%d", found[0].Count))
+		timestampColor := config.ColorToTermColor(colorConfig.Timestamp)
+		messageColor := config.ColorToTermColor(colorConfig.Message)
+		attributeKeyColor := config.ColorToTermColor(colorConfig.AttributeKey)
+		for _, pattern := range found {
+			template := pattern.Template
+			if template == "" {
+				template = fmt.Sprintf("(no %s)", field)
+			}
+			fmt.Printf("%*d %s %s\n", countWidth, pattern.Count, timestampColor.Sprintf("[%s - %s]",
+				pattern.FirstSeen.Format(common.TimeFormat), pattern.LastSeen.Format(common.TimeFormat)), messageColor.Sprint(template))
+			if example, ok := pattern.Example.Attributes[field].(string); ok && example != pattern.Template {
+				fmt.Printf("%*s %s%s\n", countWidth, "", attributeKeyColor.Sprint("e.g. "), example)
+			}
+		}
+	case "json", "pretty-json":
+		encoder := json.NewEncoder(os.Stdout)
+		if outputFormat == "pretty-json" {
+			encoder.SetIndent("", "  ")
+		}
+		for _, pattern := range found {
+			if err := encoder.Encode(patternMap(pattern)); err != nil {
+				fmt.Println("Error JSON encoding")
+			}
+		}
+	case "yaml":
+		for _, pattern := range found {
+			buf, err := yaml.Marshal(patternMap(pattern))
+			if err != nil {
+				fmt.Println("Error YAML encoding")
+			}
+			fmt.Printf("---\n%s", string(buf))
+		}
+	}
+}
+
+func patternsMain(ctx context.Context, rc config.RuntimeConfig, client common.Client) {
+	query := querySelectorsToQuery(patternsFlags)
+	query.MaxResults = patternsFlagMaxResults
+	// --select limits the attributes of the examples, but the field to find patterns in is always needed
+	if len(query.SelectFields) > 0 {
+		query.SelectFields = append(query.SelectFields, patternsFlagField)
+	}
+	messages := complete.GatherCompletionInfo(rc, query, common.QueryWithFallback(ctx, client, query))
+	printPatterns(patterns.Cluster(messages, patternsFlagField, patternsFlagMaxPatterns), patternsFlagField, patternsFlagOutputFormat, rc.Config.Colors)
+}
@@ -24,16 +24,27 @@ func addQueryFlags(cmd *kingpin.CmdClause) *common.QuerySelectors {
 	cmd.Flag("before", "Results from before").StringVar(&flags.Before)
 	cmd.Flag("after", "Results from after").StringVar(&flags.After)
 	cmd.Flag("select", "Fields to select").Short('s').HintAction(selectHintAction).StringsVar(&flags.Select)
-	cmd.Flag("where", "Add a filter").Short('w').HintAction(whereHintAction).StringsVar(&flags.Where)
+	cmd.Flag("where", "Add a filter (FIELD_NAME=VALUE, also supports !=, >, >=, < and <=)").Short('w').HintAction(whereHintAction).StringsVar(&flags.Where)
 	cmd.Flag("where-one-of", "Add a membership filter (FIELD_NAME:FIELD_VALUE)").HintAction(oneOfHintAction).StringsVar(&flags.OneOf)
 	cmd.Flag("where-not-one-of", "Add an inverse membership filter (FIELD_NAME:FIELD_VALUE)").HintAction(oneOfHintAction).StringsVar(&flags.NotOneOf)
+	cmd.Flag("where-matches", "Add a regular expression filter (FIELD_NAME~REGEX)").HintAction(matchesHintAction).StringsVar(&flags.Matches)
+	cmd.Flag("where-not-matches", "Add an inverse regular expression filter (FIELD_NAME~REGEX)").HintAction(matchesHintAction).StringsVar(&flags.NotMatches)
 	cmd.Flag("where-exists", "Add a field existence filter").HintAction(existenceHintAction).StringsVar(&flags.Exists)
 	cmd.Flag("where-not-exists", "Add an inverse field existence filter").HintAction(existenceHintAction).StringsVar(&flags.NotExists)
+	cmd.Flag("filter", "Add a boolean filter expression, e.g. '(level=error OR level=fatal) AND NOT service=healthcheck'").HintAction(whereHintAction).StringsVar(&flags.Filter)
 	cmd.Flag("uniq", "Unique log messages only").Default("false").BoolVar(&flags.Unique)
+	cmd.Flag("poll-interval", "Time between polls in follow mode, e.g. 10s").StringVar(&flags.PollInterval)
+	cmd.Flag("follow-overlap", "How late messages may arrive and still be shown in follow mode, e.g. 1m").StringVar(&flags.FollowOverlap)
 	cmd.Arg("query", "Query string").Default("").StringsVar(&flags.QueryString)
 	return flags
 }
 
+// Defaults of ax query's flags, which saved queries leave out
+const (
+	queryDefaultMaxResults   = 50
+	queryDefaultOutputFormat = "text"
+)
+
 var (
 	queryFlags            = addQueryFlags(queryCommand)
 	queryFlagMaxResults   int
@@ -42,9 +53,9 @@ var (
 )
 
 func init() {
-	queryCommand.Flag("results", "Maximum number of results").Short('n').Default("50").IntVar(&queryFlagMaxResults)
-	queryCommand.Flag("output", "Output format: text|json|yaml").Short('o').Default("text").EnumVar(&queryFlagOutputFormat, "text", "yaml", "json", "pretty-json")
-	queryCommand.Flag("follow", "Follow log in quasi-realtime, similar to tail -f").Short('f').Default("false").BoolVar(&queryFlagFollow)
+	queryCommand.Flag("results", "Maximum number of results").Short('n').Default(strconv.Itoa(queryDefaultMaxResults)).IntVar(&queryFlagMaxResults)
+	queryCommand.Flag("output", "Output format: text|json|yaml|histogram").Short('o').Default(queryDefaultOutputFormat).EnumVar(&queryFlagOutputFormat, "text", "yaml", "json", "pretty-json", "histogram")
+	queryCommand.Flag("follow", "Follow log in quasi-realtime, similar to tail -f (on Cloudwatch, new log streams can take up to a minute to show up)").Short('f').Default("false").BoolVar(&queryFlagFollow)
 }
 
 func commonHintAction(suffix string) []string {
@@ -56,12 +67,28 @@ func commonHintAction(suffix string) []string {
 	return resultList
 }
 
+// Completes field names followed by the separator, as well as the values seen for them (if any)
+func valueHintAction(separator string) []string {
+	rc := config.BuildConfig()
+	resultList := commonHintAction(separator)
+	for field, values := range complete.GetValueCompletions(rc) {
+		for _, value := range values {
+			resultList = append(resultList, fmt.Sprintf("%s%s%s", field, separator, value))
+		}
+	}
+	return resultList
+}
+
 func whereHintAction() []string {
-	return commonHintAction("=")
+	return valueHintAction("=")
 }
 
 func oneOfHintAction() []string {
-	return commonHintAction(":")
+	return valueHintAction(":")
+}
+
+func matchesHintAction() []string {
+	return commonHintAction("~")
 }
 
 func existenceHintAction() []string {
@@ -72,7 +99,7 @@ func selectHintAction() []string {
 	return commonHintAction("")
 }
 
-var equalityFilterRegex = regexp.MustCompile(`([^!=<>]+)\s*(=|!=)\s*(.*)`)
+var equalityFilterRegex = regexp.MustCompile(`([^!=<>]+)\s*(=|!=|>=|<=|>|<)\s*(.*)`)
 
 func buildEqualityFilters(wheres []string) []common.EqualityFilter {
 	filters := make([]common.EqualityFilter, 0, len(wheres))
@@ -134,6 +161,35 @@ func buildMembershipFilters(oneOfs []string, notOneOfs []string) []common.Member
 	return filters
 }
 
+var regexFilterRegex = regexp.MustCompile(`^([^~]+)~(.*)$`)
+
+func appendRegexFilters(filters []common.RegexFilter, clauses []string, negated bool) []common.RegexFilter {
+	for _, clause := range clauses {
+		matches := regexFilterRegex.FindStringSubmatch(clause)
+		if matches == nil {
+			if negated {
+				fmt.Println("Invalid not-matches clause", clause)
+			} else {
+				fmt.Println("Invalid matches clause", clause)
+			}
+			os.Exit(1)
+		}
+		filter, err := common.NewRegexFilter(strings.TrimSpace(matches[1]), matches[2], negated)
+		if err != nil {
+			fmt.Printf("Invalid regular expression in %s: %v\n", clause, err)
+			os.Exit(1)
+		}
+		filters = append(filters, filter)
+	}
+	return filters
+}
+
+func buildRegexFilters(matches []string, notMatches []string) []common.RegexFilter {
+	filters := make([]common.RegexFilter, 0, len(matches)+len(notMatches))
+	filters = appendRegexFilters(filters, matches, false)
+	return appendRegexFilters(filters, notMatches, true)
+}
+
 func buildExistenceFilters(exists []string, notExists []string) []common.ExistenceFilter {
 	filters := make([]common.ExistenceFilter, 0, len(exists)+len(notExists))
 	for _, existsFieldName := range exists {
@@ -151,6 +207,25 @@ func buildExistenceFilters(exists []string, notExists []string) []common.Existen
 	return filters
 }
 
+func buildFilterExpression(filters []string) common.FilterExpression {
+	if len(filters) == 0 {
+		return nil
+	}
+	exprs := make([]common.FilterExpression, 0, len(filters))
+	for _, filter := range filters {
+		expr, err := common.ParseFilterExpression(filter)
+		if err != nil {
+			fmt.Printf("Invalid filter expression %s: %v\n", filter, err)
+			os.Exit(1)
+		}
+		exprs = append(exprs, expr)
+	}
+	if len(exprs) == 1 {
+		return exprs[0]
+	}
+	return common.AndExpression{Operands: exprs}
+}
+
 func stringToTime(raw string) (*time.Time, error) {
 	if raw == "" {
 		return nil, nil
@@ -223,6 +298,17 @@ func querySelectorsToQuery(flags *common.QuerySelectors) common.Query {
 		}
 	}
 
+	pollInterval, err := parseOptionalDuration(flags.PollInterval)
+	if err != nil {
+		fmt.Printf("Invalid poll interval: %v\n", err)
+		os.Exit(1)
+	}
+	followOverlap, err := parseOptionalDuration(flags.FollowOverlap)
+	if err != nil {
+		fmt.Printf("Invalid follow overlap: %v\n", err)
+		os.Exit(1)
+	}
+
 	// before and after could be nil if not provided, but if they were provided
 	// or `last` flag was provided print range of dates from which logs will be showed.
 	if after != nil {
@@ -239,22 +325,44 @@ func querySelectorsToQuery(flags *common.QuerySelectors) common.Query {
 		EqualityFilters:   buildEqualityFilters(flags.Where),
 		ExistenceFilters:  buildExistenceFilters(flags.Exists, flags.NotExists),
 		MembershipFilters: buildMembershipFilters(flags.OneOf, flags.NotOneOf),
+		RegexFilters:      buildRegexFilters(flags.Matches, flags.NotMatches),
+		Filter:            buildFilterExpression(flags.Filter),
 		SelectFields:      flags.Select,
 		Unique:            flags.Unique,
+		PollInterval:      pollInterval,
+		FollowOverlap:     followOverlap,
 	}
 }
 
-func queryMain(ctx context.Context, rc config.RuntimeConfig, client common.Client) {
-	query := querySelectorsToQuery(queryFlags)
-	if !client.ImplementsAdvancedFilters() && (len(query.ExistenceFilters) > 0 || len(query.MembershipFilters) > 0) {
-		fmt.Println("This backend does not support advanded filters (yet!)")
-		os.Exit(1)
+func parseOptionalDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%s is not positive", s)
 	}
+	return d, nil
+}
 
+func queryMain(ctx context.Context, rc config.RuntimeConfig, client common.Client) {
+	query := querySelectorsToQuery(queryFlags)
 	query.MaxResults = queryFlagMaxResults
 	query.Follow = queryFlagFollow
+	if queryFlagOutputFormat == "histogram" {
+		if query.Follow {
+			fmt.Println("The histogram output format can't be used in follow mode")
+			os.Exit(1)
+		}
+		buckets, interval := bucketQueryResults(complete.GatherCompletionInfo(rc, query, common.QueryWithFallback(ctx, client, query)), query)
+		printHistogram(buckets, interval, "text", rc.Config.Colors)
+		return
+	}
 	seenBeforeHash := make(map[string]bool)
-	for message := range complete.GatherCompletionInfo(rc, client.Query(ctx, query)) {
+	for message := range complete.GatherCompletionInfo(rc, query, common.QueryWithFallback(ctx, client, query)) {
 		if query.Unique {
 			contentHash := message.ContentHash()
 			if seenBeforeHash[contentHash] {
@@ -178,3 +178,66 @@ func Test_humanToTimeInterval(t *testing.T) {
 		})
 	}
 }
+
+func Test_buildEqualityFilters(t *testing.T) {
+	got := buildEqualityFilters([]string{"domain=zef", "domain!=pete", "duration_ms>500", "status>=500", "size<10", "age<=34"})
+	want := []common.EqualityFilter{
+		{FieldName: "domain", Operator: "=", Value: "zef"},
+		{FieldName: "domain", Operator: "!=", Value: "pete"},
+		{FieldName: "duration_ms", Operator: ">", Value: "500"},
+		{FieldName: "status", Operator: ">=", Value: "500"},
+		{FieldName: "size", Operator: "<", Value: "10"},
+		{FieldName: "age", Operator: "<=", Value: "34"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("buildEqualityFilters() = %v, want %v", got, want)
+	}
+}
+
+func Test_buildRegexFilters(t *testing.T) {
+	got := buildRegexFilters([]string{"path~^/api/v2/"}, []string{"user_agent ~(?i)bot"})
+	if len(got) != 2 {
+		t.Fatalf("buildRegexFilters() = %v, want 2 filters", got)
+	}
+	if got[0].FieldName != "path" || got[0].Regexp.String() != "^/api/v2/" || got[0].Negated {
+		t.Errorf("Unexpected first filter: %+v", got[0])
+	}
+	if got[1].FieldName != "user_agent" || got[1].Regexp.String() != "(?i)bot" || !got[1].Negated {
+		t.Errorf("Unexpected second filter: %+v", got[1])
+	}
+}
+
+func Test_buildFilterExpression(t *testing.T) {
+	if got := buildFilterExpression(nil); got != nil {
+		t.Errorf("buildFilterExpression() = %v, want nil", got)
+	}
+	got := buildFilterExpression([]string{"level=error OR level=fatal", "service!=healthcheck"})
+	want := common.AndExpression{
+		Operands: []common.FilterExpression{
+			common.OrExpression{
+				Operands: []common.FilterExpression{
+					common.EqualityFilter{FieldName: "level", Operator: "=", Value: "error"},
+					common.EqualityFilter{FieldName: "level", Operator: "=", Value: "fatal"},
+				},
+			},
+			common.EqualityFilter{FieldName: "service", Operator: "!=", Value: "healthcheck"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("buildFilterExpression() = %v, want %v", got, want)
+	}
+}
+
+func Test_parseOptionalDuration(t *testing.T) {
+	if d, err := parseOptionalDuration(""); d != 0 || err != nil {
+		t.Errorf("parseOptionalDuration(\"\") = %v, %v, want 0", d, err)
+	}
+	if d, err := parseOptionalDuration("90s"); d != 90*time.Second || err != nil {
+		t.Errorf("parseOptionalDuration(\"90s\") = %v, %v, want 1m30s", d, err)
+	}
+	for _, invalid := range []string{"5", "-1m", "0s", "soon"} {
+		if _, err := parseOptionalDuration(invalid); err == nil {
+			t.Errorf("parseOptionalDuration(%q) should fail", invalid)
+		}
+	}
+}
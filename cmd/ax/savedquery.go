@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+
+	"github.com/egnyte/ax/pkg/config"
+)
+
+// Saved queries are managed with ax query save/run/list. As ax query takes a query string argument, kingpin
+// doesn't allow it to have sub commands, so these (and ax @name) are rewritten before parsing the command line.
+type savedQueryCommand struct {
+	args        []string // Command line to parse
+	saveAs      string   // For ax query save, the name to save the query as
+	list        bool     // For ax query list
+	completions []string // Set when completing a saved query name or sub command, instead of args
+}
+
+var savedQuerySubCommands = []string{"list", "run", "save"}
+
+// Flags of a saved query that are replaced rather than added to when given on the command line
+var overridingFlags = map[string][]string{
+	"source":  {"--env", "-e", "--docker", "--k8s", "--k8s-namespace", "--k8s-selector", "--journal", "--file", "--syslog"},
+	"last":    {"--last", "--before", "--after"},
+	"results": {"--results", "-n"},
+	"output":  {"--output", "-o"},
+}
+
+// Flags of ax query that don't take a value, to tell which arguments are flag values
+var boolFlags = map[string]bool{"--uniq": true, "--follow": true, "-f": true, "--journal": true, "--help": true, "--version": true}
+
+// Returns the name of the flag an argument gives (e.g. -n for -n, -n50 and -n=50, --env for --env=prod),
+// and whether the next argument is its value
+func flagName(arg string) (string, bool) {
+	if strings.HasPrefix(arg, "--") {
+		if i := strings.Index(arg, "="); i >= 0 {
+			return arg[:i], false
+		}
+		return arg, !boolFlags[arg] && !strings.HasPrefix(arg, "--no-")
+	}
+	if len(arg) > 2 {
+		return arg[:2], false
+	}
+	return arg, !boolFlags[arg]
+}
+
+// Tells whether one of flags is given in args, skipping over arguments that are flag values
+func givenFlag(args []string, flags []string) bool {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return false
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			continue
+		}
+		name, takesValue := flagName(arg)
+		for _, flag := range flags {
+			if name == flag {
+				return true
+			}
+		}
+		if takesValue {
+			i++
+		}
+	}
+	return false
+}
+
+// Turns a saved query back into the ax query command line it was saved with, leaving out the flags
+// that are also in extraArgs and would otherwise be combined with the saved ones
+func savedQueryArgs(query config.SavedQuery, extraArgs []string) []string {
+	args := []string{"query"}
+	addString := func(flag, value string) {
+		if value != "" {
+			args = append(args, flag, value)
+		}
+	}
+	addStrings := func(flag string, values []string) {
+		for _, value := range values {
+			args = append(args, flag, value)
+		}
+	}
+	s := query.Selector
+	if !givenFlag(extraArgs, overridingFlags["source"]) {
+		addStrings("--env", query.Env)
+		addString("--docker", query.Docker)
+		addString("--k8s", query.K8s)
+		addString("--k8s-namespace", query.K8sNamespace)
+		addString("--k8s-selector", query.K8sSelector)
+		if query.Journal {
+			args = append(args, "--journal")
+		}
+		addString("--file", query.File)
+		addString("--syslog", query.Syslog)
+	}
+	if !givenFlag(extraArgs, overridingFlags["last"]) {
+		addString("--last", s.Last)
+		addString("--before", s.Before)
+		addString("--after", s.After)
+	}
+	addStrings("--select", s.Select)
+	addStrings("--where", s.Where)
+	addStrings("--where-one-of", s.OneOf)
+	addStrings("--where-not-one-of", s.NotOneOf)
+	addStrings("--where-matches", s.Matches)
+	addStrings("--where-not-matches", s.NotMatches)
+	addStrings("--where-exists", s.Exists)
+	addStrings("--where-not-exists", s.NotExists)
+	addStrings("--filter", s.Filter)
+	if s.Unique {
+		args = append(args, "--uniq")
+	}
+	addString("--poll-interval", s.PollInterval)
+	addString("--follow-overlap", s.FollowOverlap)
+	if query.Results != 0 && !givenFlag(extraArgs, overridingFlags["results"]) {
+		args = append(args, "--results", strconv.Itoa(query.Results))
+	}
+	if !givenFlag(extraArgs, overridingFlags["output"]) {
+		addString("--output", query.Output)
+	}
+	if query.Follow {
+		args = append(args, "--follow")
+	}
+	return append(args, s.QueryString...)
+}
+
+func savedQueryNames(queries map[string]config.SavedQuery, prefix string) []string {
+	names := make([]string, 0, len(queries))
+	for name := range queries {
+		names = append(names, prefix+name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func runSavedQuery(name string, extraArgs []string, queries map[string]config.SavedQuery) ([]string, error) {
+	query, ok := queries[name]
+	if !ok {
+		return nil, fmt.Errorf("No saved query named %s, see ax query list", name)
+	}
+	return append(savedQueryArgs(query, extraArgs), extraArgs...), nil
+}
+
+// Rewrites ax query save/run/list and ax @name into commands kingpin can parse
+func parseSavedQueryCommand(args []string, queries map[string]config.SavedQuery) (savedQueryCommand, error) {
+	command := savedQueryCommand{args: args}
+	completing := len(args) > 0 && args[0] == "--completion-bash"
+	prefix := []string{}
+	if completing {
+		prefix, args = []string{"--completion-bash"}, args[1:]
+	}
+	switch {
+	case len(args) > 0 && strings.HasPrefix(args[0], "@"):
+		if completing && len(args) == 1 {
+			command.completions = savedQueryNames(queries, "@")
+			return command, nil
+		}
+		expanded, err := runSavedQuery(args[0][1:], args[1:], queries)
+		command.args = append(prefix, expanded...)
+		return command, err
+	case len(args) == 0 || args[0] != "query":
+		return command, nil
+	case completing && (len(args) == 1 || (len(args) == 2 && !strings.HasPrefix(args[1], "-"))):
+		command.completions = savedQuerySubCommands
+		return command, nil
+	case len(args) == 1:
+		return command, nil
+	}
+	switch args[1] {
+	case "list":
+		command.list = true
+	case "run":
+		if completing && len(args) <= 3 {
+			command.completions = savedQueryNames(queries, "")
+			return command, nil
+		}
+		if len(args) < 3 {
+			return command, fmt.Errorf("Usage: ax query run <name> [flags]")
+		}
+		expanded, err := runSavedQuery(args[2], args[3:], queries)
+		command.args = append(prefix, expanded...)
+		return command, err
+	case "save":
+		if completing && len(args) <= 3 {
+			command.completions = savedQueryNames(queries, "")
+			return command, nil
+		}
+		if len(args) < 3 || strings.HasPrefix(args[2], "-") {
+			return command, fmt.Errorf("Usage: ax query save <name> [flags]")
+		}
+		command.saveAs = strings.TrimPrefix(args[2], "@")
+		command.args = append(append(prefix, "query"), args[3:]...)
+	}
+	return command, nil
+}
+
+func saveQuery(name string) {
+	query := config.SavedQuery{
+		QuerySource: config.SourceFlags(),
+		Follow:      queryFlagFollow,
+		Selector:    *queryFlags,
+	}
+	if queryFlagOutputFormat != queryDefaultOutputFormat {
+		query.Output = queryFlagOutputFormat
+	}
+	if queryFlagMaxResults != queryDefaultMaxResults {
+		query.Results = queryFlagMaxResults
+	}
+	config.SaveQuery(name, query)
+	fmt.Printf("Saved query %s, run it with: ax @%s\n", name, name)
+}
+
+func quoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\"'$*?!&|;<>()\\`") {
+			arg = strconv.Quote(arg)
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
+
+func listSavedQueries(queries map[string]config.SavedQuery) {
+	if len(queries) == 0 {
+		fmt.Println("No saved queries yet, save one with: ax query save <name> [flags]")
+		return
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Name", "Command"})
+	table.SetAutoWrapText(false)
+	for _, name := range savedQueryNames(queries, "") {
+		table.Append([]string{name, "ax " + quoteArgs(savedQueryArgs(queries[name], nil))})
+	}
+	table.Render()
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+	"github.com/egnyte/ax/pkg/config"
+)
+
+var testSavedQueries = map[string]config.SavedQuery{
+	"errors": {
+		QuerySource: config.QuerySource{Env: []string{"prod"}},
+		Output:      "json",
+		Results:     200,
+		Selector: common.QuerySelectors{
+			Last:        "1 hour",
+			Where:       []string{"level=error"},
+			QueryString: []string{"timeout"},
+		},
+	},
+	"all": {},
+	"web": {
+		QuerySource: config.QuerySource{K8s: "web", K8sNamespace: "shop", Journal: true},
+		Selector:    common.QuerySelectors{Where: []string{"status>=500"}},
+	},
+}
+
+func TestParseSavedQueryCommand(t *testing.T) {
+	errorsArgs := []string{"query", "--env", "prod", "--last", "1 hour", "--where", "level=error", "--results", "200", "--output", "json", "timeout"}
+	tests := []struct {
+		args     []string
+		expected savedQueryCommand
+	}{
+		{[]string{"query", "--where", "a=b"}, savedQueryCommand{args: []string{"query", "--where", "a=b"}}},
+		{[]string{"stats", "--by", "level"}, savedQueryCommand{args: []string{"stats", "--by", "level"}}},
+		{[]string{"@errors"}, savedQueryCommand{args: errorsArgs}},
+		{[]string{"query", "run", "errors"}, savedQueryCommand{args: errorsArgs}},
+		// Extra filters are added, flags taking one value replace the saved ones
+		{[]string{"@errors", "--where", "service=api", "-e", "staging", "--after", "2018-10-01", "-ojson", "db"}, savedQueryCommand{args: []string{
+			"query", "--where", "level=error", "--results", "200", "timeout",
+			"--where", "service=api", "-e", "staging", "--after", "2018-10-01", "-ojson", "db",
+		}}},
+		{[]string{"@all"}, savedQueryCommand{args: []string{"query"}}},
+		// Values that look like short flags aren't flags
+		{[]string{"@errors", "--where", "-error", "-w", "-o", "--", "-n"}, savedQueryCommand{args: []string{
+			"query", "--env", "prod", "--last", "1 hour", "--where", "level=error", "--results", "200", "--output", "json", "timeout",
+			"--where", "-error", "-w", "-o", "--", "-n",
+		}}},
+		{[]string{"@errors", "-n=10", "-f"}, savedQueryCommand{args: []string{
+			"query", "--env", "prod", "--last", "1 hour", "--where", "level=error", "--output", "json", "timeout", "-n=10", "-f",
+		}}},
+		{[]string{"@web"}, savedQueryCommand{args: []string{
+			"query", "--k8s", "web", "--k8s-namespace", "shop", "--journal", "--where", "status>=500",
+		}}},
+		// Any other source replaces the saved one
+		{[]string{"@web", "--docker", "api"}, savedQueryCommand{args: []string{"query", "--where", "status>=500", "--docker", "api"}}},
+		{[]string{"@errors", "--file=app.log"}, savedQueryCommand{args: []string{
+			"query", "--last", "1 hour", "--where", "level=error", "--results", "200", "--output", "json", "timeout", "--file=app.log",
+		}}},
+		{[]string{"query", "list"}, savedQueryCommand{args: []string{"query", "list"}, list: true}},
+		{[]string{"query", "save", "@slow", "--where", "took>1000"}, savedQueryCommand{args: []string{"query", "--where", "took>1000"}, saveAs: "slow"}},
+		{[]string{"--completion-bash", "@"}, savedQueryCommand{args: []string{"--completion-bash", "@"}, completions: []string{"@all", "@errors", "@web"}}},
+		{[]string{"--completion-bash", "query", "run", "err"}, savedQueryCommand{args: []string{"--completion-bash", "query", "run", "err"}, completions: []string{"all", "errors", "web"}}},
+		{[]string{"--completion-bash", "query"}, savedQueryCommand{args: []string{"--completion-bash", "query"}, completions: savedQuerySubCommands}},
+		{[]string{"--completion-bash", "query", "--wh"}, savedQueryCommand{args: []string{"--completion-bash", "query", "--wh"}}},
+		{[]string{"--completion-bash", "@all", "--wh"}, savedQueryCommand{args: []string{"--completion-bash", "query", "--wh"}}},
+	}
+	for _, test := range tests {
+		command, err := parseSavedQueryCommand(test.args, testSavedQueries)
+		if err != nil {
+			t.Errorf("Unexpected error for %v: %v", test.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(command, test.expected) {
+			t.Errorf("Unexpected command for %v: %+v", test.args, command)
+		}
+	}
+	for _, args := range [][]string{{"@missing"}, {"query", "run"}, {"query", "save"}, {"query", "save", "--where", "a=b"}} {
+		if _, err := parseSavedQueryCommand(args, testSavedQueries); err == nil {
+			t.Errorf("Expected an error for %v", args)
+		}
+	}
+}
+
+func TestQuoteArgs(t *testing.T) {
+	if quoted := quoteArgs([]string{"query", "--last", "1 hour", "--where", "level=error"}); quoted != `query --last "1 hour" --where level=error` {
+		t.Errorf("Unexpected quoting: %s", quoted)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+	"github.com/egnyte/ax/pkg/config"
+	"github.com/olekukonko/tablewriter"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var (
+	statsFlags            = addQueryFlags(statsCommand)
+	statsFlagGroupBy      []string
+	statsFlagMetrics      []string
+	statsFlagMaxResults   int
+	statsFlagMaxGroups    int
+	statsFlagOutputFormat string
+)
+
+func init() {
+	statsCommand.Flag("by", "Field to count messages by, repeat to group by multiple").HintAction(selectHintAction).StringsVar(&statsFlagGroupBy)
+	statsCommand.Flag("metric", "Numeric field to compute min, max, avg and percentiles of").HintAction(selectHintAction).StringsVar(&statsFlagMetrics)
+	statsCommand.Flag("results", "Maximum number of messages to aggregate, for backends that can't aggregate natively").Short('n').Default("10000").IntVar(&statsFlagMaxResults)
+	statsCommand.Flag("groups", "Maximum number of groups, the largest are shown").Default("100").IntVar(&statsFlagMaxGroups)
+	statsCommand.Flag("output", "Output format: text|json|yaml").Short('o').Default("text").EnumVar(&statsFlagOutputFormat, "text", "yaml", "json", "pretty-json")
+}
+
+func formatStat(value float64) string {
+	if value == float64(int64(value)) {
+		return strconv.FormatInt(int64(value), 10)
+	}
+	return strconv.FormatFloat(value, 'f', 2, 64)
+}
+
+// Converts a group into a map for JSON and YAML output, with the metrics in nested maps
+func statsGroupMap(group common.StatsGroup, query common.StatsQuery) map[string]interface{} {
+	out := make(map[string]interface{})
+	for i, field := range query.GroupBy {
+		out[field] = group.Key[i]
+	}
+	out["count"] = group.Count
+	for _, metric := range query.Metrics {
+		stats, ok := group.Metrics[metric]
+		if !ok {
+			continue
+		}
+		metricMap := map[string]interface{}{
+			"count": stats.Count,
+			"min":   stats.Min,
+			"max":   stats.Max,
+			"avg":   stats.Avg,
+		}
+		for _, p := range common.StatsPercentiles {
+			metricMap[fmt.Sprintf("p%s", formatStat(p))] = stats.Percentiles[p]
+		}
+		out[metric] = metricMap
+	}
+	return out
+}
+
+func printStatsTable(groups []common.StatsGroup, query common.StatsQuery) {
+	table := tablewriter.NewWriter(os.Stdout)
+	header := append(append([]string{}, query.GroupBy...), "count")
+	for _, metric := range query.Metrics {
+		header = append(header, metric+" min", metric+" max", metric+" avg")
+		for _, p := range common.StatsPercentiles {
+			header = append(header, fmt.Sprintf("%s p%s", metric, formatStat(p)))
+		}
+	}
+	table.SetHeader(header)
+	table.SetAutoFormatHeaders(false)
+	for _, group := range groups {
+		row := append(append([]string{}, group.Key...), strconv.Itoa(group.Count))
+		for _, metric := range query.Metrics {
+			stats, ok := group.Metrics[metric]
+			if !ok {
+				for i := 0; i < 3+len(common.StatsPercentiles); i++ {
+					row = append(row, "-")
+				}
+				continue
+			}
+			row = append(row, formatStat(stats.Min), formatStat(stats.Max), formatStat(stats.Avg))
+			for _, p := range common.StatsPercentiles {
+				row = append(row, formatStat(stats.Percentiles[p]))
+			}
+		}
+		table.Append(row)
+	}
+	table.Render()
+}
+
+func statsMain(ctx context.Context, rc config.RuntimeConfig, client common.Client) {
+	query := common.StatsQuery{
+		Query:     querySelectorsToQuery(statsFlags),
+		GroupBy:   statsFlagGroupBy,
+		Metrics:   statsFlagMetrics,
+		MaxGroups: statsFlagMaxGroups,
+	}
+	query.MaxResults = statsFlagMaxResults
+	groups, err := common.QueryStats(ctx, client, query)
+	if err != nil {
+		fmt.Println("Could not compute statistics:", err)
+		os.Exit(1)
+	}
+	switch statsFlagOutputFormat {
+	case "text":
+		printStatsTable(groups, query)
+	case "json", "pretty-json":
+		encoder := json.NewEncoder(os.Stdout)
+		if statsFlagOutputFormat == "pretty-json" {
+			encoder.SetIndent("", "  ")
+		}
+		for _, group := range groups {
+			if err := encoder.Encode(statsGroupMap(group, query)); err != nil {
+				fmt.Println("Error JSON encoding")
+			}
+		}
+	case "yaml":
+		for _, group := range groups {
+			buf, err := yaml.Marshal(statsGroupMap(group, query))
+			if err != nil {
+				fmt.Println("Error YAML encoding")
+			}
+			fmt.Printf("---\n%s", string(buf))
+		}
+	}
+}
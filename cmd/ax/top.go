@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/zefhemel/kingpin"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+	"github.com/egnyte/ax/pkg/complete"
+	"github.com/egnyte/ax/pkg/config"
+)
+
+var (
+	topFlagFields       string
+	topFlags            = addTopArgs(topCommand)
+	topFlagK            int
+	topFlagMaxResults   int
+	topFlagOutputFormat string
+)
+
+// The fields argument has to be added before the query string argument added by addQueryFlags
+func addTopArgs(cmd *kingpin.CmdClause) *common.QuerySelectors {
+	cmd.Arg("fields", "Fields to report the most frequent values of, comma separated").Required().HintAction(selectHintAction).StringVar(&topFlagFields)
+	return addQueryFlags(cmd)
+}
+
+func init() {
+	topCommand.Flag("values", "Number of values to report per field").Short('k').Default("10").IntVar(&topFlagK)
+	topCommand.Flag("results", "Maximum number of messages to analyze").Short('n').Default("10000").IntVar(&topFlagMaxResults)
+	topCommand.Flag("output", "Output format: text|json|yaml").Short('o').Default("text").EnumVar(&topFlagOutputFormat, "text", "yaml", "json", "pretty-json")
+}
+
+type valueCount struct {
+	Value string
+	Count int
+}
+
+// Counts the values of fields over messages, returning the counts per field and the number of messages
+func countValues(messages <-chan common.LogMessage, fields []string) (map[string]map[string]int, int) {
+	counts := make(map[string]map[string]int)
+	for _, field := range fields {
+		counts[field] = make(map[string]int)
+	}
+	total := 0
+	for message := range messages {
+		total++
+		for _, field := range fields {
+			if value, ok := message.Attributes[field]; ok && value != nil {
+				counts[field][fmt.Sprintf("%v", value)]++
+			}
+		}
+	}
+	return counts, total
+}
+
+// Returns the k most frequent values, ordered by count, then by value
+func topValues(counts map[string]int, k int) []valueCount {
+	values := make([]valueCount, 0, len(counts))
+	for value, count := range counts {
+		values = append(values, valueCount{value, count})
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].Count != values[j].Count {
+			return values[i].Count > values[j].Count
+		}
+		return values[i].Value < values[j].Value
+	})
+	if len(values) > k {
+		values = values[:k]
+	}
+	return values
+}
+
+func percentage(count, total int) string {
+	return strconv.FormatFloat(float64(count)*100/float64(total), 'f', 1, 64) + "%"
+}
+
+func printTop(fields []string, counts map[string]map[string]int, total int, k int, outputFormat string) {
+	switch outputFormat {
+	case "text":
+		if total == 0 {
+			fmt.Println("No messages found")
+			return
+		}
+		for i, field := range fields {
+			if i > 0 {
+				fmt.Println()
+			}
+			present := 0
+			for _, count := range counts[field] {
+				present += count
+			}
+			fmt.Printf("%s: %d distinct values in %d of %d messages\n", field, len(counts[field]), present, total)
+			table := tablewriter.NewWriter(os.Stdout)
+			table.SetHeader([]string{"Value", "Count", "%"})
+			for _, value := range topValues(counts[field], k) {
+				table.Append([]string{value.Value, strconv.Itoa(value.Count), percentage(value.Count, total)})
+			}
+			if missing := total - present; missing > 0 {
+				table.Append([]string{"(missing)", strconv.Itoa(missing), percentage(missing, total)})
+			}
+			table.Render()
+		}
+	case "json", "pretty-json":
+		encoder := json.NewEncoder(os.Stdout)
+		if outputFormat == "pretty-json" {
+			encoder.SetIndent("", "  ")
+		}
+		for _, field := range fields {
+			for _, value := range topValues(counts[field], k) {
+				if err := encoder.Encode(topValueMap(field, value, total)); err != nil {
+					fmt.Println("Error JSON encoding")
+				}
+			}
+		}
+	case "yaml":
+		for _, field := range fields {
+			for _, value := range topValues(counts[field], k) {
+				buf, err := yaml.Marshal(topValueMap(field, value, total))
+				if err != nil {
+					fmt.Println("Error YAML encoding")
+				}
+				fmt.Printf("---\n%s", string(buf))
+			}
+		}
+	}
+}
+
+func topValueMap(field string, value valueCount, total int) map[string]interface{} {
+	return map[string]interface{}{
+		"field":      field,
+		"value":      value.Value,
+		"count":      value.Count,
+		"percentage": float64(value.Count) * 100 / float64(total),
+	}
+}
+
+func topMain(ctx context.Context, rc config.RuntimeConfig, client common.Client) {
+	fields := strings.Split(topFlagFields, ",")
+	query := querySelectorsToQuery(topFlags)
+	query.MaxResults = topFlagMaxResults
+	query.SelectFields = fields
+	// Also records the values, so that --where field=<TAB> can suggest them
+	counts, total := countValues(complete.GatherCompletionInfo(rc, query, common.QueryWithFallback(ctx, client, query)), fields)
+	printTop(fields, counts, total, topFlagK, topFlagOutputFormat)
+}
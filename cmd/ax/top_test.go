@@ -0,0 +1,36 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+)
+
+func TestCountValues(t *testing.T) {
+	messages := make(chan common.LogMessage, 10)
+	for _, attributes := range []map[string]interface{}{
+		{"level": "error", "status": 500.0},
+		{"level": "info", "status": 200.0},
+		{"level": "info", "status": 200.0},
+		{"level": "warn"},
+		{"status": nil},
+	} {
+		messages <- common.LogMessage{Attributes: attributes}
+	}
+	close(messages)
+	counts, total := countValues(messages, []string{"level", "status"})
+	if total != 5 {
+		t.Errorf("Expected 5 messages, got %d", total)
+	}
+	expected := map[string]map[string]int{
+		"level":  {"error": 1, "info": 2, "warn": 1},
+		"status": {"500": 1, "200": 2},
+	}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("Unexpected counts: %v", counts)
+	}
+	if top := topValues(counts["level"], 2); !reflect.DeepEqual(top, []valueCount{{"info", 2}, {"error", 1}}) {
+		t.Errorf("Unexpected top values: %v", top)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+	"github.com/egnyte/ax/pkg/backend/multi"
+	"github.com/egnyte/ax/pkg/config"
+)
+
+var (
+	traceFlags            = &common.QuerySelectors{}
+	traceFlagID           string
+	traceFlagField        string
+	traceFlagServiceField string
+	traceFlagMaxResults   int
+	traceFlagOutputFormat string
+)
+
+func init() {
+	traceCommand.Arg("id", "Trace or request ID to look for").Required().StringVar(&traceFlagID)
+	traceCommand.Flag("field", "Field holding the ID, for environments without a trace_field").StringVar(&traceFlagField)
+	traceCommand.Flag("service-field", "Field to group messages by, the environment name is used for messages without it").Default("service").StringVar(&traceFlagServiceField)
+	traceCommand.Flag("last", "Results from last x minutes, hours, days, months, years. If used after and before are ignored").StringVar(&traceFlags.Last)
+	traceCommand.Flag("before", "Results from before").StringVar(&traceFlags.Before)
+	traceCommand.Flag("after", "Results from after").StringVar(&traceFlags.After)
+	traceCommand.Flag("results", "Maximum number of results").Short('n').Default("500").IntVar(&traceFlagMaxResults)
+	traceCommand.Flag("output", "Output format: text|json|yaml").Short('o').Default("text").EnumVar(&traceFlagOutputFormat, "text", "yaml", "json", "pretty-json")
+}
+
+// Returns the field holding the trace ID for every environment to query. Those are the environments
+// selected with --env, or all configured environments, that have a trace_field (or fallbackField is set).
+func traceFields(rc config.RuntimeConfig, fallbackField string) map[string]string {
+	envNames := make([]string, 0)
+	for _, name := range strings.Split(rc.ActiveEnv, ",") {
+		// Flags like --docker set an ActiveEnv that's not in the config
+		if _, ok := rc.Config.Environments[name]; ok {
+			envNames = append(envNames, name)
+		}
+	}
+	if len(envNames) == 0 {
+		for name := range rc.Config.Environments {
+			envNames = append(envNames, name)
+		}
+	}
+	fields := make(map[string]string)
+	for _, name := range envNames {
+		field := rc.Config.Environments[name]["trace_field"]
+		if field == "" {
+			field = fallbackField
+		}
+		if field != "" {
+			fields[name] = field
+		}
+	}
+	return fields
+}
+
+// Returns the service a message belongs to, falling back to the environment it came from
+func traceService(message common.LogMessage, serviceField string) string {
+	if service, ok := message.Attributes[serviceField]; ok && service != nil {
+		return fmt.Sprintf("%v", service)
+	}
+	if env, ok := message.Attributes["@env"].(string); ok {
+		return env
+	}
+	return "unknown"
+}
+
+type serviceSummary struct {
+	name     string
+	count    int
+	first    time.Time
+	last     time.Time
+	position int // Order of first appearance
+}
+
+// Summarizes the services in a trace, ordered by when they first appear
+func summarizeServices(messages []common.LogMessage, serviceField string) []serviceSummary {
+	byName := make(map[string]*serviceSummary)
+	for _, message := range messages {
+		name := traceService(message, serviceField)
+		summary, ok := byName[name]
+		if !ok {
+			summary = &serviceSummary{name: name, first: message.Timestamp, position: len(byName)}
+			byName[name] = summary
+		}
+		summary.count++
+		summary.last = message.Timestamp
+	}
+	summaries := make([]serviceSummary, 0, len(byName))
+	for _, summary := range byName {
+		summaries = append(summaries, *summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].position < summaries[j].position
+	})
+	return summaries
+}
+
+func printTimeline(messages []common.LogMessage, hiddenFields map[string]bool, serviceField string, colorConfig config.ColorConfig) {
+	if len(messages) == 0 {
+		fmt.Println("No messages found for", traceFlagID)
+		return
+	}
+	start := messages[0].Timestamp
+	services := summarizeServices(messages, serviceField)
+	serviceWidth := 0
+	for _, service := range services {
+		if len(service.name) > serviceWidth {
+			serviceWidth = len(service.name)
+		}
+	}
+	timestampColor := config.ColorToTermColor(colorConfig.Timestamp)
+	messageColor := config.ColorToTermColor(colorConfig.Message)
+	attributeKeyColor := config.ColorToTermColor(colorConfig.AttributeKey)
+	attributeValueColor := config.ColorToTermColor(colorConfig.AttributeValue)
+	fmt.Printf("Trace %s: %d messages from %d services over %s\n\n", traceFlagID, len(messages), len(services), messages[len(messages)-1].Timestamp.Sub(start))
+	for _, message := range messages {
+		fmt.Printf("%s %10s %s ", timestampColor.Sprintf("[%s]", message.Timestamp.Format(common.TimeFormat)),
+			fmt.Sprintf("+%s", message.Timestamp.Sub(start)), attributeKeyColor.Sprintf("%-*s", serviceWidth, traceService(message, serviceField)))
+		if msg, ok := message.Attributes["message"].(string); ok {
+			fmt.Printf("%s ", messageColor.Sprint(msg))
+		}
+		for key, value := range message.Attributes {
+			if key == "message" || key == serviceField || hiddenFields[key] || value == nil {
+				continue
+			}
+			fmt.Printf("%s%s ", attributeKeyColor.Sprintf("%s=", key), attributeValueColor.Sprintf("%+v", value))
+		}
+		fmt.Println()
+	}
+	fmt.Println()
+	for _, service := range services {
+		fmt.Printf("%s %d messages, +%s to +%s\n", attributeKeyColor.Sprintf("%-*s", serviceWidth, service.name),
+			service.count, service.first.Sub(start), service.last.Sub(start))
+	}
+}
+
+func traceMain(ctx context.Context, rc config.RuntimeConfig) {
+	fields := traceFields(rc, traceFlagField)
+	if len(fields) == 0 {
+		fmt.Println("No environments to trace in, set a trace_field for them in your ax.yaml (ax env edit) or use --field")
+		os.Exit(1)
+	}
+	baseQuery := querySelectorsToQuery(traceFlags)
+	baseQuery.MaxResults = traceFlagMaxResults
+	clients := make(map[string]common.Client)
+	queries := make(map[string]common.Query)
+	hiddenFields := map[string]bool{"@env": true}
+	for name, field := range fields {
+		client := determineEnvClient(rc.Config.Environments[name])
+		if client == nil {
+			fmt.Println("Unsupported backend for environment:", name)
+			os.Exit(1)
+		}
+		clients[name] = client
+		query := baseQuery
+		query.EqualityFilters = []common.EqualityFilter{{FieldName: field, Operator: "=", Value: traceFlagID}}
+		queries[name] = query
+		hiddenFields[field] = true
+	}
+	messages := make([]common.LogMessage, 0)
+	for message := range multi.New(clients).QueryEach(ctx, queries) {
+		if traceFlagOutputFormat != "text" {
+			printMessage(message, traceFlagOutputFormat, rc.Config.Colors)
+			continue
+		}
+		messages = append(messages, message)
+	}
+	if traceFlagOutputFormat == "text" {
+		printTimeline(messages, hiddenFields, traceFlagServiceField, rc.Config.Colors)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+	"github.com/egnyte/ax/pkg/config"
+)
+
+func TestTraceFields(t *testing.T) {
+	rc := config.RuntimeConfig{Config: config.Config{Environments: map[string]config.EnvMap{
+		"gateway": {"backend": "cloudwatch", "trace_field": "x-request-id"},
+		"backend": {"backend": "kibana", "trace_field": "request_id"},
+		"local":   {"backend": "docker"},
+	}}}
+	if fields := traceFields(rc, ""); !reflect.DeepEqual(fields, map[string]string{"gateway": "x-request-id", "backend": "request_id"}) {
+		t.Errorf("Unexpected fields: %v", fields)
+	}
+	if fields := traceFields(rc, "trace_id"); fields["local"] != "trace_id" || fields["backend"] != "request_id" {
+		t.Errorf("Expected the fallback field for environments without a trace_field only: %v", fields)
+	}
+	rc.ActiveEnv = "backend"
+	if fields := traceFields(rc, ""); !reflect.DeepEqual(fields, map[string]string{"backend": "request_id"}) {
+		t.Errorf("Expected only the active environment: %v", fields)
+	}
+}
+
+func TestSummarizeServices(t *testing.T) {
+	start := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	message := func(offset time.Duration, attributes map[string]interface{}) common.LogMessage {
+		return common.LogMessage{Timestamp: start.Add(offset), Attributes: attributes}
+	}
+	summaries := summarizeServices([]common.LogMessage{
+		message(0, map[string]interface{}{"@env": "gateway"}),
+		message(time.Second, map[string]interface{}{"@env": "backend", "service": "orders"}),
+		message(2*time.Second, map[string]interface{}{"@env": "backend", "service": "payments"}),
+		message(3*time.Second, map[string]interface{}{"@env": "backend", "service": "orders"}),
+		message(4*time.Second, map[string]interface{}{"@env": "gateway"}),
+	}, "service")
+	expected := []serviceSummary{
+		{name: "gateway", count: 2, first: start, last: start.Add(4 * time.Second), position: 0},
+		{name: "orders", count: 2, first: start.Add(time.Second), last: start.Add(3 * time.Second), position: 1},
+		{name: "payments", count: 1, first: start.Add(2 * time.Second), last: start.Add(2 * time.Second), position: 2},
+	}
+	if !reflect.DeepEqual(summaries, expected) {
+		t.Errorf("Unexpected summaries: %+v", summaries)
+	}
+}
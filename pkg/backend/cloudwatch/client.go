@@ -11,11 +11,12 @@ import (
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
 	"github.com/egnyte/ax/pkg/backend/common"
 )
 
 type CloudwatchClient struct {
-	logs      *cloudwatchlogs.CloudWatchLogs
+	logs      cloudwatchlogsiface.CloudWatchLogsAPI
 	groupName string
 }
 
@@ -37,19 +38,54 @@ func attemptParseJSON(str string) map[string]interface{} {
 func logEventToMessage(query common.Query, logEvent *cloudwatchlogs.FilteredLogEvent) common.LogMessage {
 	message := common.NewLogMessage()
 	message.ID = *logEvent.EventId
-	message.Timestamp = time.Unix((*logEvent.Timestamp)/1000, (*logEvent.Timestamp)%1000)
+	message.Timestamp = millisToTime(*logEvent.Timestamp)
 	message.Attributes = common.Project(attemptParseJSON(*logEvent.Message), query.SelectFields)
 	return message
 }
 
+func millisToTime(millis int64) time.Time {
+	return time.Unix(0, millis*int64(time.Millisecond))
+}
+
+func timeToMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
 // https://docs.aws.amazon.com/AmazonCloudWatch/latest/logs/FilterAndPatternSyntax.html
 func queryToFilterPattern(query common.Query) string {
 	filterParts := make([]string, 0)
 	for _, filter := range query.EqualityFilters {
-		filterParts = append(filterParts, fmt.Sprintf("($.%s %s \"%s\")", filter.FieldName, filter.Operator, filter.Value))
+		filterParts = append(filterParts, equalityFilterToPattern(filter))
+	}
+	for _, filter := range query.RegexFilters {
+		filterParts = append(filterParts, regexFilterToPattern(filter))
+	}
+	for _, filter := range query.ExistenceFilters {
+		if filter.Exists {
+			// A wildcard matches any value, as long as the field is present
+			filterParts = append(filterParts, fmt.Sprintf("($.%s = \"*\")", filter.FieldName))
+		} else {
+			filterParts = append(filterParts, fmt.Sprintf("($.%s NOT EXISTS)", filter.FieldName))
+		}
+	}
+	for _, filter := range query.MembershipFilters {
+		if len(filter.ValidValues) > 0 {
+			alternatives := make([]string, 0, len(filter.ValidValues))
+			for _, value := range filter.ValidValues {
+				alternatives = append(alternatives, equalityFilterToPattern(common.EqualityFilter{FieldName: filter.FieldName, Operator: "=", Value: value}))
+			}
+			filterParts = append(filterParts, fmt.Sprintf("(%s)", strings.Join(alternatives, " || ")))
+		}
+		for _, value := range filter.InvalidValues {
+			filterParts = append(filterParts, equalityFilterToPattern(common.EqualityFilter{FieldName: filter.FieldName, Operator: "!=", Value: value}))
+		}
+	}
+	if query.Filter != nil {
+		// Filter patterns have no generic negation, so push NOTs down into the comparisons
+		filterParts = append(filterParts, filterExpressionToPattern(common.PushDownNegations(query.Filter)))
 	}
 	var filterPattern string
-	if len(query.EqualityFilters) == 0 {
+	if len(filterParts) == 0 {
 		filterPattern = query.QueryString
 	} else {
 		filterPattern = fmt.Sprintf("%s { %s }", query.QueryString, strings.Join(filterParts, " && "))
@@ -58,54 +94,173 @@ func queryToFilterPattern(query common.Query) string {
 	return strings.TrimSpace(filterPattern)
 }
 
-func (client *CloudwatchClient) ImplementsAdvancedFilters() bool {
+func equalityFilterToPattern(filter common.EqualityFilter) string {
+	if common.IsOrderingOperator(filter.Operator) {
+		// Numeric comparisons require an unquoted value
+		return fmt.Sprintf("($.%s %s %s)", filter.FieldName, filter.Operator, filter.Value)
+	}
+	return fmt.Sprintf("($.%s %s \"%s\")", filter.FieldName, filter.Operator, filter.Value)
+}
+
+// Filter patterns support regular expressions enclosed in %...%, so a % within has to be escaped
+func regexFilterToPattern(filter common.RegexFilter) string {
+	operator := "="
+	if filter.Negated {
+		operator = "!="
+	}
+	return fmt.Sprintf("($.%s %s %%%s%%)", filter.FieldName, operator, escapePercent(filter.Regexp.String()))
+}
+
+func escapePercent(pattern string) string {
+	var escaped strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			// Escaped characters (including \%) are kept as they are, a valid regexp
+			// doesn't end in a lone backslash
+			escaped.WriteString(pattern[i : i+2])
+			i++
+		case '%':
+			escaped.WriteString(`\%`)
+		default:
+			escaped.WriteByte(pattern[i])
+		}
+	}
+	return escaped.String()
+}
+
+func filterExpressionToPattern(expr common.FilterExpression) string {
+	switch e := expr.(type) {
+	case common.AndExpression:
+		return fmt.Sprintf("(%s)", strings.Join(filterExpressionsToPatterns(e.Operands), " && "))
+	case common.OrExpression:
+		return fmt.Sprintf("(%s)", strings.Join(filterExpressionsToPatterns(e.Operands), " || "))
+	case common.EqualityFilter:
+		return equalityFilterToPattern(e)
+	case common.RegexFilter:
+		return regexFilterToPattern(e)
+	default:
+		panic(fmt.Sprintf("Unsupported filter expression: %+v", expr))
+	}
+}
+
+func filterExpressionsToPatterns(exprs []common.FilterExpression) []string {
+	patterns := make([]string, 0, len(exprs))
+	for _, expr := range exprs {
+		patterns = append(patterns, filterExpressionToPattern(expr))
+	}
+	return patterns
+}
+
+// Filter patterns only support numeric values for ordering comparisons, and regular
+// expressions without flags. A NOT that can't be pushed down (on an ordering comparison)
+// isn't supported either, as the inverted comparison would not match messages without the field.
+func (client *CloudwatchClient) SupportsFilter(filter common.FilterExpression) bool {
+	filter = common.PushDownNegations(filter)
+	if containsNegation(filter) {
+		return false
+	}
+	return common.AllFiltersSupported(filter, func(leaf common.FilterExpression) bool {
+		switch f := leaf.(type) {
+		case common.EqualityFilter:
+			_, isNumber := common.ParseNumber(f.Value)
+			return isNumber || !common.IsOrderingOperator(f.Operator)
+		case common.RegexFilter:
+			return !strings.Contains(f.Regexp.String(), "(?")
+		}
+		return true
+	})
+}
+
+func containsNegation(expr common.FilterExpression) bool {
+	switch e := expr.(type) {
+	case common.AndExpression:
+		return anyContainsNegation(e.Operands)
+	case common.OrExpression:
+		return anyContainsNegation(e.Operands)
+	case common.NotExpression:
+		return true
+	default:
+		return false
+	}
+}
+
+func anyContainsNegation(exprs []common.FilterExpression) bool {
+	for _, expr := range exprs {
+		if containsNegation(expr) {
+			return true
+		}
+	}
 	return false
 }
 
-func (client *CloudwatchClient) readLogBatch(ctx context.Context, query common.Query) ([]common.LogMessage, error) {
+// Maximum number of events FilterLogEvents returns per call
+const maxPageSize = 10000
+
+// Pages through the log events matching the query using NextToken, calling emit for every message
+// until query.MaxResults messages were emitted, the events run out, or emit returns false
+func (client *CloudwatchClient) readLogPages(ctx context.Context, query common.Query, emit func(common.LogMessage) bool) error {
 	var startTime, endTime *int64 = nil, nil
 	if query.After != nil {
-		startTimeVal := (*query.After).UnixNano() / int64(time.Millisecond)
-		startTime = &startTimeVal
+		startTime = aws.Int64(timeToMillis(*query.After))
 	}
 	if query.Before != nil {
-		endTimeVal := (*query.Before).UnixNano() / int64(time.Millisecond)
-		endTime = &endTimeVal
-	}
-	resp, err := client.logs.FilterLogEventsWithContext(ctx, &cloudwatchlogs.FilterLogEventsInput{
-		LogGroupName:  aws.String(client.groupName),
-		FilterPattern: aws.String(queryToFilterPattern(query)),
-		Limit:         aws.Int64(int64(query.MaxResults)),
-		StartTime:     startTime,
-		EndTime:       endTime,
-	})
-	if err != nil {
-		return nil, err
+		endTime = aws.Int64(timeToMillis(*query.Before))
 	}
-	messages := make([]common.LogMessage, 0, 20)
-	for _, message := range resp.Events {
-		messages = append(messages, logEventToMessage(query, message))
+	filterPattern := queryToFilterPattern(query)
+	var nextToken *string
+	emitted := 0
+	for emitted < query.MaxResults {
+		limit := query.MaxResults - emitted
+		if limit > maxPageSize {
+			limit = maxPageSize
+		}
+		resp, err := client.logs.FilterLogEventsWithContext(ctx, &cloudwatchlogs.FilterLogEventsInput{
+			LogGroupName:  aws.String(client.groupName),
+			FilterPattern: aws.String(filterPattern),
+			Limit:         aws.Int64(int64(limit)),
+			StartTime:     startTime,
+			EndTime:       endTime,
+			NextToken:     nextToken,
+		})
+		if err != nil {
+			return err
+		}
+		for _, event := range resp.Events {
+			if !emit(logEventToMessage(query, event)) {
+				return nil
+			}
+			emitted++
+			if emitted >= query.MaxResults {
+				return nil
+			}
+		}
+		if resp.NextToken == nil || *resp.NextToken == "" {
+			return nil
+		}
+		nextToken = resp.NextToken
 	}
-	return messages, nil
+	return nil
+}
+
+// FilterLogEvents returns events in ascending order from the start of the time range,
+// so a query returns the oldest query.MaxResults messages
+func (client *CloudwatchClient) OldestFirst() bool {
+	return true
 }
 
 func (client *CloudwatchClient) Query(ctx context.Context, query common.Query) <-chan common.LogMessage {
 	if query.Follow {
-		return common.ReQueryFollow(ctx, func() ([]common.LogMessage, error) {
-			return client.readLogBatch(ctx, query)
-		})
+		return client.tail(ctx, query)
 	}
 	resultChan := make(chan common.LogMessage)
 
 	go func() {
-		messages, err := client.readLogBatch(ctx, query)
-		if err != nil {
+		err := client.readLogPages(ctx, query, func(message common.LogMessage) bool {
+			return common.SendMessage(ctx, resultChan, message)
+		})
+		if err != nil && ctx.Err() == nil {
 			fmt.Printf("Error while fetching logs: %s\n", err)
-			close(resultChan)
-			return
-		}
-		for _, message := range messages {
-			resultChan <- message
 		}
 		close(resultChan)
 	}()
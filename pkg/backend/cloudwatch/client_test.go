@@ -67,3 +67,101 @@ func TestFilterGenerator(t *testing.T) {
 		t.Fatal(output)
 	}
 }
+
+func TestFilterExpressionGenerator(t *testing.T) {
+	expr, err := common.ParseFilterExpression("(level=error OR level=fatal) AND NOT service=healthcheck")
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := queryToFilterPattern(common.Query{
+		EqualityFilters: []common.EqualityFilter{
+			{
+				FieldName: "name",
+				Operator:  "=",
+				Value:     "zef",
+			},
+		},
+		Filter: expr,
+	})
+	if output != `{ ($.name = "zef") && ((($.level = "error") || ($.level = "fatal")) && ($.service != "healthcheck")) }` {
+		t.Fatal(output)
+	}
+}
+
+func TestOrderingFilterGenerator(t *testing.T) {
+	output := queryToFilterPattern(common.Query{
+		EqualityFilters: []common.EqualityFilter{
+			{
+				FieldName: "duration_ms",
+				Operator:  ">",
+				Value:     "500",
+			},
+		},
+	})
+	if output != `{ ($.duration_ms > 500) }` {
+		t.Fatal(output)
+	}
+}
+
+func TestRegexFilterGenerator(t *testing.T) {
+	filter, err := common.NewRegexFilter("path", "^/api/v2/", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := queryToFilterPattern(common.Query{RegexFilters: []common.RegexFilter{filter}})
+	if output != `{ ($.path = %^/api/v2/%) }` {
+		t.Fatal(output)
+	}
+
+	filter, err = common.NewRegexFilter("usage", `^100%|\%$`, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output = queryToFilterPattern(common.Query{RegexFilters: []common.RegexFilter{filter}})
+	if output != `{ ($.usage = %^100\%|\%$%) }` {
+		t.Fatal(output)
+	}
+}
+
+func TestAdvancedFilterGenerator(t *testing.T) {
+	output := queryToFilterPattern(common.Query{
+		ExistenceFilters: []common.ExistenceFilter{
+			{FieldName: "domain", Exists: true},
+			{FieldName: "traceback", Exists: false},
+		},
+		MembershipFilters: []common.MembershipFilter{
+			{FieldName: "level", ValidValues: []string{"error", "fatal"}, InvalidValues: []string{"warn", "info"}},
+		},
+	})
+	if output != `{ ($.domain = "*") && ($.traceback NOT EXISTS) && (($.level = "error") || ($.level = "fatal")) && ($.level != "warn") && ($.level != "info") }` {
+		t.Fatal(output)
+	}
+}
+
+func TestSupportsFilter(t *testing.T) {
+	client := &CloudwatchClient{}
+	supported := []string{
+		"level=error",
+		"status>=500 AND NOT (level=error OR level=fatal)",
+		"path~^/api/",
+	}
+	unsupported := []string{
+		"version>v2",
+		"NOT version<=v2",
+		"NOT duration_ms>500",
+		"NOT (status>=500 OR level=error)",
+		`path~"(?i)^/api/"`,
+	}
+	for _, input := range supported {
+		expr, _ := common.ParseFilterExpression(input)
+		if !client.SupportsFilter(expr) {
+			t.Errorf("Expected %s to be supported", input)
+		}
+	}
+	for _, input := range unsupported {
+		expr, _ := common.ParseFilterExpression(input)
+		if client.SupportsFilter(expr) {
+			t.Errorf("Expected %s not to be supported", input)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package cloudwatch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/egnyte/ax/pkg/backend/common"
+)
+
+const (
+	// How long it can take CloudWatch to update the lastEventTimestamp of a log stream,
+	// which log streams are ordered by ("typically less than an hour" according to the docs)
+	streamActivityLag = time.Hour
+	// How often to list the log streams to find the active ones, as DescribeLogStreams is throttled
+	// at a few requests per second per account, and paging through many streams takes many requests
+	streamListInterval = time.Minute
+	// Maximum number of log stream names FilterLogEvents accepts at once
+	maxStreamsPerFilter = 100
+)
+
+// Where we are in a log stream while tailing
+type streamPosition struct {
+	timestamp      int64           // Timestamp of the most recent event seen
+	idsAtTimestamp map[string]bool // IDs of the events seen with that timestamp, as more may still arrive
+	lastIngestion  int64           // Ingestion time of the stream when we last fetched its events
+}
+
+// Tails a log group by tracking a position per log stream. The log streams are listed every
+// streamListInterval, to find the streams that ingested something since they were last listed. Until
+// the next listing, every poll requests events from those streams, starting at their position.
+// Positions of streams that didn't ingest anything for streamActivityLag are forgotten.
+type tailer struct {
+	client     *CloudwatchClient
+	query      common.Query
+	start      int64 // When tailing started, streams we haven't seen before start a little earlier
+	overlap    int64 // How late events may arrive in streams we haven't seen before
+	positions  map[string]*streamPosition
+	backlogIDs map[string]bool  // IDs of the events before start that were emitted already
+	active     map[string]int64 // Streams that were active when last listed, with their ingestion time
+	listed     time.Time
+	evicted    int64 // Streams we haven't seen (or forgot) start no earlier than this, so forgotten ones aren't repeated
+}
+
+func newTailer(client *CloudwatchClient, query common.Query, start time.Time) *tailer {
+	overlap := query.FollowOverlap
+	if overlap == 0 {
+		overlap = common.FollowOverlapTime
+	}
+	return &tailer{
+		client:     client,
+		query:      query,
+		start:      timeToMillis(start),
+		overlap:    int64(overlap / time.Millisecond),
+		positions:  make(map[string]*streamPosition),
+		backlogIDs: make(map[string]bool),
+	}
+}
+
+// Remembers an event emitted before tailing started, if a stream we haven't seen before may still return it
+func (t *tailer) addBacklog(message common.LogMessage) {
+	if timeToMillis(message.Timestamp) >= t.start-t.overlap {
+		t.backlogIDs[message.ID] = true
+	}
+}
+
+func (t *tailer) position(streamName string) *streamPosition {
+	pos, ok := t.positions[streamName]
+	if !ok {
+		timestamp := t.start - t.overlap
+		if t.evicted > timestamp {
+			timestamp = t.evicted
+		}
+		pos = &streamPosition{
+			timestamp:      timestamp,
+			idsAtTimestamp: make(map[string]bool),
+		}
+		t.positions[streamName] = pos
+	}
+	return pos
+}
+
+// Forgets the positions of the streams that didn't ingest events for streamActivityLag,
+// as they are no longer listed. Should they ingest events again, they start after the
+// most recent event of any stream forgotten.
+func (t *tailer) evictInactive(now time.Time) {
+	oldestActivity := timeToMillis(now.Add(-streamActivityLag))
+	for name, pos := range t.positions {
+		if _, ok := t.active[name]; ok || pos.lastIngestion >= oldestActivity {
+			continue
+		}
+		if pos.timestamp >= t.evicted {
+			t.evicted = pos.timestamp + 1
+		}
+		delete(t.positions, name)
+	}
+}
+
+// Returns the names of the log streams that ingested events since we last fetched from them,
+// with their current ingestion time
+func (t *tailer) activeStreams(ctx context.Context, now time.Time) (map[string]int64, error) {
+	oldestActivity := timeToMillis(now.Add(-streamActivityLag))
+	active := make(map[string]int64)
+	var nextToken *string
+	for {
+		resp, err := t.client.logs.DescribeLogStreamsWithContext(ctx, &cloudwatchlogs.DescribeLogStreamsInput{
+			LogGroupName: aws.String(t.client.groupName),
+			OrderBy:      aws.String(cloudwatchlogs.OrderByLastEventTime),
+			Descending:   aws.Bool(true),
+			NextToken:    nextToken,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, stream := range resp.LogStreams {
+			if aws.Int64Value(stream.LastEventTimestamp) < oldestActivity {
+				// Streams are ordered by last event, so all remaining streams are inactive
+				return active, nil
+			}
+			name := aws.StringValue(stream.LogStreamName)
+			ingestion := aws.Int64Value(stream.LastIngestionTime)
+			lastIngestion := t.start
+			if pos, ok := t.positions[name]; ok {
+				lastIngestion = pos.lastIngestion
+			}
+			if ingestion > lastIngestion {
+				active[name] = ingestion
+			}
+		}
+		if resp.NextToken == nil || *resp.NextToken == "" {
+			return active, nil
+		}
+		nextToken = resp.NextToken
+	}
+}
+
+// Fetches the events after their stream's position from a batch of streams
+func (t *tailer) fetch(ctx context.Context, streamNames []string, emit func(common.LogMessage) bool) error {
+	startTime := t.position(streamNames[0]).timestamp
+	for _, name := range streamNames {
+		if pos := t.position(name); pos.timestamp < startTime {
+			startTime = pos.timestamp
+		}
+	}
+	filterPattern := queryToFilterPattern(t.query)
+	var nextToken *string
+	for {
+		resp, err := t.client.logs.FilterLogEventsWithContext(ctx, &cloudwatchlogs.FilterLogEventsInput{
+			LogGroupName:   aws.String(t.client.groupName),
+			LogStreamNames: aws.StringSlice(streamNames),
+			FilterPattern:  aws.String(filterPattern),
+			StartTime:      aws.Int64(startTime),
+			NextToken:      nextToken,
+		})
+		if err != nil {
+			return err
+		}
+		for _, event := range resp.Events {
+			pos := t.position(aws.StringValue(event.LogStreamName))
+			ts, id := aws.Int64Value(event.Timestamp), aws.StringValue(event.EventId)
+			if ts < pos.timestamp || (ts == pos.timestamp && pos.idsAtTimestamp[id]) || t.backlogIDs[id] {
+				continue
+			}
+			if ts > pos.timestamp {
+				pos.timestamp = ts
+				pos.idsAtTimestamp = make(map[string]bool)
+			}
+			pos.idsAtTimestamp[id] = true
+			if !emit(logEventToMessage(t.query, event)) {
+				return nil
+			}
+		}
+		if resp.NextToken == nil || *resp.NextToken == "" {
+			return nil
+		}
+		nextToken = resp.NextToken
+	}
+}
+
+// Fetches and emits all events that arrived in active streams since the previous poll,
+// listing the log streams again if they were listed more than streamListInterval ago
+func (t *tailer) poll(ctx context.Context, now time.Time, emit func(common.LogMessage) bool) error {
+	if t.active == nil || now.Sub(t.listed) >= streamListInterval {
+		active, err := t.activeStreams(ctx, now)
+		if err != nil {
+			return err
+		}
+		t.active, t.listed = active, now
+		t.evictInactive(now)
+	}
+	streamNames := make([]string, 0, len(t.active))
+	for name := range t.active {
+		streamNames = append(streamNames, name)
+	}
+	for len(streamNames) > 0 {
+		batch := streamNames
+		if len(batch) > maxStreamsPerFilter {
+			batch = batch[:maxStreamsPerFilter]
+		}
+		streamNames = streamNames[len(batch):]
+		if err := t.fetch(ctx, batch, emit); err != nil {
+			return err
+		}
+		// Only move on once the events were fetched, so failed fetches are retried
+		for _, name := range batch {
+			t.position(name).lastIngestion = t.active[name]
+		}
+	}
+	return nil
+}
+
+// Implements "follow" mode for CloudWatch: first emits the messages matching the query up until now,
+// then polls for events in log streams that ingested new events, starting from where we were in each stream.
+// Events that arrive in a stream with a timestamp before one seen already are skipped, as are events
+// arriving more than query.FollowOverlap late in streams that didn't have any events yet.
+func (client *CloudwatchClient) tail(ctx context.Context, query common.Query) <-chan common.LogMessage {
+	pollInterval := query.PollInterval
+	if pollInterval == 0 {
+		pollInterval = common.FollowPollTime
+	}
+	resultChan := make(chan common.LogMessage)
+	emit := func(message common.LogMessage) bool {
+		return common.SendMessage(ctx, resultChan, message)
+	}
+	go func() {
+		defer close(resultChan)
+		start := time.Now()
+		t := newTailer(client, query, start)
+		backlogQuery := query
+		backlogEnd := start.Add(-time.Millisecond)
+		if backlogQuery.Before == nil || backlogQuery.Before.After(backlogEnd) {
+			backlogQuery.Before = &backlogEnd
+		}
+		err := client.readLogPages(ctx, backlogQuery, func(message common.LogMessage) bool {
+			t.addBacklog(message)
+			return emit(message)
+		})
+		if err != nil && ctx.Err() == nil {
+			fmt.Printf("Error while fetching logs: %s\n", err)
+		}
+		retries := 0
+		for {
+			select {
+			case <-time.After(pollInterval):
+			case <-ctx.Done():
+				return
+			}
+			err := t.poll(ctx, time.Now(), emit)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				retries++
+				if retries >= common.ConnectionRetries {
+					fmt.Fprintf(os.Stderr, "Could not connect: %v\nExceeded total number of retries, exiting.\n", err)
+					return
+				}
+				fmt.Fprintf(os.Stderr, "Could not connect: %v retrying in %s\n", err, pollInterval)
+				continue
+			}
+			retries = 0
+		}
+	}()
+	return resultChan
+}
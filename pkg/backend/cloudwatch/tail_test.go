@@ -0,0 +1,242 @@
+package cloudwatch
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+	"github.com/egnyte/ax/pkg/backend/common"
+)
+
+type fakeEvent struct {
+	id        string
+	timestamp int64
+	ingestion int64
+}
+
+// A local fake of the parts of the CloudWatch Logs API used for tailing,
+// log streams and events are paged through two at a time
+type fakeLogs struct {
+	cloudwatchlogsiface.CloudWatchLogsAPI
+	mutex         sync.Mutex
+	streams       map[string][]fakeEvent
+	filterStreams [][]string
+	describes     int
+}
+
+func (f *fakeLogs) ingest(stream, id string, timestamp, ingestion int64) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.streams[stream] = append(f.streams[stream], fakeEvent{id: id, timestamp: timestamp, ingestion: ingestion})
+}
+
+func pageToken(offset, total int) *string {
+	if offset+2 >= total {
+		return nil
+	}
+	return aws.String(strconv.Itoa(offset + 2))
+}
+
+func (f *fakeLogs) DescribeLogStreamsWithContext(ctx aws.Context, in *cloudwatchlogs.DescribeLogStreamsInput, opts ...request.Option) (*cloudwatchlogs.DescribeLogStreamsOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if in.NextToken == nil {
+		f.describes++
+	}
+	streams := make([]*cloudwatchlogs.LogStream, 0, len(f.streams))
+	for name, events := range f.streams {
+		stream := &cloudwatchlogs.LogStream{LogStreamName: aws.String(name)}
+		for _, event := range events {
+			if event.timestamp > aws.Int64Value(stream.LastEventTimestamp) {
+				stream.LastEventTimestamp = aws.Int64(event.timestamp)
+			}
+			if event.ingestion > aws.Int64Value(stream.LastIngestionTime) {
+				stream.LastIngestionTime = aws.Int64(event.ingestion)
+			}
+		}
+		streams = append(streams, stream)
+	}
+	sort.Slice(streams, func(i, j int) bool {
+		return *streams[i].LastEventTimestamp > *streams[j].LastEventTimestamp
+	})
+	offset, _ := strconv.Atoi(aws.StringValue(in.NextToken))
+	end := offset + 2
+	if end > len(streams) {
+		end = len(streams)
+	}
+	return &cloudwatchlogs.DescribeLogStreamsOutput{
+		LogStreams: streams[offset:end],
+		NextToken:  pageToken(offset, len(streams)),
+	}, nil
+}
+
+func (f *fakeLogs) FilterLogEventsWithContext(ctx aws.Context, in *cloudwatchlogs.FilterLogEventsInput, opts ...request.Option) (*cloudwatchlogs.FilterLogEventsOutput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if in.NextToken == nil {
+		streamNames := make([]string, 0, len(in.LogStreamNames))
+		for _, name := range in.LogStreamNames {
+			streamNames = append(streamNames, *name)
+		}
+		sort.Strings(streamNames)
+		f.filterStreams = append(f.filterStreams, streamNames)
+	}
+	streamNames := in.LogStreamNames
+	if len(streamNames) == 0 {
+		for name := range f.streams {
+			streamNames = append(streamNames, aws.String(name))
+		}
+	}
+	events := make([]*cloudwatchlogs.FilteredLogEvent, 0)
+	for _, name := range streamNames {
+		for _, event := range f.streams[*name] {
+			if event.timestamp < aws.Int64Value(in.StartTime) || (in.EndTime != nil && event.timestamp > *in.EndTime) {
+				continue
+			}
+			events = append(events, &cloudwatchlogs.FilteredLogEvent{
+				EventId:       aws.String(event.id),
+				LogStreamName: name,
+				Timestamp:     aws.Int64(event.timestamp),
+				Message:       aws.String(fmt.Sprintf(`{"message": "Event %s"}`, event.id)),
+			})
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return *events[i].Timestamp < *events[j].Timestamp
+	})
+	offset, _ := strconv.Atoi(aws.StringValue(in.NextToken))
+	end := offset + 2
+	if end > len(events) {
+		end = len(events)
+	}
+	return &cloudwatchlogs.FilterLogEventsOutput{
+		Events:    events[offset:end],
+		NextToken: pageToken(offset, len(events)),
+	}, nil
+}
+
+func TestTailerPoll(t *testing.T) {
+	start := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	ms := func(offset time.Duration) int64 {
+		return timeToMillis(start.Add(offset))
+	}
+	logs := &fakeLogs{streams: make(map[string][]fakeEvent)}
+	logs.ingest("old", "old-1", ms(-2*time.Hour), ms(-2*time.Hour))
+	logs.ingest("a", "a-1", ms(-time.Minute), ms(-time.Minute))
+	client := &CloudwatchClient{logs: logs, groupName: "group"}
+	tailer := newTailer(client, common.Query{}, start)
+
+	poll := func(now time.Duration) string {
+		ids := ""
+		err := tailer.poll(context.Background(), start.Add(now), func(message common.LogMessage) bool {
+			ids += message.ID + " "
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ids
+	}
+
+	if ids := poll(time.Second); ids != "" {
+		t.Errorf("Expected no events before tailing started, got %s", ids)
+	}
+	logs.ingest("a", "a-2", ms(time.Second), ms(2*time.Second))
+	logs.ingest("b", "b-1", ms(2*time.Second), ms(2*time.Second))
+	logs.ingest("b", "b-2", ms(2*time.Second), ms(2*time.Second))
+	logs.ingest("c", "c-1", ms(3*time.Second), ms(3*time.Second))
+	// New streams start a little before tailing started, for events that arrive late
+	logs.ingest("d", "d-1", ms(-10*time.Second), ms(4*time.Second))
+	logs.ingest("d", "d-2", ms(-time.Minute), ms(4*time.Second))
+	if ids := poll(5 * time.Second); ids != "" || logs.describes != 1 {
+		t.Errorf("Expected no events until the streams are listed again, got %s and %d listings", ids, logs.describes)
+	}
+	if ids := poll(time.Minute + time.Second); ids != "d-1 a-2 b-1 b-2 c-1 " || logs.describes != 2 {
+		t.Errorf("Unexpected events: %s", ids)
+	}
+	// Another event with the same timestamp as the last one in b arrives, and one in a late
+	logs.ingest("b", "b-3", ms(2*time.Second), ms(time.Minute+6*time.Second))
+	logs.ingest("a", "a-3", ms(-time.Second), ms(time.Minute+6*time.Second))
+	logs.filterStreams = nil
+	if ids := poll(time.Minute + 10*time.Second); ids != "b-3 " || logs.describes != 2 {
+		t.Errorf("Unexpected events: %s", ids)
+	}
+	if fmt.Sprint(logs.filterStreams) != "[[a b c d]]" {
+		t.Errorf("Expected the streams active when listed to be fetched, got %v", logs.filterStreams)
+	}
+	logs.filterStreams = nil
+	if ids := poll(2*time.Minute + 2*time.Second); ids != "" || fmt.Sprint(logs.filterStreams) != "[[a b]]" {
+		t.Errorf("Expected only streams a and b to be fetched after listing, got %s and %v", ids, logs.filterStreams)
+	}
+	logs.filterStreams = nil
+	if ids := poll(3*time.Minute + 3*time.Second); ids != "" || len(logs.filterStreams) != 0 {
+		t.Errorf("Expected no fetches without new events, got %s and %v", ids, logs.filterStreams)
+	}
+}
+
+func TestTailerEviction(t *testing.T) {
+	start := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	ms := func(offset time.Duration) int64 {
+		return timeToMillis(start.Add(offset))
+	}
+	logs := &fakeLogs{streams: make(map[string][]fakeEvent)}
+	logs.ingest("a", "a-1", ms(-time.Minute), ms(-time.Minute))
+	client := &CloudwatchClient{logs: logs, groupName: "group"}
+	tailer := newTailer(client, common.Query{}, start)
+
+	poll := func(now time.Duration) string {
+		ids := ""
+		err := tailer.poll(context.Background(), start.Add(now), func(message common.LogMessage) bool {
+			ids += message.ID + " "
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ids
+	}
+
+	poll(time.Second)
+	logs.ingest("a", "a-2", ms(time.Second), ms(2*time.Second))
+	if ids := poll(time.Minute + time.Second); ids != "a-2 " || len(tailer.positions) != 1 {
+		t.Errorf("Expected a-2 and a position for stream a, got %s and %d positions", ids, len(tailer.positions))
+	}
+	if ids := poll(2 * time.Hour); ids != "" || len(tailer.positions) != 0 {
+		t.Errorf("Expected the position of the inactive stream to be forgotten, got %s and %d positions", ids, len(tailer.positions))
+	}
+	// The forgotten stream ingests again, without repeating a-2 that is still within the follow overlap of start
+	logs.ingest("a", "a-3", ms(2*time.Hour+time.Second), ms(2*time.Hour+time.Second))
+	if ids := poll(2*time.Hour + time.Minute + time.Second); ids != "a-3 " {
+		t.Errorf("Expected only the new event, got %s", ids)
+	}
+}
+
+func TestTailFollow(t *testing.T) {
+	now := timeToMillis(time.Now())
+	logs := &fakeLogs{streams: make(map[string][]fakeEvent)}
+	// Ingested late enough for the stream to be active when tailing starts, so polling fetches a-1
+	// again (it's within the follow overlap), after the backlog emitted it already
+	logs.ingest("a", "a-1", now-1000, now+1000)
+	client := &CloudwatchClient{logs: logs, groupName: "group"}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	results := client.Query(ctx, common.Query{Follow: true, MaxResults: 10, PollInterval: time.Millisecond})
+	if message := <-results; message.ID != "a-1" || message.Attributes["message"] != "Event a-1" {
+		t.Errorf("Expected the existing event first, got %+v", message)
+	}
+	logs.ingest("a", "a-2", now+60000, now+60000)
+	if message := <-results; message.ID != "a-2" {
+		t.Errorf("Expected the new event, got %+v", message)
+	}
+	cancel()
+	for range results {
+	}
+}
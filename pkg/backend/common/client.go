@@ -6,7 +6,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"os"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -14,12 +15,17 @@ import (
 const (
 	TimeFormat        = time.RFC3339
 	FollowPollTime    = 5 * time.Second
+	FollowOverlapTime = 30 * time.Second
 	ConnectionRetries = 10
 )
 
 type Client interface {
+	// Query returns up to query.MaxResults messages in ascending order, the most recent ones within
+	// [query.After, query.Before] unless the client is an OldestFirstClient
 	Query(ctx context.Context, query Query) <-chan LogMessage
-	ImplementsAdvancedFilters() bool
+	// SupportsFilter indicates whether the backend can evaluate the filter (or filter expression) natively,
+	// filters that aren't supported are evaluated client-side by QueryWithFallback
+	SupportsFilter(filter FilterExpression) bool
 }
 
 type EqualityFilter struct {
@@ -39,6 +45,12 @@ type MembershipFilter struct {
 	InvalidValues []string
 }
 
+type RegexFilter struct {
+	FieldName string
+	Regexp    *regexp.Regexp
+	Negated   bool // true if the field value should *not* match Regexp
+}
+
 type Query struct {
 	QueryString       string
 	After             *time.Time
@@ -47,23 +59,32 @@ type Query struct {
 	EqualityFilters   []EqualityFilter
 	ExistenceFilters  []ExistenceFilter
 	MembershipFilters []MembershipFilter
+	RegexFilters      []RegexFilter
+	Filter            FilterExpression
 	MaxResults        int
 	Unique            bool
 	Follow            bool
+	PollInterval      time.Duration // Time between polls in follow mode, defaults to FollowPollTime
+	FollowOverlap     time.Duration // How late messages may arrive in follow mode, defaults to FollowOverlapTime
 }
 
 type QuerySelectors struct {
-	Last        string   `yaml:"last,omitempty"`
-	Before      string   `yaml:"before,omitempty"`
-	After       string   `yaml:"after,omitempty"`
-	Select      []string `yaml:"select,omitempty"`
-	Where       []string `yaml:"where,omitempty"`
-	OneOf       []string `yaml:"one_of,omitempty"`
-	NotOneOf    []string `yaml:"not_one_of,omitempty"`
-	Exists      []string `yaml:"exists,omitempty"`
-	NotExists   []string `yaml:"not_exists,omitempty"`
-	Unique      bool     `yaml:"unique,omitempty"`
-	QueryString []string `yaml:"query,omitempty"`
+	Last          string   `yaml:"last,omitempty"`
+	Before        string   `yaml:"before,omitempty"`
+	After         string   `yaml:"after,omitempty"`
+	Select        []string `yaml:"select,omitempty"`
+	Where         []string `yaml:"where,omitempty"`
+	OneOf         []string `yaml:"one_of,omitempty"`
+	NotOneOf      []string `yaml:"not_one_of,omitempty"`
+	Matches       []string `yaml:"matches,omitempty"`
+	NotMatches    []string `yaml:"not_matches,omitempty"`
+	Exists        []string `yaml:"exists,omitempty"`
+	NotExists     []string `yaml:"not_exists,omitempty"`
+	Filter        []string `yaml:"filter,omitempty"`
+	Unique        bool     `yaml:"unique,omitempty"`
+	PollInterval  string   `yaml:"poll_interval,omitempty"`
+	FollowOverlap string   `yaml:"follow_overlap,omitempty"`
+	QueryString   []string `yaml:"query,omitempty"`
 }
 
 type LogMessage struct {
@@ -167,12 +188,77 @@ func (f EqualityFilter) Matches(m LogMessage) bool {
 		return ok && f.Value == fmt.Sprintf("%v", val)
 	case "!=":
 		return !ok || (ok && f.Value != fmt.Sprintf("%v", val))
+	case ">", ">=", "<", "<=":
+		if !ok || val == nil {
+			return false
+		}
+		cmp := compareValues(val, f.Value)
+		switch f.Operator {
+		case ">":
+			return cmp > 0
+		case ">=":
+			return cmp >= 0
+		case "<":
+			return cmp < 0
+		default:
+			return cmp <= 0
+		}
 	default:
 		fmt.Printf("Not supported operatior: %s\n", f.Operator)
 		return false
 	}
 }
 
+// IsOrderingOperator indicates whether the operator is one of >, >=, < and <=
+func IsOrderingOperator(operator string) bool {
+	switch operator {
+	case ">", ">=", "<", "<=":
+		return true
+	}
+	return false
+}
+
+// ParseNumber attempts to interpret an attribute value (or a filter value) as a number
+func ParseNumber(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// Compares an attribute value to a filter value, numerically if both are numbers,
+// lexicographically otherwise. Returns -1, 0 or 1 like strings.Compare.
+func compareValues(val interface{}, filterValue string) int {
+	if a, ok := ParseNumber(val); ok {
+		if b, ok := ParseNumber(filterValue); ok {
+			switch {
+			case a < b:
+				return -1
+			case a > b:
+				return 1
+			default:
+				return 0
+			}
+		}
+	}
+	return strings.Compare(fmt.Sprintf("%v", val), filterValue)
+}
+
 // Matches indicates whether the existence filter matches the log message
 func (f ExistenceFilter) Matches(m LogMessage) bool {
 	_, ok := m.Attributes[f.FieldName]
@@ -201,6 +287,119 @@ func (f MembershipFilter) Matches(m LogMessage) bool {
 	return (len(f.ValidValues) == 0 || isStringInSlice(valueAsString, f.ValidValues)) && (len(f.InvalidValues) == 0 || !isStringInSlice(valueAsString, f.InvalidValues))
 }
 
+func NewRegexFilter(fieldName, pattern string, negated bool) (RegexFilter, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return RegexFilter{}, err
+	}
+	return RegexFilter{
+		FieldName: fieldName,
+		Regexp:    re,
+		Negated:   negated,
+	}, nil
+}
+
+// Matches indicates whether the log message's field value matches the regular expression
+// (or doesn't, if negated). Messages without the field only match negated filters.
+func (f RegexFilter) Matches(m LogMessage) bool {
+	val, ok := m.Attributes[f.FieldName]
+	if !ok || val == nil {
+		return f.Negated
+	}
+	return f.Regexp.MatchString(fmt.Sprintf("%v", val)) != f.Negated
+}
+
+// AnchoredPattern translates a regular expression with Go's "find anywhere" semantics for backends
+// whose regular expressions always have to match the whole value, by padding every top-level
+// alternative with .* unless it is explicitly anchored. A leading (?i) flag is split off, as
+// backends support it differently.
+func AnchoredPattern(re *regexp.Regexp) (pattern string, caseInsensitive bool) {
+	pattern = re.String()
+	if strings.HasPrefix(pattern, "(?i)") {
+		caseInsensitive = true
+		pattern = strings.TrimPrefix(pattern, "(?i)")
+	}
+	alternatives := splitAlternatives(pattern)
+	for i, alternative := range alternatives {
+		if strings.HasPrefix(alternative, "^") {
+			alternative = alternative[1:]
+		} else {
+			alternative = ".*" + alternative
+		}
+		if isEndAnchored(alternative) {
+			alternative = alternative[:len(alternative)-1]
+		} else {
+			alternative = alternative + ".*"
+		}
+		alternatives[i] = alternative
+	}
+	if len(alternatives) == 1 {
+		return alternatives[0], caseInsensitive
+	}
+	return "(" + strings.Join(alternatives, "|") + ")", caseInsensitive
+}
+
+// Splits a regular expression on the | operators that aren't within a group or character class
+func splitAlternatives(pattern string) []string {
+	alternatives := make([]string, 0, 1)
+	depth, start := 0, 0
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '[':
+			i = classEnd(pattern, i)
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case '|':
+			if depth == 0 {
+				alternatives = append(alternatives, pattern[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(alternatives, pattern[start:])
+}
+
+// Returns the index of the ] closing the character class that starts at pattern[start]
+func classEnd(pattern string, start int) int {
+	i := start + 1
+	if i < len(pattern) && pattern[i] == '^' {
+		i++
+	}
+	// A ] right at the start of a class is a literal
+	if i < len(pattern) && pattern[i] == ']' {
+		i++
+	}
+	for ; i < len(pattern); i++ {
+		switch {
+		case pattern[i] == '\\':
+			i++
+		case strings.HasPrefix(pattern[i:], "[:"):
+			if end := strings.Index(pattern[i+2:], ":]"); end >= 0 {
+				i += end + 3
+			}
+		case pattern[i] == ']':
+			return i
+		}
+	}
+	return i
+}
+
+// Indicates whether the pattern ends with a $ that isn't escaped
+func isEndAnchored(pattern string) bool {
+	if !strings.HasSuffix(pattern, "$") {
+		return false
+	}
+	backslashes := 0
+	for i := len(pattern) - 2; i >= 0 && pattern[i] == '\\'; i-- {
+		backslashes++
+	}
+	return backslashes%2 == 0
+}
+
 func matchesPhrase(s, phrase string) bool {
 	return strings.Contains(strings.ToLower(s), strings.ToLower(phrase))
 }
@@ -242,67 +441,26 @@ func MatchesQuery(m LogMessage, q Query) bool {
 			return false
 		}
 	}
+	for _, f := range q.RegexFilters {
+		if !f.Matches(m) {
+			return false
+		}
+	}
+	if q.Filter != nil && !q.Filter.Matches(m) {
+		return false
+	}
 	return matchFound
 }
 
-// This is a simplistic way to implement log "following" (tailing) in a generic way.
-// The idea is to simply execute the fetch log query (implemented by `queryMessagesFunc`) over and over, every `FollowPollTime` seconds,
-// and push the results through the deduplicating result channel returned (deduplication happens based on message ID)
-// This may seem overly inefficient, but due to the eventual-consistency type behavior of many log aggregation systems, logs may not actually
-// arrive in sequence, so requesting new logs based on timestamps won't work reliably.
-func ReQueryFollow(ctx context.Context, queryMessagesFunc func() ([]LogMessage, error)) <-chan LogMessage {
-	resultChan := make(chan LogMessage)
-	go func() {
-		retries := 0
-		for {
-			select {
-			case <-ctx.Done():
-				close(resultChan)
-				return
-			default:
-			}
-			allMessages, err := queryMessagesFunc()
-			select {
-			case <-ctx.Done():
-				close(resultChan)
-				return
-			default:
-			}
-			if err != nil {
-				fmt.Println(err)
-				retries++
-				select {
-				case <-ctx.Done():
-					close(resultChan)
-					return
-				default:
-				}
-				if retries < ConnectionRetries {
-					fmt.Fprintf(os.Stderr, "Could not connect: %v retrying in 5s\n", err)
-					if canceableSleep(ctx, FollowPollTime) {
-						// Canceled
-						close(resultChan)
-						return
-					}
-					continue
-				} else {
-					fmt.Fprintf(os.Stderr, "Could not connect: %v\nExceeded total number of retries, exiting.\n", err)
-					close(resultChan)
-					return
-				}
-			}
-			// Request succesful, so reset retry count
-			retries = 0
-			for _, message := range allMessages {
-				resultChan <- message
-			}
-			if canceableSleep(ctx, FollowPollTime) {
-				close(resultChan)
-				return
-			}
-		}
-	}()
-	return Dedup(resultChan)
+// SendMessage sends a message to resultChan, unless the context is canceled first.
+// Returns false if the context was canceled, in which case the caller should stop sending.
+func SendMessage(ctx context.Context, resultChan chan<- LogMessage, message LogMessage) bool {
+	select {
+	case resultChan <- message:
+		return true
+	case <-ctx.Done():
+		return false
+	}
 }
 
 // Returns if canceled
@@ -314,3 +472,9 @@ func canceableSleep(ctx context.Context, duration time.Duration) bool {
 		return true
 	}
 }
+
+// FieldLister is implemented by clients that know the fields of their messages up front,
+// e.g. from a mapping, returning their types by field name
+type FieldLister interface {
+	ListFields() (map[string]string, error)
+}
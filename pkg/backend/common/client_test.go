@@ -1,6 +1,7 @@
 package common
 
 import (
+	"regexp"
 	"testing"
 	"time"
 )
@@ -51,6 +52,20 @@ func TestFilter(t *testing.T) {
 				{FieldName: "someNonexistingField", Value: "Pete", Operator: "!="},
 			},
 		},
+		{
+			EqualityFilters: []EqualityFilter{
+				{FieldName: "someN", Value: "4", Operator: ">"},
+				{FieldName: "someN", Value: "34", Operator: ">="},
+				{FieldName: "someN", Value: "100", Operator: "<"},
+				{FieldName: "someN", Value: "34.0", Operator: "<="},
+			},
+		},
+		{
+			EqualityFilters: []EqualityFilter{
+				{FieldName: "someStr", Value: "Aap", Operator: ">"},
+				{FieldName: "someStr", Value: "a", Operator: "<"},
+			},
+		},
 		{
 			ExistenceFilters: []ExistenceFilter{
 				{
@@ -127,6 +142,21 @@ func TestFilter(t *testing.T) {
 		{
 			After: &nextHour,
 		},
+		{
+			EqualityFilters: []EqualityFilter{
+				{FieldName: "someN", Value: "100", Operator: ">"},
+			},
+		},
+		{
+			EqualityFilters: []EqualityFilter{
+				{FieldName: "someN", Value: "34", Operator: "<"},
+			},
+		},
+		{
+			EqualityFilters: []EqualityFilter{
+				{FieldName: "someNonexistingField", Value: "0", Operator: ">="},
+			},
+		},
 		{
 			ExistenceFilters: []ExistenceFilter{
 				{
@@ -269,3 +299,70 @@ func TestMembershipFilter_Matches(t *testing.T) {
 		})
 	}
 }
+
+func TestRegexFilter_Matches(t *testing.T) {
+	lm := LogMessage{
+		Attributes: map[string]interface{}{
+			"path":       "/api/v2/users",
+			"user_agent": "GoogleBot/2.1",
+			"status":     404,
+		},
+	}
+	tests := []struct {
+		fieldName string
+		pattern   string
+		negated   bool
+		want      bool
+	}{
+		{"path", "^/api/v2/", false, true},
+		{"path", "^/api/v1/", false, false},
+		{"path", "^/api/v1/", true, true},
+		{"user_agent", "(?i)bot", false, true},
+		{"user_agent", "bot", false, false},
+		{"status", "^4\\d\\d$", false, true},
+		{"missing", ".*", false, false},
+		{"missing", ".*", true, true},
+	}
+	for _, tt := range tests {
+		f, err := NewRegexFilter(tt.fieldName, tt.pattern, tt.negated)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := f.Matches(lm); got != tt.want {
+			t.Errorf("RegexFilter{%s~%s, negated: %v}.Matches() = %v, want %v", tt.fieldName, tt.pattern, tt.negated, got, tt.want)
+		}
+		if got := MatchesQuery(lm, Query{RegexFilters: []RegexFilter{f}}); got != tt.want {
+			t.Errorf("MatchesQuery(%s~%s, negated: %v) = %v, want %v", tt.fieldName, tt.pattern, tt.negated, got, tt.want)
+		}
+	}
+	if _, err := NewRegexFilter("path", "(", false); err == nil {
+		t.Error("Expected invalid regular expression error")
+	}
+}
+
+func TestAnchoredPattern(t *testing.T) {
+	tests := []struct {
+		pattern         string
+		expected        string
+		caseInsensitive bool
+	}{
+		{"^/api/v2/", "/api/v2/.*", false},
+		{"users$", ".*users", false},
+		{"^4\\d\\d$", "4\\d\\d", false},
+		{"cost\\$", ".*cost\\$.*", false},
+		{"path\\\\$", ".*path\\\\", false},
+		{"(?i)bot", ".*bot.*", true},
+		{"a|b", "(.*a.*|.*b.*)", false},
+		{"^a|b$", "(a.*|.*b)", false},
+		{"^(a|b)$", "(a|b)", false},
+		{"[|]x|\\|y", "(.*[|]x.*|.*\\|y.*)", false},
+		{"[]|]|[[:alpha:]|]", "(.*[]|].*|.*[[:alpha:]|].*)", false},
+	}
+	for _, tt := range tests {
+		re := regexp.MustCompile(tt.pattern)
+		pattern, caseInsensitive := AnchoredPattern(re)
+		if pattern != tt.expected || caseInsensitive != tt.caseInsensitive {
+			t.Errorf("AnchoredPattern(%s) = %s, %v, want %s, %v", tt.pattern, pattern, caseInsensitive, tt.expected, tt.caseInsensitive)
+		}
+	}
+}
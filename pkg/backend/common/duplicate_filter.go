@@ -1,17 +1,34 @@
 package common
 
-// Skips duplicate messages (based on .ID)
-func Dedup(messageChan chan LogMessage) chan LogMessage {
-	resultChan := make(chan LogMessage)
-	idCache := make(map[string]bool)
-	go func() {
-		for message := range messageChan {
-			if !idCache[message.ID] {
-				resultChan <- message
-				idCache[message.ID] = true
-			}
+import "time"
+
+// Keeps track of the IDs of recently seen messages, to skip duplicates when the same messages
+// are received repeatedly (e.g. from overlapping follow queries). IDs of messages older than
+// a given time can be forgotten, so that memory use doesn't grow indefinitely.
+type recentMessages struct {
+	seen map[string]time.Time
+}
+
+func newRecentMessages() *recentMessages {
+	return &recentMessages{
+		seen: make(map[string]time.Time),
+	}
+}
+
+// Returns true if the message wasn't seen before, and remembers it
+func (r *recentMessages) add(message LogMessage) bool {
+	if _, ok := r.seen[message.ID]; ok {
+		return false
+	}
+	r.seen[message.ID] = message.Timestamp
+	return true
+}
+
+// Forgets all messages older than t
+func (r *recentMessages) pruneBefore(t time.Time) {
+	for id, ts := range r.seen {
+		if ts.Before(t) {
+			delete(r.seen, id)
 		}
-		close(resultChan)
-	}()
-	return resultChan
+	}
 }
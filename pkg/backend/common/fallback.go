@@ -0,0 +1,270 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	// How many more messages than requested to fetch per page when filtering client-side
+	FallbackOverFetchFactor = 4
+	// Backends differ in timestamp precision and in whether the end of a time window is inclusive,
+	// so pages overlap by this much, the messages seen on both pages are skipped based on their ID
+	FallbackPageOverlap = time.Second
+)
+
+// AllFiltersSupported walks the AND, OR and NOT nodes of a filter expression
+// and checks whether every filter in it is supported according to leafSupported
+func AllFiltersSupported(expr FilterExpression, leafSupported func(FilterExpression) bool) bool {
+	switch e := expr.(type) {
+	case AndExpression:
+		return allSupported(e.Operands, leafSupported)
+	case OrExpression:
+		return allSupported(e.Operands, leafSupported)
+	case NotExpression:
+		return AllFiltersSupported(e.Operand, leafSupported)
+	default:
+		return leafSupported(expr)
+	}
+}
+
+func allSupported(exprs []FilterExpression, leafSupported func(FilterExpression) bool) bool {
+	for _, expr := range exprs {
+		if !AllFiltersSupported(expr, leafSupported) {
+			return false
+		}
+	}
+	return true
+}
+
+// SplitQuery splits a query into a query containing only the filters the client can
+// evaluate natively, and a list of remaining filters that have to be evaluated client-side
+func SplitQuery(client Client, query Query) (Query, []FilterExpression) {
+	native := query
+	remainder := make([]FilterExpression, 0)
+	native.EqualityFilters = make([]EqualityFilter, 0, len(query.EqualityFilters))
+	for _, filter := range query.EqualityFilters {
+		if client.SupportsFilter(filter) {
+			native.EqualityFilters = append(native.EqualityFilters, filter)
+		} else {
+			remainder = append(remainder, filter)
+		}
+	}
+	native.ExistenceFilters = make([]ExistenceFilter, 0, len(query.ExistenceFilters))
+	for _, filter := range query.ExistenceFilters {
+		if client.SupportsFilter(filter) {
+			native.ExistenceFilters = append(native.ExistenceFilters, filter)
+		} else {
+			remainder = append(remainder, filter)
+		}
+	}
+	native.MembershipFilters = make([]MembershipFilter, 0, len(query.MembershipFilters))
+	for _, filter := range query.MembershipFilters {
+		if client.SupportsFilter(filter) {
+			native.MembershipFilters = append(native.MembershipFilters, filter)
+		} else {
+			remainder = append(remainder, filter)
+		}
+	}
+	native.RegexFilters = make([]RegexFilter, 0, len(query.RegexFilters))
+	for _, filter := range query.RegexFilters {
+		if client.SupportsFilter(filter) {
+			native.RegexFilters = append(native.RegexFilters, filter)
+		} else {
+			remainder = append(remainder, filter)
+		}
+	}
+	native.Filter = nil
+	if query.Filter != nil {
+		if client.SupportsFilter(query.Filter) {
+			native.Filter = query.Filter
+		} else if and, ok := query.Filter.(AndExpression); ok {
+			// The operands of an AND can be pushed down (or not) individually
+			nativeOperands := make([]FilterExpression, 0, len(and.Operands))
+			for _, operand := range and.Operands {
+				if client.SupportsFilter(operand) {
+					nativeOperands = append(nativeOperands, operand)
+				} else {
+					remainder = append(remainder, operand)
+				}
+			}
+			if len(nativeOperands) > 0 {
+				native.Filter = AndExpression{Operands: nativeOperands}
+			}
+		} else {
+			remainder = append(remainder, query.Filter)
+		}
+	}
+	return native, remainder
+}
+
+func matchesAll(m LogMessage, filters []FilterExpression) bool {
+	for _, filter := range filters {
+		if !filter.Matches(m) {
+			return false
+		}
+	}
+	return true
+}
+
+// OldestFirstClient is implemented by clients that return the query.MaxResults oldest messages
+// within the query's time range, rather than the most recent ones (e.g. CloudWatch)
+type OldestFirstClient interface {
+	OldestFirst() bool
+}
+
+// QueryWithFallback queries the client, evaluating all filters the client cannot evaluate
+// natively client-side. To still get query.MaxResults results, it over-fetches from the backend a page
+// at a time, moving the end of the time window back to the oldest message of the previous page, until
+// enough matching messages are found or the backend runs out. Clients that return the oldest messages
+// first are paged forward through the whole time window instead. Only the matches are held on to, as
+// they have to be sent in ascending order.
+func QueryWithFallback(ctx context.Context, client Client, query Query) <-chan LogMessage {
+	native, remainder := SplitQuery(client, query)
+	if len(remainder) == 0 {
+		return client.Query(ctx, query)
+	}
+	// We need all attributes to filter on, so project afterwards
+	native.SelectFields = nil
+	resultChan := make(chan LogMessage)
+	if query.Follow {
+		go func() {
+			defer close(resultChan)
+			for message := range client.Query(ctx, native) {
+				if matchesAll(message, remainder) {
+					message.Attributes = Project(message.Attributes, query.SelectFields)
+					if !SendMessage(ctx, resultChan, message) {
+						return
+					}
+				}
+			}
+		}()
+		return resultChan
+	}
+	go func() {
+		defer close(resultChan)
+		native.MaxResults = query.MaxResults * FallbackOverFetchFactor
+		var matches []LogMessage
+		if oldestFirst, ok := client.(OldestFirstClient); ok && oldestFirst.OldestFirst() {
+			matches = pageForward(ctx, client, native, remainder, query)
+		} else {
+			matches = pageBackward(ctx, client, native, remainder, query)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		for _, message := range mostRecentMatches(matches, query.MaxResults) {
+			message.Attributes = Project(message.Attributes, query.SelectFields)
+			if !SendMessage(ctx, resultChan, message) {
+				return
+			}
+		}
+	}()
+	return resultChan
+}
+
+// Fetches pages of the most recent messages, moving the end of the time window back every page
+func pageBackward(ctx context.Context, client Client, native Query, remainder []FilterExpression, query Query) []LogMessage {
+	seen := newRecentMessages()
+	// Pages come in newest first, so prepend every page's matches
+	matches := make([]LogMessage, 0, query.MaxResults)
+	for len(matches) < query.MaxResults {
+		received, fresh := 0, 0
+		var oldest time.Time
+		pageMatches := make([]LogMessage, 0)
+		for message := range client.Query(ctx, native) {
+			received++
+			if oldest.IsZero() || message.Timestamp.Before(oldest) {
+				oldest = message.Timestamp
+			}
+			if !seen.add(message) {
+				continue
+			}
+			fresh++
+			if matchesAll(message, remainder) {
+				pageMatches = append(pageMatches, message)
+			}
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		matches = append(pageMatches, matches...)
+		if received < native.MaxResults {
+			break
+		}
+		if fresh == 0 {
+			warnPageFull(len(matches), native.MaxResults, oldest)
+			break
+		}
+		before := oldest.Add(FallbackPageOverlap)
+		if query.Before != nil && before.After(*query.Before) {
+			before = *query.Before
+		}
+		native.Before = &before
+		seen.pruneBefore(oldest)
+	}
+	return matches
+}
+
+// Fetches pages of the oldest messages, moving the start of the time window forward every page.
+// The most recent matches are only known once the backend runs out, so this reads the whole time window.
+func pageForward(ctx context.Context, client Client, native Query, remainder []FilterExpression, query Query) []LogMessage {
+	seen := newRecentMessages()
+	matches := make([]LogMessage, 0, query.MaxResults)
+	for {
+		received, fresh := 0, 0
+		var newest time.Time
+		for message := range client.Query(ctx, native) {
+			received++
+			if message.Timestamp.After(newest) {
+				newest = message.Timestamp
+			}
+			if !seen.add(message) {
+				continue
+			}
+			fresh++
+			if matchesAll(message, remainder) {
+				matches = append(matches, message)
+			}
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		if len(matches) > 2*query.MaxResults {
+			matches = mostRecentMatches(matches, query.MaxResults)
+		}
+		if received < native.MaxResults {
+			break
+		}
+		if fresh == 0 {
+			warnPageFull(len(matches), native.MaxResults, newest)
+			break
+		}
+		after := newest.Add(-FallbackPageOverlap)
+		if query.After != nil && after.Before(*query.After) {
+			after = *query.After
+		}
+		native.After = &after
+		seen.pruneBefore(after)
+	}
+	return matches
+}
+
+func warnPageFull(found, pageSize int, at time.Time) {
+	fmt.Fprintf(os.Stderr, "Only found %d matches, as not all filters could be evaluated by this backend and more than %d messages are within %s of %s\n",
+		found, pageSize, FallbackPageOverlap, at.Format(time.RFC3339))
+}
+
+// Sorts matches in ascending order and keeps the most recent maxResults
+func mostRecentMatches(matches []LogMessage, maxResults int) []LogMessage {
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Timestamp.Before(matches[j].Timestamp)
+	})
+	if len(matches) > maxResults {
+		matches = matches[len(matches)-maxResults:]
+	}
+	return matches
+}
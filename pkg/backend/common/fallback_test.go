@@ -0,0 +1,202 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// A client backed by a list of messages that only supports equality filters natively
+type equalityOnlyClient struct {
+	messages    []LogMessage
+	seenQueries []Query
+	oldestFirst bool
+}
+
+func (client *equalityOnlyClient) OldestFirst() bool {
+	return client.oldestFirst
+}
+
+func (client *equalityOnlyClient) SupportsFilter(filter FilterExpression) bool {
+	return AllFiltersSupported(filter, func(leaf FilterExpression) bool {
+		_, ok := leaf.(EqualityFilter)
+		return ok
+	})
+}
+
+// Returns the most recent query.MaxResults matching messages, like Kibana does,
+// or the oldest ones if oldestFirst is set, like CloudWatch does
+func (client *equalityOnlyClient) Query(ctx context.Context, query Query) <-chan LogMessage {
+	client.seenQueries = append(client.seenQueries, query)
+	matching := make([]LogMessage, 0)
+	for _, message := range client.messages {
+		if MatchesQuery(message, query) {
+			matching = append(matching, message)
+		}
+	}
+	if len(matching) > query.MaxResults {
+		if client.oldestFirst {
+			matching = matching[:query.MaxResults]
+		} else {
+			matching = matching[len(matching)-query.MaxResults:]
+		}
+	}
+	resultChan := make(chan LogMessage)
+	go func() {
+		for _, message := range matching {
+			message.Attributes = Project(message.Attributes, query.SelectFields)
+			resultChan <- message
+		}
+		close(resultChan)
+	}()
+	return resultChan
+}
+
+func newTestMessages(n int) []LogMessage {
+	start := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	messages := make([]LogMessage, 0, n)
+	for i := 0; i < n; i++ {
+		messages = append(messages, LogMessage{
+			ID:        fmt.Sprintf("%d", i),
+			Timestamp: start.Add(time.Duration(i) * time.Second),
+			Attributes: map[string]interface{}{
+				"message": fmt.Sprintf("Message %d", i),
+				"level":   []string{"info", "error"}[i%2],
+				"n":       i,
+			},
+		})
+	}
+	return messages
+}
+
+func TestSplitQuery(t *testing.T) {
+	client := &equalityOnlyClient{}
+	regexFilter, _ := NewRegexFilter("message", "^Message", false)
+	expr, _ := ParseFilterExpression("level=error AND message~7$ AND (n=1 OR n=2)")
+	native, remainder := SplitQuery(client, Query{
+		EqualityFilters:  []EqualityFilter{{FieldName: "level", Operator: "=", Value: "error"}},
+		ExistenceFilters: []ExistenceFilter{{FieldName: "n", Exists: true}},
+		RegexFilters:     []RegexFilter{regexFilter},
+		Filter:           expr,
+	})
+	if len(native.EqualityFilters) != 1 || len(native.ExistenceFilters) != 0 || len(native.RegexFilters) != 0 {
+		t.Errorf("Unexpected native query: %+v", native)
+	}
+	nativeExpr, ok := native.Filter.(AndExpression)
+	if !ok || len(nativeExpr.Operands) != 2 {
+		t.Errorf("Expected two AND operands to be pushed down, got %+v", native.Filter)
+	}
+	if len(remainder) != 3 {
+		t.Errorf("Expected 3 remaining filters, got %+v", remainder)
+	}
+}
+
+func TestQueryWithFallback(t *testing.T) {
+	client := &equalityOnlyClient{messages: newTestMessages(1000)}
+	regexFilter, _ := NewRegexFilter("message", "7$", false)
+	results := make([]LogMessage, 0)
+	for message := range QueryWithFallback(context.Background(), client, Query{
+		EqualityFilters: []EqualityFilter{{FieldName: "level", Operator: "=", Value: "error"}},
+		RegexFilters:    []RegexFilter{regexFilter},
+		SelectFields:    []string{"n"},
+		MaxResults:      20,
+	}) {
+		results = append(results, message)
+	}
+	if len(results) != 20 {
+		t.Fatalf("Expected 20 results, got %d", len(results))
+	}
+	// Most recent matches are 997, 987, ..., 807
+	for i, message := range results {
+		if expected := 807 + i*10; message.Attributes["n"] != expected {
+			t.Errorf("Expected n=%d, got %+v", expected, message.Attributes)
+		}
+		if _, ok := message.Attributes["message"]; ok {
+			t.Error("Expected message attribute to be projected away")
+		}
+	}
+	if len(client.seenQueries) < 2 {
+		t.Errorf("Expected multiple pages to be requested, got %d queries", len(client.seenQueries))
+	}
+	var before *time.Time
+	for i, query := range client.seenQueries {
+		if len(query.RegexFilters) != 0 || len(query.SelectFields) != 0 || query.MaxResults != 80 {
+			t.Errorf("Unexpected query sent to backend: %+v", query)
+		}
+		if i > 0 && (query.Before == nil || (before != nil && !query.Before.Before(*before))) {
+			t.Errorf("Expected page %d to end before the previous one", i)
+		}
+		before = query.Before
+	}
+}
+
+func TestQueryWithFallbackManyPages(t *testing.T) {
+	// Finding the matches takes fetching more than 10,000 messages, and pages overlap by a second (a message)
+	client := &equalityOnlyClient{messages: newTestMessages(12000)}
+	regexFilter, _ := NewRegexFilter("message", "00$", false)
+	results := make([]LogMessage, 0)
+	for message := range QueryWithFallback(context.Background(), client, Query{
+		RegexFilters: []RegexFilter{regexFilter},
+		MaxResults:   105,
+	}) {
+		results = append(results, message)
+	}
+	if len(results) != 105 {
+		t.Fatalf("Expected 105 results, got %d", len(results))
+	}
+	// Most recent matches are 1500, 1600, ..., 11900
+	for i, message := range results {
+		if expected := 1500 + i*100; message.Attributes["n"] != expected {
+			t.Errorf("Expected n=%d, got %+v", expected, message.Attributes)
+		}
+	}
+	for _, query := range client.seenQueries {
+		if query.MaxResults != 420 {
+			t.Errorf("Expected pages of 420 messages, got %d", query.MaxResults)
+		}
+	}
+}
+
+func TestQueryWithFallbackOldestFirst(t *testing.T) {
+	client := &equalityOnlyClient{messages: newTestMessages(1000), oldestFirst: true}
+	regexFilter, _ := NewRegexFilter("message", "7$", false)
+	results := make([]LogMessage, 0)
+	for message := range QueryWithFallback(context.Background(), client, Query{
+		EqualityFilters: []EqualityFilter{{FieldName: "level", Operator: "=", Value: "error"}},
+		RegexFilters:    []RegexFilter{regexFilter},
+		MaxResults:      20,
+	}) {
+		results = append(results, message)
+	}
+	if len(results) != 20 {
+		t.Fatalf("Expected 20 results, got %d", len(results))
+	}
+	// Still the most recent matches, 807, 817, ..., 997
+	for i, message := range results {
+		if expected := 807 + i*10; message.Attributes["n"] != expected {
+			t.Errorf("Expected n=%d, got %+v", expected, message.Attributes)
+		}
+	}
+	var after *time.Time
+	for i, query := range client.seenQueries {
+		if i > 0 && (query.After == nil || (after != nil && !query.After.After(*after))) {
+			t.Errorf("Expected page %d to start after the previous one", i)
+		}
+		after = query.After
+	}
+}
+
+func TestQueryWithFallbackNativeOnly(t *testing.T) {
+	client := &equalityOnlyClient{messages: newTestMessages(100)}
+	count := 0
+	for range QueryWithFallback(context.Background(), client, Query{
+		EqualityFilters: []EqualityFilter{{FieldName: "level", Operator: "=", Value: "info"}},
+		MaxResults:      10,
+	}) {
+		count++
+	}
+	if count != 10 || len(client.seenQueries) != 1 || client.seenQueries[0].MaxResults != 10 {
+		t.Errorf("Expected a single native query, got %d results and queries %+v", count, client.seenQueries)
+	}
+}
@@ -0,0 +1,324 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// FilterExpression is a filter, or a boolean combination of filters, e.g. as parsed from
+// `(level=error OR level=fatal) AND NOT service=healthcheck`
+// Leaves of the expression tree are regular filters (e.g. EqualityFilter)
+type FilterExpression interface {
+	Matches(m LogMessage) bool
+}
+
+// AndExpression matches if all of its operands match
+type AndExpression struct {
+	Operands []FilterExpression
+}
+
+// OrExpression matches if any of its operands match
+type OrExpression struct {
+	Operands []FilterExpression
+}
+
+// NotExpression matches if its operand does not match
+type NotExpression struct {
+	Operand FilterExpression
+}
+
+func (e AndExpression) Matches(m LogMessage) bool {
+	for _, operand := range e.Operands {
+		if !operand.Matches(m) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e OrExpression) Matches(m LogMessage) bool {
+	for _, operand := range e.Operands {
+		if operand.Matches(m) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e NotExpression) Matches(m LogMessage) bool {
+	return !e.Operand.Matches(m)
+}
+
+// PushDownNegations rewrites an expression (using De Morgan's laws) so that NOTs
+// only remain directly around filters that cannot be negated themselves.
+// This is useful for backends whose query language lacks a generic NOT.
+func PushDownNegations(expr FilterExpression) FilterExpression {
+	switch e := expr.(type) {
+	case AndExpression:
+		return AndExpression{Operands: mapExpressions(e.Operands, PushDownNegations)}
+	case OrExpression:
+		return OrExpression{Operands: mapExpressions(e.Operands, PushDownNegations)}
+	case NotExpression:
+		return negate(e.Operand)
+	default:
+		return expr
+	}
+}
+
+func negate(expr FilterExpression) FilterExpression {
+	switch e := expr.(type) {
+	case AndExpression:
+		return OrExpression{Operands: mapExpressions(e.Operands, negate)}
+	case OrExpression:
+		return AndExpression{Operands: mapExpressions(e.Operands, negate)}
+	case NotExpression:
+		return PushDownNegations(e.Operand)
+	case RegexFilter:
+		e.Negated = !e.Negated
+		return e
+	case EqualityFilter:
+		switch e.Operator {
+		case "=":
+			e.Operator = "!="
+			return e
+		case "!=":
+			e.Operator = "="
+			return e
+		}
+	}
+	return NotExpression{Operand: expr}
+}
+
+func mapExpressions(exprs []FilterExpression, fn func(FilterExpression) FilterExpression) []FilterExpression {
+	result := make([]FilterExpression, 0, len(exprs))
+	for _, expr := range exprs {
+		result = append(result, fn(expr))
+	}
+	return result
+}
+
+// Operators supported in filter expression comparisons, longest first so that
+// tokenizing is greedy
+var filterOperators = []string{"!=", "!~", ">=", "<=", "=", "~", ">", "<"}
+
+type filterTokenKind int
+
+const (
+	wordToken filterTokenKind = iota
+	stringToken
+	operatorToken
+	openParenToken
+	closeParenToken
+)
+
+type filterToken struct {
+	kind  filterTokenKind
+	value string
+	pos   int
+}
+
+func (t filterToken) isKeyword(keyword string) bool {
+	return t.kind == wordToken && strings.EqualFold(t.value, keyword)
+}
+
+func operatorAt(s string, i int) string {
+	for _, op := range filterOperators {
+		if strings.HasPrefix(s[i:], op) {
+			return op
+		}
+	}
+	return ""
+}
+
+func isWordTerminator(s string, i int) bool {
+	switch s[i] {
+	case '(', ')', '"', '\'':
+		return true
+	}
+	return unicode.IsSpace(rune(s[i])) || operatorAt(s, i) != ""
+}
+
+func tokenizeFilter(s string) ([]filterToken, error) {
+	tokens := make([]filterToken, 0, 10)
+	i := 0
+	for i < len(s) {
+		switch c := s[i]; {
+		case unicode.IsSpace(rune(c)):
+			i++
+		case c == '(':
+			tokens = append(tokens, filterToken{openParenToken, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, filterToken{closeParenToken, ")", i})
+			i++
+		case c == '"' || c == '\'':
+			start := i
+			var sb strings.Builder
+			i++
+			for i < len(s) && s[i] != c {
+				// Only the quote itself is escaped, other backslashes are kept as-is (e.g. for regexes)
+				if s[i] == '\\' && i+1 < len(s) && s[i+1] == c {
+					i++
+				}
+				sb.WriteByte(s[i])
+				i++
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("unterminated string starting at position %d", start)
+			}
+			i++
+			tokens = append(tokens, filterToken{stringToken, sb.String(), start})
+		case operatorAt(s, i) != "":
+			op := operatorAt(s, i)
+			tokens = append(tokens, filterToken{operatorToken, op, i})
+			i += len(op)
+		default:
+			start := i
+			for i < len(s) && !isWordTerminator(s, i) {
+				i++
+			}
+			tokens = append(tokens, filterToken{wordToken, s[start:i], start})
+		}
+	}
+	return tokens, nil
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) peek() *filterToken {
+	if p.pos >= len(p.tokens) {
+		return nil
+	}
+	return &p.tokens[p.pos]
+}
+
+func (p *filterParser) next() *filterToken {
+	t := p.peek()
+	if t != nil {
+		p.pos++
+	}
+	return t
+}
+
+// expression := or
+// or         := and ("OR" and)*
+// and        := not ("AND" not)*
+// not        := "NOT" not | primary
+// primary    := "(" expression ")" | field operator value
+func (p *filterParser) parseOr() (FilterExpression, error) {
+	return p.parseBinary("OR", p.parseAnd, func(operands []FilterExpression) FilterExpression {
+		return OrExpression{Operands: operands}
+	})
+}
+
+func (p *filterParser) parseAnd() (FilterExpression, error) {
+	return p.parseBinary("AND", p.parseNot, func(operands []FilterExpression) FilterExpression {
+		return AndExpression{Operands: operands}
+	})
+}
+
+func (p *filterParser) parseBinary(keyword string, parseOperand func() (FilterExpression, error), build func([]FilterExpression) FilterExpression) (FilterExpression, error) {
+	first, err := parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	operands := []FilterExpression{first}
+	for t := p.peek(); t != nil && t.isKeyword(keyword); t = p.peek() {
+		p.next()
+		operand, err := parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, operand)
+	}
+	if len(operands) == 1 {
+		return first, nil
+	}
+	return build(operands), nil
+}
+
+func (p *filterParser) parseNot() (FilterExpression, error) {
+	if t := p.peek(); t != nil && t.isKeyword("NOT") {
+		p.next()
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return NotExpression{Operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *filterParser) parsePrimary() (FilterExpression, error) {
+	t := p.next()
+	if t == nil {
+		return nil, fmt.Errorf("unexpected end of filter expression")
+	}
+	switch t.kind {
+	case openParenToken:
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing == nil || closing.kind != closeParenToken {
+			return nil, fmt.Errorf("missing ')' for '(' at position %d", t.pos)
+		}
+		return expr, nil
+	case wordToken, stringToken:
+		op := p.next()
+		if op == nil || op.kind != operatorToken {
+			return nil, fmt.Errorf("expected operator after %q at position %d", t.value, t.pos)
+		}
+		value := p.next()
+		if value == nil || (value.kind != wordToken && value.kind != stringToken) {
+			return nil, fmt.Errorf("expected value after %q at position %d", op.value, op.pos)
+		}
+		return newFilterComparison(t.value, op.value, value.value)
+	default:
+		return nil, fmt.Errorf("unexpected %q at position %d", t.value, t.pos)
+	}
+}
+
+func newFilterComparison(fieldName, operator, value string) (FilterExpression, error) {
+	switch operator {
+	case "~", "!~":
+		filter, err := NewRegexFilter(fieldName, value, operator == "!~")
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression for %s: %v", fieldName, err)
+		}
+		return filter, nil
+	}
+	return EqualityFilter{
+		FieldName: fieldName,
+		Operator:  operator,
+		Value:     value,
+	}, nil
+}
+
+// ParseFilterExpression parses a boolean filter expression, e.g.
+// `(level=error OR level=fatal) AND NOT service=healthcheck`
+// AND binds stronger than OR, the AND, OR and NOT keywords are case-insensitive
+// and values containing spaces, parentheses or operators can be quoted.
+// Supported operators are =, !=, >, >=, <, <= and ~ and !~ for regular expressions.
+func ParseFilterExpression(s string) (FilterExpression, error) {
+	tokens, err := tokenizeFilter(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty filter expression")
+	}
+	p := &filterParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t != nil {
+		return nil, fmt.Errorf("unexpected %q at position %d", t.value, t.pos)
+	}
+	return expr, nil
+}
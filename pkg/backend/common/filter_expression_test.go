@@ -0,0 +1,166 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFilterExpression(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  FilterExpression
+	}{
+		{
+			name:  "Single comparison",
+			input: "level=error",
+			want:  EqualityFilter{FieldName: "level", Operator: "=", Value: "error"},
+		},
+		{
+			name:  "AND binds stronger than OR",
+			input: "a=1 OR b!=2 AND c=3",
+			want: OrExpression{Operands: []FilterExpression{
+				EqualityFilter{FieldName: "a", Operator: "=", Value: "1"},
+				AndExpression{Operands: []FilterExpression{
+					EqualityFilter{FieldName: "b", Operator: "!=", Value: "2"},
+					EqualityFilter{FieldName: "c", Operator: "=", Value: "3"},
+				}},
+			}},
+		},
+		{
+			name:  "Grouping and negation",
+			input: "(level=error or level = fatal) and not service=healthcheck",
+			want: AndExpression{Operands: []FilterExpression{
+				OrExpression{Operands: []FilterExpression{
+					EqualityFilter{FieldName: "level", Operator: "=", Value: "error"},
+					EqualityFilter{FieldName: "level", Operator: "=", Value: "fatal"},
+				}},
+				NotExpression{Operand: EqualityFilter{FieldName: "service", Operator: "=", Value: "healthcheck"}},
+			}},
+		},
+		{
+			name:  "Ordering comparisons",
+			input: "duration_ms>=500 AND status<400",
+			want: AndExpression{Operands: []FilterExpression{
+				EqualityFilter{FieldName: "duration_ms", Operator: ">=", Value: "500"},
+				EqualityFilter{FieldName: "status", Operator: "<", Value: "400"},
+			}},
+		},
+		{
+			name:  "Quoted values",
+			input: `message="Connection (re)set" OR 'docker.name'='it\'s = me'`,
+			want: OrExpression{Operands: []FilterExpression{
+				EqualityFilter{FieldName: "message", Operator: "=", Value: "Connection (re)set"},
+				EqualityFilter{FieldName: "docker.name", Operator: "=", Value: "it's = me"},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFilterExpression(tt.input)
+			if err != nil {
+				t.Fatalf("ParseFilterExpression() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseFilterExpression() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFilterExpressionErrors(t *testing.T) {
+	invalidExpressions := []string{
+		"",
+		"level",
+		"level=",
+		"(level=error",
+		"level=error)",
+		"level=error AND",
+		"level=error OR OR level=fatal",
+		`message="unterminated`,
+		`path~"("`,
+		"NOT",
+	}
+	for _, input := range invalidExpressions {
+		if expr, err := ParseFilterExpression(input); err == nil {
+			t.Errorf("Expected error parsing %q, got %+v", input, expr)
+		}
+	}
+}
+
+func TestFilterExpressionMatches(t *testing.T) {
+	lm := LogMessage{
+		Attributes: map[string]interface{}{
+			"message": "Sup",
+			"level":   "error",
+			"service": "api",
+			"status":  500,
+		},
+	}
+	shouldMatch := []string{
+		"level=error",
+		"level=error OR level=fatal",
+		"(level=error OR level=fatal) AND NOT service=healthcheck",
+		"status=500 AND (service=api OR service=web)",
+		"NOT NOT level=error",
+		"level!=warn AND missing!=something",
+		`service~"^a.i$" AND NOT level~warn|fatal`,
+		`message!~"\d+"`,
+	}
+	shouldNotMatch := []string{
+		"level=fatal",
+		"level=warn OR level=fatal",
+		"(level=error OR level=fatal) AND NOT service=api",
+		"NOT status=500",
+		"missing=something",
+		"service!~api",
+		"missing~.",
+	}
+	for _, input := range shouldMatch {
+		expr, err := ParseFilterExpression(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !expr.Matches(lm) {
+			t.Errorf("Did not match: %s", input)
+		}
+		if !PushDownNegations(expr).Matches(lm) {
+			t.Errorf("Did not match after pushing down negations: %s", input)
+		}
+		if !MatchesQuery(lm, Query{Filter: expr}) {
+			t.Errorf("Query did not match: %s", input)
+		}
+	}
+	for _, input := range shouldNotMatch {
+		expr, err := ParseFilterExpression(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expr.Matches(lm) {
+			t.Errorf("Did match: %s", input)
+		}
+		if PushDownNegations(expr).Matches(lm) {
+			t.Errorf("Did match after pushing down negations: %s", input)
+		}
+		if MatchesQuery(lm, Query{Filter: expr}) {
+			t.Errorf("Query did match: %s", input)
+		}
+	}
+}
+
+func TestPushDownNegations(t *testing.T) {
+	expr, err := ParseFilterExpression("NOT (level=error OR (service!=api AND NOT host=a))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := AndExpression{Operands: []FilterExpression{
+		EqualityFilter{FieldName: "level", Operator: "!=", Value: "error"},
+		OrExpression{Operands: []FilterExpression{
+			EqualityFilter{FieldName: "service", Operator: "=", Value: "api"},
+			EqualityFilter{FieldName: "host", Operator: "=", Value: "a"},
+		}},
+	}}
+	if got := PushDownNegations(expr); !reflect.DeepEqual(got, want) {
+		t.Errorf("PushDownNegations() = %+v, want %+v", got, want)
+	}
+}
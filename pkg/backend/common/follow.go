@@ -0,0 +1,87 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Maximum number of messages requested per poll in follow mode, after the initial query
+const FollowMaxResults = 10000
+
+// FollowQuery implements log "following" (tailing) in a generic way, on top of a function that
+// fetches the messages matching a query (`queryMessagesFunc`, expected to return them in ascending order).
+// The first poll runs the query as is, after that every poll only requests messages after a cursor:
+// the most recent timestamp seen so far, minus an overlap window. Due to the eventual-consistency type
+// behavior of many log aggregation systems, logs may not actually arrive in sequence; the overlap gives
+// late messages query.FollowOverlap to show up. Messages within the window are deduplicated based on
+// their ID, messages before the window are dropped and forgotten.
+func FollowQuery(ctx context.Context, query Query, queryMessagesFunc func(query Query) ([]LogMessage, error)) <-chan LogMessage {
+	pollInterval := query.PollInterval
+	if pollInterval == 0 {
+		pollInterval = FollowPollTime
+	}
+	overlap := query.FollowOverlap
+	if overlap == 0 {
+		overlap = FollowOverlapTime
+	}
+	resultChan := make(chan LogMessage)
+	go func() {
+		defer close(resultChan)
+		seen := newRecentMessages()
+		var cursor, windowStart *time.Time
+		retries := 0
+		for {
+			pollQuery := query
+			if cursor != nil {
+				start := cursor.Add(-overlap)
+				windowStart = &start
+				if query.After == nil || windowStart.After(*query.After) {
+					pollQuery.After = windowStart
+				}
+				pollQuery.MaxResults = FollowMaxResults
+			}
+			messages, err := queryMessagesFunc(pollQuery)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				retries++
+				if retries >= ConnectionRetries {
+					fmt.Fprintf(os.Stderr, "Could not connect: %v\nExceeded total number of retries, exiting.\n", err)
+					return
+				}
+				fmt.Fprintf(os.Stderr, "Could not connect: %v retrying in %s\n", err, pollInterval)
+				if canceableSleep(ctx, pollInterval) {
+					return
+				}
+				continue
+			}
+			// Request succesful, so reset retry count
+			retries = 0
+			for _, message := range messages {
+				if windowStart != nil && message.Timestamp.Before(*windowStart) {
+					continue
+				}
+				if !seen.add(message) {
+					continue
+				}
+				if cursor == nil || message.Timestamp.After(*cursor) {
+					ts := message.Timestamp
+					cursor = &ts
+				}
+				if !SendMessage(ctx, resultChan, message) {
+					return
+				}
+			}
+			if cursor != nil {
+				seen.pruneBefore(cursor.Add(-overlap))
+			}
+			if canceableSleep(ctx, pollInterval) {
+				return
+			}
+		}
+	}()
+	return resultChan
+}
@@ -0,0 +1,72 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestFollowQuery(t *testing.T) {
+	start := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	message := func(id int, offset time.Duration) LogMessage {
+		return LogMessage{ID: fmt.Sprintf("%d", id), Timestamp: start.Add(offset)}
+	}
+	// What the backend returns on every poll, each poll adds messages, some of which arrive late
+	polls := [][]LogMessage{
+		{message(1, 0), message(2, time.Second)},
+		{message(1, 0), message(2, time.Second), message(3, 10*time.Second)},
+		// 4 arrives late, but within the overlap, 5 is too late
+		{message(5, 0), message(4, 8*time.Second), message(3, 10*time.Second), message(6, 20*time.Second)},
+		{message(6, 20*time.Second)},
+	}
+	seenQueries := make([]Query, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	results := FollowQuery(ctx, Query{
+		MaxResults:    10,
+		PollInterval:  time.Millisecond,
+		FollowOverlap: 5 * time.Second,
+	}, func(query Query) ([]LogMessage, error) {
+		seenQueries = append(seenQueries, query)
+		if len(seenQueries) > len(polls) {
+			cancel()
+			return nil, nil
+		}
+		return polls[len(seenQueries)-1], nil
+	})
+	ids := ""
+	for message := range results {
+		ids += message.ID
+	}
+	if ids != "12346" {
+		t.Errorf("Expected messages 12346, got %s", ids)
+	}
+	if seenQueries[0].After != nil || seenQueries[0].MaxResults != 10 {
+		t.Errorf("Unexpected initial query: %+v", seenQueries[0])
+	}
+	// The cursor is at 20s after the third poll
+	if after := seenQueries[3].After; after == nil || !after.Equal(start.Add(15*time.Second)) {
+		t.Errorf("Expected query after cursor minus overlap, got %v", after)
+	}
+	if seenQueries[3].MaxResults != FollowMaxResults {
+		t.Errorf("Expected %d max results, got %d", FollowMaxResults, seenQueries[3].MaxResults)
+	}
+}
+
+func TestRecentMessages(t *testing.T) {
+	start := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	seen := newRecentMessages()
+	for i := 0; i < 10; i++ {
+		if !seen.add(LogMessage{ID: fmt.Sprintf("%d", i), Timestamp: start.Add(time.Duration(i) * time.Second)}) {
+			t.Errorf("Message %d should be new", i)
+		}
+	}
+	if seen.add(LogMessage{ID: "3", Timestamp: start.Add(3 * time.Second)}) {
+		t.Error("Message 3 should have been seen already")
+	}
+	seen.pruneBefore(start.Add(5 * time.Second))
+	if len(seen.seen) != 5 {
+		t.Errorf("Expected 5 remembered messages, got %d", len(seen.seen))
+	}
+}
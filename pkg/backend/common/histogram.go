@@ -0,0 +1,131 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Bucket sizes to choose from when no interval is given
+var histogramIntervals = []time.Duration{
+	time.Second, 5 * time.Second, 10 * time.Second, 30 * time.Second,
+	time.Minute, 5 * time.Minute, 10 * time.Minute, 30 * time.Minute,
+	time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour, 24 * time.Hour,
+}
+
+type HistogramQuery struct {
+	Query
+	Interval time.Duration
+}
+
+type HistogramBucket struct {
+	Start time.Time
+	Count int
+}
+
+// HistogramClient is implemented by clients that can count messages per interval natively
+type HistogramClient interface {
+	Histogram(ctx context.Context, query HistogramQuery) ([]HistogramBucket, error)
+}
+
+// HistogramInterval picks the smallest of a list of round intervals that divides span into at most maxBuckets
+func HistogramInterval(span time.Duration, maxBuckets int) time.Duration {
+	for _, interval := range histogramIntervals {
+		if span/interval <= time.Duration(maxBuckets) {
+			return interval
+		}
+	}
+	return histogramIntervals[len(histogramIntervals)-1]
+}
+
+// Returns consecutive buckets from first to last (inclusive), with the counts of the buckets
+// starting at the same time, so that quiet periods show up as empty buckets
+func fillBuckets(counts map[time.Time]int, first, last time.Time, interval time.Duration) []HistogramBucket {
+	buckets := make([]HistogramBucket, 0)
+	for start := first; !start.After(last); start = start.Add(interval) {
+		buckets = append(buckets, HistogramBucket{start, counts[start]})
+	}
+	return buckets
+}
+
+// BucketMessages counts messages per interval client-side, in UTC. Buckets span the query's time range,
+// or the time between the first and last message for the ends that aren't set.
+func BucketMessages(messages <-chan LogMessage, query HistogramQuery) []HistogramBucket {
+	counts := make(map[time.Time]int)
+	var first, last time.Time
+	for message := range messages {
+		start := message.Timestamp.UTC().Truncate(query.Interval)
+		counts[start]++
+		if first.IsZero() || start.Before(first) {
+			first = start
+		}
+		if start.After(last) {
+			last = start
+		}
+	}
+	if query.After != nil {
+		first = query.After.UTC().Truncate(query.Interval)
+	}
+	if query.Before != nil {
+		last = query.Before.UTC().Add(-time.Nanosecond).Truncate(query.Interval)
+	}
+	if len(counts) == 0 && (query.After == nil || query.Before == nil) {
+		return []HistogramBucket{}
+	}
+	return fillBuckets(counts, first, last, query.Interval)
+}
+
+// Counts the messages passing through, to tell whether a computation over them was limited by MaxResults
+type messageCounter struct {
+	count  int
+	oldest time.Time
+}
+
+func (counter *messageCounter) pass(messages <-chan LogMessage) <-chan LogMessage {
+	resultChan := make(chan LogMessage)
+	go func() {
+		defer close(resultChan)
+		for message := range messages {
+			counter.count++
+			if counter.oldest.IsZero() || message.Timestamp.Before(counter.oldest) {
+				counter.oldest = message.Timestamp
+			}
+			resultChan <- message
+		}
+	}()
+	return resultChan
+}
+
+// Warns on stderr if maxResults messages were counted, so that older messages may be missing
+func (counter *messageCounter) warnIfLimited(maxResults int, what string) bool {
+	if maxResults <= 0 || counter.count < maxResults {
+		return false
+	}
+	fmt.Fprintf(os.Stderr, "Only %s the %d most recent messages, since %s, use -n to include more\n",
+		what, counter.count, counter.oldest.Format(time.RFC3339))
+	return true
+}
+
+// QueryHistogram counts messages per interval natively if the client supports that (and all of the
+// query's filters), and otherwise client-side, over the query.MaxResults most recent messages. In that case,
+// if there are more messages, the buckets start at the oldest message counted and a warning is shown.
+func QueryHistogram(ctx context.Context, client Client, query HistogramQuery) ([]HistogramBucket, error) {
+	if histogramClient, ok := client.(HistogramClient); ok {
+		if _, remainder := SplitQuery(client, query.Query); len(remainder) == 0 {
+			return histogramClient.Histogram(ctx, query)
+		}
+	}
+	messageQuery := query.Query
+	messageQuery.Follow = false
+	messageQuery.SelectFields = nil
+	var counter messageCounter
+	buckets := BucketMessages(counter.pass(QueryWithFallback(ctx, client, messageQuery)), query)
+	if counter.warnIfLimited(messageQuery.MaxResults, "counted") {
+		first := counter.oldest.UTC().Truncate(query.Interval)
+		for len(buckets) > 0 && buckets[0].Start.Before(first) {
+			buckets = buckets[1:]
+		}
+	}
+	return buckets, nil
+}
@@ -0,0 +1,96 @@
+package common
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHistogramInterval(t *testing.T) {
+	tests := map[time.Duration]time.Duration{
+		30 * time.Second:     time.Second,
+		time.Hour:            time.Minute,
+		2 * time.Hour:        5 * time.Minute,
+		24 * time.Hour:       30 * time.Minute,
+		365 * 24 * time.Hour: 24 * time.Hour,
+	}
+	for span, expected := range tests {
+		if interval := HistogramInterval(span, 60); interval != expected {
+			t.Errorf("Expected %s for %s, got %s", expected, span, interval)
+		}
+	}
+}
+
+func TestBucketMessages(t *testing.T) {
+	start := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	messages := make(chan LogMessage, 10)
+	for _, offset := range []time.Duration{10 * time.Second, 50 * time.Second, 3*time.Minute + 5*time.Second} {
+		messages <- LogMessage{Timestamp: start.Add(offset)}
+	}
+	close(messages)
+	buckets := BucketMessages(messages, HistogramQuery{Interval: time.Minute})
+	expected := []HistogramBucket{
+		{start, 2},
+		{start.Add(time.Minute), 0},
+		{start.Add(2 * time.Minute), 0},
+		{start.Add(3 * time.Minute), 1},
+	}
+	if !reflect.DeepEqual(buckets, expected) {
+		t.Errorf("Unexpected buckets: %+v", buckets)
+	}
+}
+
+func TestBucketMessagesTimeRange(t *testing.T) {
+	// Buckets cover the whole time range, in UTC
+	location := time.FixedZone("CEST", 2*60*60)
+	after := time.Date(2018, 10, 1, 14, 0, 30, 0, location)
+	before := time.Date(2018, 10, 1, 14, 3, 0, 0, location)
+	messages := make(chan LogMessage, 1)
+	messages <- LogMessage{Timestamp: time.Date(2018, 10, 1, 12, 1, 15, 0, time.UTC)}
+	close(messages)
+	buckets := BucketMessages(messages, HistogramQuery{Query: Query{After: &after, Before: &before}, Interval: time.Minute})
+	start := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	expected := []HistogramBucket{{start, 0}, {start.Add(time.Minute), 1}, {start.Add(2 * time.Minute), 0}}
+	if !reflect.DeepEqual(buckets, expected) {
+		t.Errorf("Unexpected buckets: %+v", buckets)
+	}
+	empty := make(chan LogMessage)
+	close(empty)
+	if buckets := BucketMessages(empty, HistogramQuery{Interval: time.Minute}); len(buckets) != 0 {
+		t.Errorf("Expected no buckets without messages or a time range, got %+v", buckets)
+	}
+}
+
+func (client *fakeStatsClient) Histogram(ctx context.Context, query HistogramQuery) ([]HistogramBucket, error) {
+	return []HistogramBucket{{Count: 42}}, nil
+}
+
+func TestQueryHistogram(t *testing.T) {
+	client := &fakeStatsClient{supported: true, messages: []LogMessage{{Timestamp: time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)}}}
+	query := HistogramQuery{Query: Query{MaxResults: 10, EqualityFilters: []EqualityFilter{{"service", "!=", "x"}}}, Interval: time.Minute}
+	if buckets, err := QueryHistogram(context.Background(), client, query); err != nil || buckets[0].Count != 42 {
+		t.Errorf("Expected a native histogram, got %+v (%v)", buckets, err)
+	}
+	client.supported = false
+	if buckets, err := QueryHistogram(context.Background(), client, query); err != nil || buckets[0].Count != 1 {
+		t.Errorf("Expected a client-side histogram, got %+v (%v)", buckets, err)
+	}
+}
+
+func TestQueryHistogramLimited(t *testing.T) {
+	start := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	client := &fakeStatsClient{messages: []LogMessage{
+		{ID: "1", Timestamp: start}, {ID: "2", Timestamp: start.Add(5 * time.Minute)}, {ID: "3", Timestamp: start.Add(10 * time.Minute)},
+	}}
+	after, before := start.Add(-10*time.Minute), start.Add(15*time.Minute)
+	query := HistogramQuery{Query: Query{MaxResults: 2, After: &after, Before: &before, EqualityFilters: []EqualityFilter{{"service", "!=", "x"}}}, Interval: time.Minute}
+	buckets, err := QueryHistogram(context.Background(), client, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the two most recent messages were counted, so the buckets before those are left out
+	if len(buckets) != 10 || !buckets[0].Start.Equal(start.Add(5*time.Minute)) || buckets[0].Count != 1 || buckets[5].Count != 1 {
+		t.Errorf("Expected buckets from the oldest counted message, got %+v", buckets)
+	}
+}
@@ -0,0 +1,159 @@
+package common
+
+import (
+	"container/heap"
+	"context"
+	"time"
+)
+
+// How long messages are held in follow mode to be ordered with messages from other sources
+const FollowReorderWindow = 2 * time.Second
+
+type pendingMessage struct {
+	message LogMessage
+	source  int
+	arrived time.Time
+}
+
+type pendingHeap []pendingMessage
+
+func (h pendingHeap) Len() int { return len(h) }
+func (h pendingHeap) Less(i, j int) bool {
+	return h[i].message.Timestamp.Before(h[j].message.Timestamp)
+}
+func (h pendingHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *pendingHeap) Push(x interface{}) {
+	*h = append(*h, x.(pendingMessage))
+}
+func (h *pendingHeap) Pop() interface{} {
+	old := *h
+	n := len(old) - 1
+	p := old[n]
+	*h = old[:n]
+	return p
+}
+
+type receivedMessage struct {
+	source  int
+	message LogMessage
+	closed  bool
+}
+
+// MergeByTimestamp merges messages from sources that each send their messages ordered by timestamp
+// into one stream ordered by timestamp (a k-way merge). Sources can be added until sources is closed.
+// The oldest pending message is sent once no source can send an older one, which is when no more
+// sources can be added and every source that is still open has a message pending. As sources may stay
+// quiet for a long time in follow mode, a message is also sent once it has been pending for window
+// (if not 0), so messages arriving more than window apart may end up out of order.
+func MergeByTimestamp(ctx context.Context, sources <-chan (<-chan LogMessage), window time.Duration) <-chan LogMessage {
+	resultChan := make(chan LogMessage)
+	in := make(chan receivedMessage)
+	forward := func(i int, source <-chan LogMessage) {
+		for message := range source {
+			select {
+			case in <- receivedMessage{source: i, message: message}:
+			case <-ctx.Done():
+				return
+			}
+		}
+		select {
+		case in <- receivedMessage{source: i, closed: true}:
+		case <-ctx.Done():
+		}
+	}
+	go func() {
+		defer close(resultChan)
+		pending := &pendingHeap{}
+		pendingCount := make([]int, 0)
+		closed := make([]bool, 0)
+		open := 0
+		ready := func() bool {
+			if pending.Len() == 0 {
+				return false
+			}
+			if window > 0 && time.Since((*pending)[0].arrived) >= window {
+				return true
+			}
+			if sources != nil {
+				return false
+			}
+			for i := range closed {
+				if !closed[i] && pendingCount[i] == 0 {
+					return false
+				}
+			}
+			return true
+		}
+		for {
+			for ready() {
+				p := heap.Pop(pending).(pendingMessage)
+				pendingCount[p.source]--
+				if !SendMessage(ctx, resultChan, p.message) {
+					return
+				}
+			}
+			if sources == nil && open == 0 {
+				return
+			}
+			var timeout <-chan time.Time
+			if window > 0 && pending.Len() > 0 {
+				timeout = time.After(window - time.Since((*pending)[0].arrived))
+			}
+			select {
+			case source, ok := <-sources:
+				if !ok {
+					sources = nil
+					continue
+				}
+				pendingCount = append(pendingCount, 0)
+				closed = append(closed, false)
+				open++
+				go forward(len(closed)-1, source)
+			case r := <-in:
+				if r.closed {
+					closed[r.source] = true
+					open--
+				} else {
+					heap.Push(pending, pendingMessage{r.message, r.source, time.Now()})
+					pendingCount[r.source]++
+				}
+			case <-timeout:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return resultChan
+}
+
+// MergeSources merges a fixed set of sources by timestamp, see MergeByTimestamp
+func MergeSources(ctx context.Context, sources []<-chan LogMessage, window time.Duration) <-chan LogMessage {
+	sourceChan := make(chan (<-chan LogMessage), len(sources))
+	for _, source := range sources {
+		sourceChan <- source
+	}
+	close(sourceChan)
+	return MergeByTimestamp(ctx, sourceChan, window)
+}
+
+// MostRecent sends the maxResults most recent (last) messages once messages is closed,
+// to limit the number of results of a query merging multiple sources
+func MostRecent(ctx context.Context, messages <-chan LogMessage, maxResults int) <-chan LogMessage {
+	resultChan := make(chan LogMessage)
+	go func() {
+		defer close(resultChan)
+		recent := make([]LogMessage, 0, maxResults)
+		for message := range messages {
+			recent = append(recent, message)
+			if len(recent) > maxResults {
+				recent = recent[1:]
+			}
+		}
+		for _, message := range recent {
+			if !SendMessage(ctx, resultChan, message) {
+				return
+			}
+		}
+	}()
+	return resultChan
+}
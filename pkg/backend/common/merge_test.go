@@ -0,0 +1,93 @@
+package common
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func messageAt(second int, text string) LogMessage {
+	message := NewLogMessage()
+	message.Timestamp = time.Date(2018, 10, 1, 12, 0, second, 0, time.UTC)
+	message.Attributes["message"] = text
+	return message
+}
+
+func sourceOf(messages ...LogMessage) <-chan LogMessage {
+	source := make(chan LogMessage, len(messages))
+	for _, message := range messages {
+		source <- message
+	}
+	close(source)
+	return source
+}
+
+func collectTexts(messages <-chan LogMessage) string {
+	texts := make([]string, 0)
+	for message := range messages {
+		texts = append(texts, message.Attributes["message"].(string))
+	}
+	return strings.Join(texts, " ")
+}
+
+func TestMergeSources(t *testing.T) {
+	merged := MergeSources(context.Background(), []<-chan LogMessage{
+		sourceOf(messageAt(1, "a"), messageAt(4, "d"), messageAt(7, "g")),
+		sourceOf(),
+		sourceOf(messageAt(2, "b"), messageAt(3, "c")),
+		sourceOf(messageAt(5, "e"), messageAt(6, "f")),
+	}, 0)
+	if output := collectTexts(merged); output != "a b c d e f g" {
+		t.Errorf("Unexpected order: %s", output)
+	}
+	if output := collectTexts(MergeSources(context.Background(), nil, 0)); output != "" {
+		t.Errorf("Expected no messages without sources, got %s", output)
+	}
+}
+
+func TestMergeByTimestampAddingSources(t *testing.T) {
+	sources := make(chan (<-chan LogMessage))
+	merged := MergeByTimestamp(context.Background(), sources, 0)
+	sources <- sourceOf(messageAt(3, "c"))
+	// Nothing can be sent while more sources can be added, as they might have older messages
+	select {
+	case message := <-merged:
+		t.Fatalf("Unexpected message before all sources were added: %+v", message)
+	case <-time.After(10 * time.Millisecond):
+	}
+	sources <- sourceOf(messageAt(1, "a"), messageAt(2, "b"))
+	close(sources)
+	if output := collectTexts(merged); output != "a b c" {
+		t.Errorf("Unexpected order: %s", output)
+	}
+}
+
+func TestMergeByTimestampWindow(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	quiet := make(chan LogMessage)
+	busy := make(chan LogMessage)
+	merged := MergeSources(ctx, []<-chan LogMessage{quiet, busy}, 20*time.Millisecond)
+	busy <- messageAt(2, "b")
+	busy <- messageAt(1, "out of order")
+	start := time.Now()
+	for _, expected := range []string{"out of order", "b"} {
+		if message := <-merged; message.Attributes["message"] != expected {
+			t.Errorf("Expected %s, got %+v", expected, message)
+		}
+	}
+	if waited := time.Since(start); waited < 20*time.Millisecond {
+		t.Errorf("Expected messages to be held for the window, got %s", waited)
+	}
+	cancel()
+	for range merged {
+	}
+}
+
+func TestMostRecent(t *testing.T) {
+	messages := sourceOf(messageAt(1, "a"), messageAt(2, "b"), messageAt(3, "c"))
+	if output := collectTexts(MostRecent(context.Background(), messages, 2)); output != "b c" {
+		t.Errorf("Unexpected messages: %s", output)
+	}
+}
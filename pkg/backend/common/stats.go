@@ -0,0 +1,143 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Percentiles computed for every metric
+var StatsPercentiles = []float64{50, 95, 99}
+
+type StatsQuery struct {
+	Query
+	GroupBy   []string // Fields to count messages by, messages without all of them aren't counted
+	Metrics   []string // Numeric fields to compute statistics over
+	MaxGroups int      // Maximum number of groups, the largest are kept
+}
+
+// MetricStats holds the statistics of a numeric field, over the messages that have a numeric value for it
+type MetricStats struct {
+	Count       int
+	Min         float64
+	Max         float64
+	Avg         float64
+	Percentiles map[float64]float64 // By percentile, see StatsPercentiles
+}
+
+type StatsGroup struct {
+	Key     []string // Values of the query's GroupBy fields
+	Count   int
+	Metrics map[string]MetricStats
+}
+
+// StatsClient is implemented by clients that can compute statistics natively
+type StatsClient interface {
+	Stats(ctx context.Context, query StatsQuery) ([]StatsGroup, error)
+}
+
+// Sorts groups by count (largest first), then by key, and keeps the maxGroups largest
+func SortStatsGroups(groups []StatsGroup, maxGroups int) []StatsGroup {
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		return strings.Join(groups[i].Key, "\x00") < strings.Join(groups[j].Key, "\x00")
+	})
+	if maxGroups > 0 && len(groups) > maxGroups {
+		groups = groups[:maxGroups]
+	}
+	return groups
+}
+
+type statsAccumulator struct {
+	group  StatsGroup
+	values map[string][]float64
+}
+
+// Nearest-rank percentile of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func computeMetricStats(values []float64) MetricStats {
+	sort.Float64s(values)
+	sum := 0.0
+	for _, value := range values {
+		sum += value
+	}
+	stats := MetricStats{
+		Count:       len(values),
+		Min:         values[0],
+		Max:         values[len(values)-1],
+		Avg:         sum / float64(len(values)),
+		Percentiles: make(map[float64]float64),
+	}
+	for _, p := range StatsPercentiles {
+		stats.Percentiles[p] = percentile(values, p)
+	}
+	return stats
+}
+
+// AggregateMessages computes the statistics of a query client-side, over all messages
+func AggregateMessages(messages <-chan LogMessage, query StatsQuery) []StatsGroup {
+	accumulators := make(map[string]*statsAccumulator)
+	for message := range messages {
+		key := make([]string, 0, len(query.GroupBy))
+		for _, field := range query.GroupBy {
+			value, ok := message.Attributes[field]
+			if !ok || value == nil {
+				break
+			}
+			key = append(key, fmt.Sprintf("%v", value))
+		}
+		if len(key) < len(query.GroupBy) {
+			continue
+		}
+		keyString := strings.Join(key, "\x00")
+		accumulator, ok := accumulators[keyString]
+		if !ok {
+			accumulator = &statsAccumulator{StatsGroup{Key: key}, make(map[string][]float64)}
+			accumulators[keyString] = accumulator
+		}
+		accumulator.group.Count++
+		for _, metric := range query.Metrics {
+			if value, ok := ParseNumber(message.Attributes[metric]); ok {
+				accumulator.values[metric] = append(accumulator.values[metric], value)
+			}
+		}
+	}
+	groups := make([]StatsGroup, 0, len(accumulators))
+	for _, accumulator := range accumulators {
+		accumulator.group.Metrics = make(map[string]MetricStats)
+		for metric, values := range accumulator.values {
+			accumulator.group.Metrics[metric] = computeMetricStats(values)
+		}
+		groups = append(groups, accumulator.group)
+	}
+	return SortStatsGroups(groups, query.MaxGroups)
+}
+
+// QueryStats computes the statistics of a query natively if the client supports that (and all of the
+// query's filters), and otherwise client-side, over the query.MaxResults most recent messages,
+// warning if there are more
+func QueryStats(ctx context.Context, client Client, query StatsQuery) ([]StatsGroup, error) {
+	if statsClient, ok := client.(StatsClient); ok {
+		if _, remainder := SplitQuery(client, query.Query); len(remainder) == 0 {
+			return statsClient.Stats(ctx, query)
+		}
+	}
+	messageQuery := query.Query
+	messageQuery.Follow = false
+	messageQuery.SelectFields = nil
+	var counter messageCounter
+	groups := AggregateMessages(counter.pass(QueryWithFallback(ctx, client, messageQuery)), query)
+	counter.warnIfLimited(messageQuery.MaxResults, "aggregated")
+	return groups, nil
+}
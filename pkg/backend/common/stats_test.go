@@ -0,0 +1,105 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func statsMessage(attributes map[string]interface{}) LogMessage {
+	return LogMessage{Attributes: attributes}
+}
+
+func TestAggregateMessages(t *testing.T) {
+	messages := make(chan LogMessage, 100)
+	for i := 1; i <= 20; i++ {
+		messages <- statsMessage(map[string]interface{}{"service": "orders", "level": "info", "duration_ms": float64(i)})
+	}
+	messages <- statsMessage(map[string]interface{}{"service": "orders", "level": "error", "duration_ms": "100"})
+	messages <- statsMessage(map[string]interface{}{"service": "orders", "level": "error", "duration_ms": "n/a"})
+	messages <- statsMessage(map[string]interface{}{"service": "payments", "level": "error"})
+	messages <- statsMessage(map[string]interface{}{"level": "error"}) // No service, not counted
+	close(messages)
+	groups := AggregateMessages(messages, StatsQuery{GroupBy: []string{"service", "level"}, Metrics: []string{"duration_ms"}})
+	if len(groups) != 3 {
+		t.Fatalf("Expected 3 groups, got %+v", groups)
+	}
+	info := groups[0]
+	if !reflect.DeepEqual(info.Key, []string{"orders", "info"}) || info.Count != 20 {
+		t.Errorf("Unexpected largest group: %+v", info)
+	}
+	expected := MetricStats{Count: 20, Min: 1, Max: 20, Avg: 10.5, Percentiles: map[float64]float64{50: 10, 95: 19, 99: 20}}
+	if !reflect.DeepEqual(info.Metrics["duration_ms"], expected) {
+		t.Errorf("Unexpected metrics: %+v", info.Metrics["duration_ms"])
+	}
+	errors := groups[1]
+	if !reflect.DeepEqual(errors.Key, []string{"orders", "error"}) || errors.Count != 2 || errors.Metrics["duration_ms"].Count != 1 {
+		t.Errorf("Expected non-numeric values to be counted, but not used for metrics: %+v", errors)
+	}
+	if payments := groups[2]; len(payments.Metrics) != 0 {
+		t.Errorf("Expected no metrics without values: %+v", payments)
+	}
+}
+
+func TestAggregateMessagesMaxGroups(t *testing.T) {
+	messages := make(chan LogMessage, 10)
+	for _, service := range []string{"b", "a", "c", "c", "a", "c"} {
+		messages <- statsMessage(map[string]interface{}{"service": service})
+	}
+	close(messages)
+	groups := AggregateMessages(messages, StatsQuery{GroupBy: []string{"service"}, MaxGroups: 2})
+	if len(groups) != 2 || groups[0].Key[0] != "c" || groups[1].Key[0] != "a" {
+		t.Errorf("Expected the two largest groups, got %+v", groups)
+	}
+}
+
+type fakeStatsClient struct {
+	supported bool
+	messages  []LogMessage
+}
+
+func (client *fakeStatsClient) Query(ctx context.Context, query Query) <-chan LogMessage {
+	resultChan := make(chan LogMessage, len(client.messages))
+	for _, message := range client.messages {
+		resultChan <- message
+	}
+	close(resultChan)
+	return resultChan
+}
+
+func (client *fakeStatsClient) SupportsFilter(filter FilterExpression) bool {
+	return client.supported
+}
+
+func (client *fakeStatsClient) Stats(ctx context.Context, query StatsQuery) ([]StatsGroup, error) {
+	return []StatsGroup{{Key: []string{"native"}, Count: 42}}, nil
+}
+
+func TestQueryStats(t *testing.T) {
+	client := &fakeStatsClient{supported: true, messages: []LogMessage{statsMessage(map[string]interface{}{"service": "fallback"})}}
+	query := StatsQuery{Query: Query{MaxResults: 10, EqualityFilters: []EqualityFilter{{"service", "!=", "x"}}}, GroupBy: []string{"service"}}
+	if groups, err := QueryStats(context.Background(), client, query); err != nil || groups[0].Key[0] != "native" {
+		t.Errorf("Expected native statistics, got %+v (%v)", groups, err)
+	}
+	// Filters the client can't evaluate require aggregating client-side
+	client.supported = false
+	if groups, err := QueryStats(context.Background(), client, query); err != nil || groups[0].Key[0] != "fallback" {
+		t.Errorf("Expected client-side statistics, got %+v (%v)", groups, err)
+	}
+}
+
+func TestQueryStatsLimited(t *testing.T) {
+	messages := make([]LogMessage, 0, 3)
+	for i := 0; i < 3; i++ {
+		message := statsMessage(map[string]interface{}{"service": "api"})
+		message.ID = fmt.Sprint(i)
+		messages = append(messages, message)
+	}
+	client := &fakeStatsClient{messages: messages}
+	query := StatsQuery{Query: Query{MaxResults: 2, EqualityFilters: []EqualityFilter{{"service", "!=", "x"}}}, GroupBy: []string{"service"}}
+	groups, err := QueryStats(context.Background(), client, query)
+	if err != nil || len(groups) != 1 || groups[0].Count != 2 {
+		t.Errorf("Expected the 2 most recent messages to be aggregated, got %+v (%v)", groups, err)
+	}
+}
@@ -25,6 +25,9 @@ func GetRunningContainers(pattern string) []string {
 		log.Printf("Retrieving all containers failed: %v\n", err)
 		return []string{}
 	}
+	if strings.TrimSpace(string(allContainers)) == "" {
+		return []string{}
+	}
 	return strings.Split(strings.TrimSpace(string(allContainers)), "\n")
 }
 
@@ -32,33 +35,41 @@ func DockerHintAction() []string {
 	return GetRunningContainers("")
 }
 
-func (client *DockerClient) ImplementsAdvancedFilters() bool {
+func (client *DockerClient) SupportsFilter(filter common.FilterExpression) bool {
 	return true
 }
 
-func (client *DockerClient) Query(ctx context.Context, query common.Query) <-chan common.LogMessage {
+// Adds a @container attribute to all messages
+func tagMessages(ctx context.Context, containerName string, messages <-chan common.LogMessage) <-chan common.LogMessage {
 	resultChan := make(chan common.LogMessage)
-	runningCommands := 0
+	go func() {
+		defer close(resultChan)
+		for message := range messages {
+			message.Attributes["@container"] = containerName
+			if !common.SendMessage(ctx, resultChan, message) {
+				return
+			}
+		}
+	}()
+	return resultChan
+}
+
+func (client *DockerClient) Query(ctx context.Context, query common.Query) <-chan common.LogMessage {
+	sources := make([]<-chan common.LogMessage, 0)
 	for _, containerName := range GetRunningContainers(client.containerPattern) {
-		command := []string{"docker", "logs", "--tail", fmt.Sprintf("%d", query.MaxResults)}
+		// Lines without a timestamp of their own would otherwise get the time they were read, and be merged by that
+		command := []string{"docker", "logs", "--timestamps", "--tail", fmt.Sprintf("%d", query.MaxResults)}
 		if query.Follow {
 			command = append(command, "-f")
 		}
 		command = append(command, containerName)
-		client := subprocess.New(command)
-		runningCommands++
-		go func() {
-			for message := range client.Query(ctx, query) {
-				message.Attributes["@container"] = containerName
-				resultChan <- message
-			}
-			runningCommands--
-			if runningCommands == 0 {
-				close(resultChan)
-			}
-		}()
+		sources = append(sources, tagMessages(ctx, containerName, subprocess.NewTimestamped(command).Query(ctx, query)))
 	}
-	return resultChan
+	if query.Follow {
+		return common.MergeSources(ctx, sources, common.FollowReorderWindow)
+	}
+	// Every container returns its query.MaxResults most recent messages, keep the most recent of all of those
+	return common.MostRecent(ctx, common.MergeSources(ctx, sources, 0), query.MaxResults)
 }
 
 func New(containerPattern string) *DockerClient {
@@ -0,0 +1,191 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+)
+
+// Client talks to Elasticsearch's _search API directly
+type Client struct {
+	URL        string
+	AuthHeader string // e.g. "Basic dXNlcjpwYXNz" or "ApiKey Zm9vOmJhcg=="
+	Index      string // Index name or pattern, e.g. "logs-*"
+}
+
+func New(url, authHeader, index string) *Client {
+	return &Client{
+		URL:        url,
+		AuthHeader: authHeader,
+		Index:      index,
+	}
+}
+
+func (client *Client) SupportsFilter(filter common.FilterExpression) bool {
+	return SupportsFilter(filter)
+}
+
+func (client *Client) addHeaders(req *http.Request) {
+	if client.AuthHeader != "" {
+		req.Header.Set("Authorization", client.AuthHeader)
+	}
+	req.Header.Set("Content-Type", "application/json")
+}
+
+func (client *Client) get(path string) (*http.Response, error) {
+	return client.send(context.Background(), "GET", path, nil)
+}
+
+func (client *Client) send(ctx context.Context, method, path string, requestBody JsonObject) (*http.Response, error) {
+	var body io.Reader
+	if requestBody != nil {
+		buf, err := json.Marshal(requestBody)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(buf)
+	}
+	req, err := http.NewRequest(method, fmt.Sprintf("%s/%s", client.URL, path), body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	client.addHeaders(req)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+		return nil, errors.New("Authentication failed")
+	}
+	return resp, nil
+}
+
+func (client *Client) post(ctx context.Context, searchBody JsonObject) (*http.Response, error) {
+	if _, ok := searchBody["pit"]; ok {
+		// A point in time already determines the indices to search
+		return client.send(ctx, "POST", "_search", searchBody)
+	}
+	return client.send(ctx, "POST", fmt.Sprintf("%s/_search?ignore_unavailable=true", client.Index), searchBody)
+}
+
+// Search performs a single search against the index (pattern) or point in time,
+// calling emit for every hit as it is decoded from the response
+func (client *Client) Search(ctx context.Context, searchBody JsonObject, emit func(Hit) bool) (string, error) {
+	resp, err := client.post(ctx, searchBody)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	pitID, err := DecodeSearchHits(resp.Body, emit)
+	if err != nil {
+		return "", fmt.Errorf("%v (%s)", err, resp.Status)
+	}
+	return pitID, nil
+}
+
+// OpenPointInTime opens a point in time of the index (pattern) to page through consistently
+func (client *Client) OpenPointInTime(ctx context.Context, keepAlive string) (string, error) {
+	resp, err := client.send(ctx, "POST", fmt.Sprintf("%s/_pit?keep_alive=%s&ignore_unavailable=true", client.Index, keepAlive), nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New(resp.Status)
+	}
+	var data struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return "", err
+	}
+	return data.ID, nil
+}
+
+func (client *Client) ClosePointInTime(ctx context.Context, id string) error {
+	resp, err := client.send(ctx, "DELETE", "_pit", JsonObject{"id": id})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
+
+// Aggregate performs a single search against the index (pattern), returning its aggregations
+func (client *Client) Aggregate(ctx context.Context, searchBody JsonObject) (JsonObject, error) {
+	resp, err := client.post(ctx, searchBody)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	aggregations, err := DecodeAggregations(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%v (%s)", err, resp.Status)
+	}
+	return aggregations, nil
+}
+
+func (client *Client) Query(ctx context.Context, q common.Query) <-chan common.LogMessage {
+	if !q.Follow {
+		fmt.Fprintf(os.Stderr, "Querying index %s\n", client.Index)
+	}
+	return Query(ctx, client, "Elasticsearch", q)
+}
+
+func (client *Client) Stats(ctx context.Context, q common.StatsQuery) ([]common.StatsGroup, error) {
+	return Stats(ctx, client, q)
+}
+
+func (client *Client) Histogram(ctx context.Context, q common.HistogramQuery) ([]common.HistogramBucket, error) {
+	return Histogram(ctx, client, q)
+}
+
+// ListIndices lists the names of all indices and aliases, to pick one (or a pattern) from
+func (client *Client) ListIndices() ([]string, error) {
+	indexNames := make([]string, 0, 20)
+	for _, path := range []string{"_cat/indices?format=json&h=index", "_cat/aliases?format=json&h=alias"} {
+		resp, err := client.get(path)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusUnauthorized {
+			return nil, errors.New("Authentication failed")
+		} else if resp.StatusCode != http.StatusOK {
+			return nil, errors.New(resp.Status)
+		}
+		var data []struct {
+			Index string `json:"index"`
+			Alias string `json:"alias"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+			return nil, err
+		}
+		for _, entry := range data {
+			if entry.Index != "" {
+				indexNames = append(indexNames, entry.Index)
+			} else if entry.Alias != "" {
+				indexNames = append(indexNames, entry.Alias)
+			}
+		}
+	}
+	return indexNames, nil
+}
+
+var _ common.Client = &Client{}
+var _ Searcher = &Client{}
+var _ common.StatsClient = &Client{}
+var _ common.HistogramClient = &Client{}
@@ -0,0 +1,268 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+)
+
+type fakeDocument struct {
+	id string
+	ts int64 // epoch millis
+}
+
+type fakeRequests struct {
+	pitUnsupported bool // Like Elasticsearch before 7.10
+	searches       int
+	pitRequests    int
+	openPITs       map[string]bool
+	closedPIT      bool
+}
+
+// A minimal stand-in for Elasticsearch 8's _search that only implements points in time, sorting (rejecting
+// _id like Elasticsearch 8 does), size, search_after and the epoch_millis cutoff range used for paging.
+// A document's _shard_doc is its position in docs.
+func newFakeElasticsearch(t *testing.T, docs []fakeDocument, requests *fakeRequests) *httptest.Server {
+	requests.openPITs = make(map[string]bool)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "ApiKey secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/logs-*/_pit" && r.URL.Query().Get("keep_alive") != "":
+			requests.pitRequests++
+			if requests.pitUnsupported {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(JsonObject{"error": JsonObject{"reason": "request [/logs-*/_pit] contains unrecognized parameter: [keep_alive]"}, "status": 400})
+				return
+			}
+			id := fmt.Sprintf("pit-%d", len(requests.openPITs)+1)
+			requests.openPITs[id] = true
+			json.NewEncoder(w).Encode(JsonObject{"id": id})
+			return
+		case r.Method == "DELETE" && r.URL.Path == "/_pit":
+			var body struct {
+				ID string `json:"id"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			if !requests.openPITs[body.ID] {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			delete(requests.openPITs, body.ID)
+			requests.closedPIT = true
+			json.NewEncoder(w).Encode(JsonObject{"succeeded": true})
+			return
+		case r.Method != "POST" || (r.URL.Path != "/_search" && r.URL.Path != "/logs-*/_search"):
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		requests.searches++
+		var body struct {
+			Size        int           `json:"size"`
+			Sort        []JsonObject  `json:"sort"`
+			SearchAfter []interface{} `json:"search_after"`
+			Query       JsonObject    `json:"query"`
+			PIT         *struct {
+				ID string `json:"id"`
+			} `json:"pit"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if (body.PIT != nil) != (r.URL.Path == "/_search") || (body.PIT != nil && !requests.openPITs[body.PIT.ID]) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(JsonObject{"error": JsonObject{"reason": "invalid point in time"}, "status": 400})
+			return
+		}
+		for _, spec := range body.Sort {
+			if _, ok := spec["_id"]; ok {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(JsonObject{"error": JsonObject{
+					"reason": "Fielddata access on the _id field is disallowed, you can re-enable it by updating the dynamic cluster setting: indices.id_field_data.enabled",
+				}, "status": 400})
+				return
+			}
+		}
+		if len(body.Sort) > 1 {
+			if _, ok := body.Sort[1]["_shard_doc"]; !ok || body.PIT == nil {
+				t.Errorf("Unexpected tiebreaker: %v", body.Sort[1])
+			}
+		}
+		desc := body.Sort[0]["@timestamp"].(map[string]interface{})["order"] == "desc"
+		var gte int64
+		if must, ok := body.Query["bool"].(map[string]interface{})["must"].([]interface{}); ok && len(must) == 2 {
+			if rangeObj, ok := must[1].(map[string]interface{})["range"]; ok {
+				if cutoff, ok := rangeObj.(map[string]interface{})["@timestamp"].(map[string]interface{})["gte"].(float64); ok {
+					gte = int64(cutoff)
+				}
+			}
+		}
+		type sortValues struct {
+			ts       int64
+			shardDoc int
+		}
+		less := func(a, b sortValues) bool {
+			if a.ts != b.ts {
+				return a.ts < b.ts
+			}
+			return a.shardDoc < b.shardDoc
+		}
+		sorted := make([]sortValues, 0, len(docs))
+		for i, doc := range docs {
+			if doc.ts >= gte {
+				sorted = append(sorted, sortValues{doc.ts, i})
+			}
+		}
+		if desc {
+			sort.Slice(sorted, func(i, j int) bool { return less(sorted[j], sorted[i]) })
+		} else {
+			sort.Slice(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+		}
+		hits := make([]JsonObject, 0, body.Size)
+		for _, values := range sorted {
+			if len(body.SearchAfter) == 1 {
+				after := int64(body.SearchAfter[0].(float64))
+				if (desc && values.ts >= after) || (!desc && values.ts <= after) {
+					continue
+				}
+			} else if body.SearchAfter != nil {
+				after := sortValues{int64(body.SearchAfter[0].(float64)), int(body.SearchAfter[1].(float64))}
+				if (desc && !less(values, after)) || (!desc && !less(after, values)) {
+					continue
+				}
+			}
+			if len(hits) >= body.Size {
+				break
+			}
+			doc := docs[values.shardDoc]
+			sortValues := JsonList{doc.ts}
+			if body.PIT != nil {
+				sortValues = append(sortValues, values.shardDoc)
+			}
+			hits = append(hits, JsonObject{
+				"_id": doc.id,
+				"_source": JsonObject{
+					"@timestamp": time.Unix(0, doc.ts*int64(time.Millisecond)).UTC().Format(time.RFC3339Nano),
+					"message":    "Message " + doc.id,
+				},
+				"sort": sortValues,
+			})
+		}
+		response := JsonObject{
+			"hits": JsonObject{"hits": hits},
+		}
+		if body.PIT != nil {
+			response["pit_id"] = body.PIT.ID
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+}
+
+// Three documents share every timestamp, so the page boundaries and the cutoff fall within a timestamp
+func newPagingDocuments() []fakeDocument {
+	docs := make([]fakeDocument, 0, 2500)
+	for i := 0; i < 2500; i++ {
+		docs = append(docs, fakeDocument{id: fmt.Sprintf("%05d", i), ts: int64(1538395200000 + i/3)})
+	}
+	return docs
+}
+
+func queryPaging(t *testing.T, requests *fakeRequests, maxResults int) []common.LogMessage {
+	server := newFakeElasticsearch(t, newPagingDocuments(), requests)
+	defer server.Close()
+	client := New(server.URL, "ApiKey secret", "logs-*")
+
+	messages := make([]common.LogMessage, 0, maxResults)
+	for message := range client.Query(context.Background(), common.Query{MaxResults: maxResults}) {
+		messages = append(messages, message)
+	}
+	if len(messages) != maxResults {
+		t.Fatalf("Expected %d messages, got %d", maxResults, len(messages))
+	}
+	ids := make(map[string]bool)
+	for i, message := range messages {
+		if i > 0 && message.Timestamp.Before(messages[i-1].Timestamp) {
+			t.Fatalf("Messages out of order at %d", i)
+		}
+		if ids[message.ID] {
+			t.Fatalf("Duplicate message %s", message.ID)
+		}
+		ids[message.ID] = true
+	}
+	if last := messages[len(messages)-1].ID; last != "02499" {
+		t.Errorf("Expected last message to be 02499, got %s", last)
+	}
+	return messages
+}
+
+func TestQueryPaging(t *testing.T) {
+	var requests fakeRequests
+	messages := queryPaging(t, &requests, 1500)
+	// The 1500 most recent documents are 1000-2499, with 1000 and 1001 sharing their timestamp with 999
+	if first := messages[0].Timestamp; !first.Equal(time.Unix(0, (1538395200000+333)*int64(time.Millisecond))) {
+		t.Errorf("Unexpected first timestamp %s", first)
+	}
+	if requests.searches <= 2 {
+		t.Errorf("Expected multiple pages to be requested, got %d searches", requests.searches)
+	}
+	if !requests.closedPIT || len(requests.openPITs) != 0 {
+		t.Errorf("Expected the point in time to be closed, still open: %v", requests.openPITs)
+	}
+}
+
+func TestQueryPagingWithoutPointInTime(t *testing.T) {
+	requests := fakeRequests{pitUnsupported: true}
+	messages := queryPaging(t, &requests, 1500)
+	if first := messages[0].Timestamp; !first.Equal(time.Unix(0, (1538395200000+333)*int64(time.Millisecond))) {
+		t.Errorf("Unexpected first timestamp %s", first)
+	}
+	if requests.pitRequests != 1 || requests.searches <= 2 {
+		t.Errorf("Expected multiple pages after failing to open a point in time, got %d searches", requests.searches)
+	}
+}
+
+func TestQuerySinglePage(t *testing.T) {
+	var requests fakeRequests
+	queryPaging(t, &requests, 50)
+	if requests.searches != 1 || requests.pitRequests != 0 {
+		t.Errorf("Expected a single search without a point in time, got %d searches and %d points in time", requests.searches, requests.pitRequests)
+	}
+}
+
+func TestListIndices(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "ax" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/_cat/indices":
+			w.Write([]byte(`[{"index": "logs-2018.10.01"}, {"index": "logs-2018.10.02"}]`))
+		case "/_cat/aliases":
+			w.Write([]byte(`[{"alias": "logs"}]`))
+		}
+	}))
+	defer server.Close()
+	if _, err := New(server.URL, "", "").ListIndices(); err == nil || err.Error() != "Authentication failed" {
+		t.Errorf("Expected authentication to fail, got %v", err)
+	}
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.SetBasicAuth("ax", "secret")
+	indices, err := New(server.URL, req.Header.Get("Authorization"), "").ListIndices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(indices) != "[logs-2018.10.01 logs-2018.10.02 logs]" {
+		t.Errorf("Unexpected indices: %v", indices)
+	}
+}
@@ -0,0 +1,181 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+)
+
+// DecodeSearchHits walks a _search response token by token and decodes its hits one at a time,
+// calling emit for each, so that hits can be processed while the response is still being received,
+// without holding all of it in memory. Decoding stops early when emit returns false.
+// When searching a point in time, this returns the point in time ID to use for the next search.
+func DecodeSearchHits(r io.Reader, emit func(Hit) bool) (string, error) {
+	return decodeResponse(json.NewDecoder(r), emit)
+}
+
+// DecodeMultiSearchHits is like DecodeSearchHits, but for the first response of an _msearch response
+func DecodeMultiSearchHits(r io.Reader, emit func(Hit) bool) (string, error) {
+	var pitID string
+	err := decodeFirstResponse(r, func(decoder *json.Decoder) error {
+		var err error
+		pitID, err = decodeResponse(decoder, emit)
+		return err
+	})
+	return pitID, err
+}
+
+// DecodeAggregations decodes the aggregations of a _search response
+func DecodeAggregations(r io.Reader) (JsonObject, error) {
+	return decodeAggregationsResponse(json.NewDecoder(r))
+}
+
+// DecodeMultiSearchAggregations is like DecodeAggregations, but for the first response of an _msearch response
+func DecodeMultiSearchAggregations(r io.Reader) (JsonObject, error) {
+	var aggregations JsonObject
+	err := decodeFirstResponse(r, func(decoder *json.Decoder) error {
+		var err error
+		aggregations, err = decodeAggregationsResponse(decoder)
+		return err
+	})
+	return aggregations, err
+}
+
+func decodeFirstResponse(r io.Reader, decodeResponse func(*json.Decoder) error) error {
+	decoder := json.NewDecoder(r)
+	found := false
+	err := decodeObject(decoder, func(key string) (bool, error) {
+		if key != "responses" {
+			return true, skipValue(decoder)
+		}
+		found = true
+		if err := expectDelim(decoder, '['); err != nil {
+			return false, err
+		}
+		if !decoder.More() {
+			return false, errors.New("Empty response from Elasticsearch")
+		}
+		// We only ever send a single search, the rest of the response is irrelevant
+		return false, decodeResponse(decoder)
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.New("Unexpected response from Elasticsearch, no responses found")
+	}
+	return nil
+}
+
+func decodeError(decoder *json.Decoder) error {
+	var esError interface{}
+	if err := decoder.Decode(&esError); err != nil {
+		return err
+	}
+	return fmt.Errorf("Elasticsearch error: %s", common.MustJsonEncode(esError))
+}
+
+func decodeAggregationsResponse(decoder *json.Decoder) (JsonObject, error) {
+	var aggregations JsonObject
+	err := decodeObject(decoder, func(key string) (bool, error) {
+		switch key {
+		case "error":
+			return false, decodeError(decoder)
+		case "aggregations":
+			return false, decoder.Decode(&aggregations)
+		default:
+			return true, skipValue(decoder)
+		}
+	})
+	if err == nil && aggregations == nil {
+		return nil, errors.New("Unexpected response from Elasticsearch, no aggregations found")
+	}
+	return aggregations, err
+}
+
+func decodeResponse(decoder *json.Decoder, emit func(Hit) bool) (string, error) {
+	found := false
+	var pitID string
+	err := decodeObject(decoder, func(key string) (bool, error) {
+		switch key {
+		case "error":
+			return false, decodeError(decoder)
+		case "pit_id":
+			// Comes before the hits, which we may stop reading at
+			return true, decoder.Decode(&pitID)
+		case "hits":
+			found = true
+			return false, decodeObject(decoder, func(key string) (bool, error) {
+				if key != "hits" {
+					return true, skipValue(decoder)
+				}
+				return false, decodeHitList(decoder, emit)
+			})
+		default:
+			return true, skipValue(decoder)
+		}
+	})
+	if err == nil && !found {
+		return "", errors.New("Unexpected response from Elasticsearch, no hits found")
+	}
+	return pitID, err
+}
+
+func decodeHitList(decoder *json.Decoder, emit func(Hit) bool) error {
+	if err := expectDelim(decoder, '['); err != nil {
+		return err
+	}
+	for decoder.More() {
+		var hit Hit
+		if err := decoder.Decode(&hit); err != nil {
+			return err
+		}
+		if !emit(hit) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Reads a JSON object key by key, calling handleKey which must consume the value.
+// handleKey returns false to stop reading, in which case the rest of the object is left unread.
+func decodeObject(decoder *json.Decoder, handleKey func(key string) (bool, error)) error {
+	if err := expectDelim(decoder, '{'); err != nil {
+		return err
+	}
+	for decoder.More() {
+		t, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := t.(string)
+		if !ok {
+			return fmt.Errorf("Expected object key, got %v", t)
+		}
+		cont, err := handleKey(key)
+		if err != nil || !cont {
+			return err
+		}
+	}
+	_, err := decoder.Token()
+	return err
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	t, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := t.(json.Delim); !ok || d != delim {
+		return fmt.Errorf("Expected '%s' in Elasticsearch response, got %v", delim, t)
+	}
+	return nil
+}
+
+func skipValue(decoder *json.Decoder) error {
+	var value json.RawMessage
+	return decoder.Decode(&value)
+}
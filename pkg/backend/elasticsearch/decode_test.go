@@ -0,0 +1,101 @@
+package elasticsearch
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeMultiSearchHits(t *testing.T) {
+	response := `{"took": 5, "responses": [{"took": 5, "timed_out": false, "_shards": {"total": 1},
+		"hits": {"total": 3, "max_score": null, "hits": [
+			{"_index": "logs", "_id": "1", "_source": {"message": "One", "nested": {"hits": []}}, "sort": [1538395200000, "1"]},
+			{"_index": "logs", "_id": "2", "_source": {"message": "Two"}, "sort": [1538395200001, "2"]},
+			{"_index": "logs", "_id": "3", "_source": {"message": "Three"}, "sort": [1538395200002, "3"]}
+		]}, "status": 200}]}`
+	ids := make([]string, 0)
+	_, err := DecodeMultiSearchHits(strings.NewReader(response), func(hit Hit) bool {
+		ids = append(ids, hit.ID)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(ids, ",") != "1,2,3" {
+		t.Errorf("Unexpected hits: %v", ids)
+	}
+
+	// Stops decoding early, so a truncated response doesn't matter
+	ids = ids[:0]
+	_, err = DecodeMultiSearchHits(strings.NewReader(response[:strings.Index(response, `"_id": "3"`)]), func(hit Hit) bool {
+		ids = append(ids, hit.ID)
+		return len(ids) < 2
+	})
+	if err != nil || strings.Join(ids, ",") != "1,2" {
+		t.Errorf("Unexpected result when stopping early: %v, %v", ids, err)
+	}
+}
+
+func TestDecodeMultiSearchHitsErrors(t *testing.T) {
+	invalidResponses := []string{
+		`{"responses": [{"error": {"type": "search_phase_execution_exception"}, "status": 400}]}`,
+		`{"responses": []}`,
+		`{"statusCode": 502}`,
+		`<html>Bad Gateway</html>`,
+		`{"responses": [{"hits": {"hits": [{"_id": "1"}`,
+	}
+	for _, response := range invalidResponses {
+		_, err := DecodeMultiSearchHits(strings.NewReader(response), func(hit Hit) bool {
+			return true
+		})
+		if err == nil {
+			t.Errorf("Expected error decoding %s", response)
+		}
+	}
+}
+
+func TestDecodeSearchHits(t *testing.T) {
+	response := `{"took": 1, "timed_out": false, "hits": {"total": {"value": 2}, "hits": [
+		{"_id": "1", "_source": {"message": "One"}}, {"_id": "2", "_source": {"message": "Two"}}]}}`
+	ids := make([]string, 0)
+	_, err := DecodeSearchHits(strings.NewReader(response), func(hit Hit) bool {
+		ids = append(ids, hit.ID)
+		return true
+	})
+	if err != nil || strings.Join(ids, ",") != "1,2" {
+		t.Errorf("Unexpected result: %v, %v", ids, err)
+	}
+
+	// Searches of a point in time return the ID to use for the next search
+	pitID, err := DecodeSearchHits(strings.NewReader(`{"pit_id": "abc==", "hits": {"hits": [{"_id": "1"}]}}`), func(hit Hit) bool {
+		return false
+	})
+	if err != nil || pitID != "abc==" {
+		t.Errorf("Unexpected point in time ID: %q, %v", pitID, err)
+	}
+	for _, response := range []string{
+		`{"error": {"type": "index_not_found_exception"}, "status": 404}`,
+		`{"took": 1}`,
+	} {
+		if _, err := DecodeSearchHits(strings.NewReader(response), func(hit Hit) bool { return true }); err == nil {
+			t.Errorf("Expected error decoding %s", response)
+		}
+	}
+}
+
+func TestDecodeMultiSearchAggregations(t *testing.T) {
+	response := `{"responses": [{"took": 5, "hits": {"total": 3, "hits": []},
+		"aggregations": {"all": {"doc_count": 3}}, "status": 200}]}`
+	aggregations, err := DecodeMultiSearchAggregations(strings.NewReader(response))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := aggregations["all"].(map[string]interface{})["doc_count"]; count != 3.0 {
+		t.Errorf("Unexpected aggregations: %v", aggregations)
+	}
+	if _, err := DecodeAggregations(strings.NewReader(`{"error": {"type": "illegal_argument_exception"}}`)); err == nil {
+		t.Error("Expected an error")
+	}
+	if _, err := DecodeAggregations(strings.NewReader(`{"hits": {"hits": []}}`)); err == nil {
+		t.Error("Expected an error without aggregations")
+	}
+}
@@ -0,0 +1,60 @@
+package elasticsearch
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+)
+
+// Histogram counts the messages matching a query per interval using a date_histogram aggregation
+func Histogram(ctx context.Context, aggregator Aggregator, q common.HistogramQuery) ([]common.HistogramBucket, error) {
+	dateHistogram := JsonObject{
+		"field":          "@timestamp",
+		"fixed_interval": fmt.Sprintf("%dms", int64(q.Interval/time.Millisecond)),
+		"min_doc_count":  0,
+	}
+	// Also return the empty buckets at the ends of the query's time range
+	bounds := JsonObject{}
+	if q.After != nil {
+		bounds["min"] = unixMillis(*q.After)
+	}
+	if q.Before != nil {
+		bounds["max"] = unixMillis(*q.Before) - 1
+	}
+	if len(bounds) > 0 {
+		dateHistogram["extended_bounds"] = bounds
+	}
+	aggregations, err := aggregator.Aggregate(ctx, JsonObject{
+		"size":  0,
+		"query": queryToBoolQuery(q.Query),
+		"aggs": JsonObject{
+			"histogram": JsonObject{
+				"date_histogram": dateHistogram,
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	histogram, ok := aggregations["histogram"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Unexpected aggregations: %s", common.MustJsonEncode(aggregations))
+	}
+	rawBuckets, _ := histogram["buckets"].([]interface{})
+	buckets := make([]common.HistogramBucket, 0, len(rawBuckets))
+	for _, b := range rawBuckets {
+		bucket, _ := b.(map[string]interface{})
+		key, ok := bucket["key"].(float64)
+		if !ok {
+			return nil, fmt.Errorf("Unexpected histogram bucket: %s", common.MustJsonEncode(b))
+		}
+		count, _ := bucket["doc_count"].(float64)
+		buckets = append(buckets, common.HistogramBucket{
+			Start: time.Unix(0, int64(key)*int64(time.Millisecond)).UTC(),
+			Count: int(count),
+		})
+	}
+	return buckets, nil
+}
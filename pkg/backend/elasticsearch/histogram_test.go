@@ -0,0 +1,37 @@
+package elasticsearch
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+)
+
+func TestHistogram(t *testing.T) {
+	aggregator := &fakeAggregator{responses: []string{`{"histogram": {"buckets": [
+		{"key_as_string": "2018-10-01T12:00:00.000Z", "key": 1538395200000, "doc_count": 3},
+		{"key_as_string": "2018-10-01T12:01:00.000Z", "key": 1538395260000, "doc_count": 0}
+	]}}`}}
+	after := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	before := after.Add(2 * time.Minute)
+	buckets, err := Histogram(context.Background(), aggregator, common.HistogramQuery{
+		Query:    common.Query{After: &after, Before: &before},
+		Interval: time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []common.HistogramBucket{{Start: after, Count: 3}, {Start: after.Add(time.Minute), Count: 0}}
+	if !reflect.DeepEqual(buckets, expected) {
+		t.Errorf("Unexpected buckets: %+v", buckets)
+	}
+	dateHistogram := aggregator.bodies[0]["aggs"].(JsonObject)["histogram"].(JsonObject)["date_histogram"].(JsonObject)
+	if dateHistogram["fixed_interval"] != "60000ms" {
+		t.Errorf("Unexpected interval: %v", dateHistogram["fixed_interval"])
+	}
+	if bounds := dateHistogram["extended_bounds"].(JsonObject); bounds["min"] != int64(1538395200000) || bounds["max"] != int64(1538395319999) {
+		t.Errorf("Unexpected bounds: %v", bounds)
+	}
+}
@@ -0,0 +1,242 @@
+package elasticsearch
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+)
+
+type JsonObject map[string]interface{}
+type JsonList []interface{}
+
+// Maximum number of hits requested from Elasticsearch at once
+const PageSize = 1000
+
+type Hit struct {
+	ID     string     `json:"_id"`
+	Source JsonObject `json:"_source"`
+	Sort   JsonList   `json:"sort"`
+}
+
+// Builds the Elasticsearch bool query for all of the query's filters
+func queryToBoolQuery(query common.Query) JsonObject {
+	queryString := fmt.Sprintf("\"%s\"", query.QueryString) // TODO: Handle quotes properly
+	if query.QueryString == "" {
+		queryString = "*"
+	}
+	mustFilters := JsonList{
+		JsonObject{
+			"query_string": JsonObject{
+				"analyze_wildcard": true,
+				"query":            queryString,
+			},
+		},
+	}
+
+	if query.After != nil || query.Before != nil {
+		rangeObj := JsonObject{
+			"range": JsonObject{
+				"@timestamp": JsonObject{
+					"format": "epoch_millis",
+				},
+			},
+		}
+		if query.After != nil {
+			rangeObj["range"].(JsonObject)["@timestamp"].(JsonObject)["gt"] = unixMillis(*query.After)
+		}
+		if query.Before != nil {
+			rangeObj["range"].(JsonObject)["@timestamp"].(JsonObject)["lt"] = unixMillis(*query.Before)
+		}
+		mustFilters = append(mustFilters, rangeObj)
+	}
+	mustNotFilters := JsonList{}
+	for _, filter := range query.EqualityFilters {
+		if filter.Operator == "!=" {
+			mustNotFilters = append(mustNotFilters, matchPhrase(filter.FieldName, filter.Value))
+		} else {
+			mustFilters = append(mustFilters, equalityFilterToQuery(filter))
+		}
+	}
+	for _, filter := range query.ExistenceFilters {
+		existsObj := JsonObject{
+			"exists": JsonObject{
+				"field": filter.FieldName,
+			},
+		}
+		if filter.Exists {
+			mustFilters = append(mustFilters, existsObj)
+		} else {
+			mustNotFilters = append(mustNotFilters, existsObj)
+		}
+	}
+	for _, filter := range query.MembershipFilters {
+		if len(filter.ValidValues) > 0 {
+			mustFilters = append(mustFilters, termsQuery(filter.FieldName, filter.ValidValues))
+		}
+		if len(filter.InvalidValues) > 0 {
+			mustNotFilters = append(mustNotFilters, termsQuery(filter.FieldName, filter.InvalidValues))
+		}
+	}
+	for _, filter := range query.RegexFilters {
+		if filter.Negated {
+			mustNotFilters = append(mustNotFilters, regexpQuery(filter))
+		} else {
+			mustFilters = append(mustFilters, regexpQuery(filter))
+		}
+	}
+	if query.Filter != nil {
+		mustFilters = append(mustFilters, filterExpressionToQuery(query.Filter))
+	}
+	return JsonObject{
+		"bool": JsonObject{
+			"must":     mustFilters,
+			"must_not": mustNotFilters,
+		},
+	}
+}
+
+func sortSpec(order string) JsonList {
+	return JsonList{
+		JsonObject{
+			"@timestamp": JsonObject{
+				"order":         order,
+				"unmapped_type": "boolean",
+			},
+		},
+	}
+}
+
+func matchPhrase(fieldName, value string) JsonObject {
+	return JsonObject{
+		"match": JsonObject{
+			fieldName: JsonObject{
+				"query": value,
+				"type":  "phrase",
+			},
+		},
+	}
+}
+
+func termsQuery(fieldName string, values []string) JsonObject {
+	return JsonObject{
+		"terms": JsonObject{
+			fieldName: values,
+		},
+	}
+}
+
+var rangeOperators = map[string]string{
+	">":  "gt",
+	">=": "gte",
+	"<":  "lt",
+	"<=": "lte",
+}
+
+func equalityFilterToQuery(filter common.EqualityFilter) JsonObject {
+	switch filter.Operator {
+	case "!=":
+		return JsonObject{
+			"bool": JsonObject{
+				"must_not": JsonList{matchPhrase(filter.FieldName, filter.Value)},
+			},
+		}
+	case ">", ">=", "<", "<=":
+		var value interface{} = filter.Value
+		if n, ok := common.ParseNumber(filter.Value); ok {
+			value = n
+		}
+		return JsonObject{
+			"range": JsonObject{
+				filter.FieldName: JsonObject{
+					rangeOperators[filter.Operator]: value,
+				},
+			},
+		}
+	default:
+		return matchPhrase(filter.FieldName, filter.Value)
+	}
+}
+
+// Elasticsearch regexps are always anchored and don't support flags, so we translate
+// Go's "find anywhere" semantics by padding with .* unless explicitly anchored
+func regexpQuery(filter common.RegexFilter) JsonObject {
+	pattern, caseInsensitive := common.AnchoredPattern(filter.Regexp)
+	regexpObj := JsonObject{
+		"value": pattern,
+	}
+	if caseInsensitive {
+		regexpObj["case_insensitive"] = true
+	}
+	return JsonObject{
+		"regexp": JsonObject{
+			filter.FieldName: regexpObj,
+		},
+	}
+}
+
+// Translates a filter expression into a (nested) Elasticsearch bool query
+func filterExpressionToQuery(expr common.FilterExpression) JsonObject {
+	switch e := expr.(type) {
+	case common.AndExpression:
+		return JsonObject{
+			"bool": JsonObject{
+				"must": filterExpressionsToQueries(e.Operands),
+			},
+		}
+	case common.OrExpression:
+		return JsonObject{
+			"bool": JsonObject{
+				"should":               filterExpressionsToQueries(e.Operands),
+				"minimum_should_match": 1,
+			},
+		}
+	case common.NotExpression:
+		return JsonObject{
+			"bool": JsonObject{
+				"must_not": JsonList{filterExpressionToQuery(e.Operand)},
+			},
+		}
+	case common.EqualityFilter:
+		return equalityFilterToQuery(e)
+	case common.RegexFilter:
+		if e.Negated {
+			return JsonObject{
+				"bool": JsonObject{
+					"must_not": JsonList{regexpQuery(e)},
+				},
+			}
+		}
+		return regexpQuery(e)
+	default:
+		panic(fmt.Sprintf("Unsupported filter expression: %+v", expr))
+	}
+}
+
+func filterExpressionsToQueries(exprs []common.FilterExpression) JsonList {
+	queries := make(JsonList, 0, len(exprs))
+	for _, expr := range exprs {
+		queries = append(queries, filterExpressionToQuery(expr))
+	}
+	return queries
+}
+
+func unixMillis(t time.Time) int64 {
+	return t.Unix() * 1000
+}
+
+// Lucene regular expressions lack Perl-style character classes, assertions and flags
+// (other than a leading (?i), which we translate)
+var unsupportedRegexpSyntax = regexp.MustCompile(`\\[dDwWsSbBAzpPQE]|\(\?`)
+
+// SupportsFilter indicates whether a filter can be translated into an Elasticsearch query
+func SupportsFilter(filter common.FilterExpression) bool {
+	return common.AllFiltersSupported(filter, func(leaf common.FilterExpression) bool {
+		if f, ok := leaf.(common.RegexFilter); ok {
+			return !unsupportedRegexpSyntax.MatchString(strings.TrimPrefix(f.Regexp.String(), "(?i)"))
+		}
+		return true
+	})
+}
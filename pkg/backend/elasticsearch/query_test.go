@@ -0,0 +1,82 @@
+package elasticsearch
+
+import (
+	"testing"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+)
+
+func TestFilterExpressionToQuery(t *testing.T) {
+	expr, err := common.ParseFilterExpression("(level=error OR level=fatal) AND service!=healthcheck")
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := common.MustJsonEncode(filterExpressionToQuery(expr))
+	expected := `{"bool":{"must":[` +
+		`{"bool":{"minimum_should_match":1,"should":[{"match":{"level":{"query":"error","type":"phrase"}}},{"match":{"level":{"query":"fatal","type":"phrase"}}}]}},` +
+		`{"bool":{"must_not":[{"match":{"service":{"query":"healthcheck","type":"phrase"}}}]}}` +
+		`]}}`
+	if output != expected {
+		t.Fatal(output)
+	}
+}
+
+func TestRangeFilterToQuery(t *testing.T) {
+	output := common.MustJsonEncode(equalityFilterToQuery(common.EqualityFilter{FieldName: "duration_ms", Operator: ">=", Value: "500"}))
+	if output != `{"range":{"duration_ms":{"gte":500}}}` {
+		t.Fatal(output)
+	}
+	output = common.MustJsonEncode(equalityFilterToQuery(common.EqualityFilter{FieldName: "version", Operator: "<", Value: "v2"}))
+	if output != `{"range":{"version":{"lt":"v2"}}}` {
+		t.Fatal(output)
+	}
+}
+
+func TestRegexpQuery(t *testing.T) {
+	tests := map[string]string{
+		"^/api/v2/": `{"regexp":{"path":{"value":"/api/v2/.*"}}}`,
+		"users$":    `{"regexp":{"path":{"value":".*users"}}}`,
+		"(?i)bot":   `{"regexp":{"path":{"case_insensitive":true,"value":".*bot.*"}}}`,
+		"a|b":       `{"regexp":{"path":{"value":"(.*a.*|.*b.*)"}}}`,
+		"^a|b$":     `{"regexp":{"path":{"value":"(a.*|.*b)"}}}`,
+	}
+	for pattern, expected := range tests {
+		filter, err := common.NewRegexFilter("path", pattern, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output := common.MustJsonEncode(regexpQuery(filter)); output != expected {
+			t.Errorf("%s: %s", pattern, output)
+		}
+	}
+}
+
+func TestAdvancedFiltersToBoolQuery(t *testing.T) {
+	output := common.MustJsonEncode(queryToBoolQuery(common.Query{
+		ExistenceFilters: []common.ExistenceFilter{
+			{FieldName: "domain", Exists: true},
+			{FieldName: "traceback", Exists: false},
+		},
+		MembershipFilters: []common.MembershipFilter{
+			{FieldName: "level", ValidValues: []string{"error", "fatal"}, InvalidValues: []string{"warn"}},
+		},
+	}))
+	expected := `{"bool":{` +
+		`"must":[{"query_string":{"analyze_wildcard":true,"query":"*"}},{"exists":{"field":"domain"}},{"terms":{"level":["error","fatal"]}}],` +
+		`"must_not":[{"exists":{"field":"traceback"}},{"terms":{"level":["warn"]}}]` +
+		`}}`
+	if output != expected {
+		t.Fatal(output)
+	}
+}
+
+func TestSupportsFilter(t *testing.T) {
+	supported, _ := common.ParseFilterExpression(`level=error OR path~"(?i)^/api/v[0-9]+"`)
+	if !SupportsFilter(supported) {
+		t.Error("Expected filter to be supported")
+	}
+	unsupported, _ := common.ParseFilterExpression(`level=error OR path~"^/api/v\d+"`)
+	if SupportsFilter(unsupported) {
+		t.Error("Expected filter not to be supported")
+	}
+}
@@ -0,0 +1,340 @@
+package elasticsearch
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+)
+
+// Searcher performs a single Elasticsearch search with the given request body (as sent to _search),
+// calling emit for every hit as it is decoded from the response. Decoding stops when emit returns false.
+// When the body searches a point in time (PIT), this returns the point in time ID to use for the next search.
+// Points in time are consistent views of the index to page through, in which _shard_doc makes the sort order
+// unique, as sorting on _id is rejected by Elasticsearch 8.
+type Searcher interface {
+	Search(ctx context.Context, body JsonObject, emit func(Hit) bool) (string, error)
+	OpenPointInTime(ctx context.Context, keepAlive string) (string, error)
+	ClosePointInTime(ctx context.Context, id string) error
+}
+
+// How long a point in time is kept open after each search, so also the longest a page may take to consume
+const pointInTimeKeepAlive = "5m"
+
+// Pages through search results with search_after, within a point in time if the cluster supports
+// that (Elasticsearch 7.12 or later for _shard_doc). Otherwise pages only sort on @timestamp, so every
+// page starts at the last timestamp of the previous one again, skipping the hits it had already.
+type pager struct {
+	searcher Searcher
+	pitID    string // Empty without a point in time
+}
+
+func openPager(ctx context.Context, searcher Searcher) *pager {
+	pitID, err := searcher.OpenPointInTime(ctx, pointInTimeKeepAlive)
+	if err != nil {
+		log.Println("Could not open point in time, paging on @timestamp instead:", err)
+	}
+	return &pager{searcher, pitID}
+}
+
+// Closes the point in time, also when the query was canceled
+func (p *pager) close() {
+	if p.pitID == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := p.searcher.ClosePointInTime(ctx, p.pitID); err != nil {
+		log.Println("Could not close point in time:", err)
+	}
+}
+
+// The sort order for paging, which search_after requires to be unique within a point in time
+func (p *pager) sort(order string) JsonList {
+	if p.pitID == "" {
+		return sortSpec(order)
+	}
+	return append(sortSpec(order), JsonObject{
+		"_shard_doc": JsonObject{
+			"order": order,
+		},
+	})
+}
+
+func (p *pager) search(ctx context.Context, body JsonObject, emit func(Hit) bool) error {
+	if p.pitID != "" {
+		body["pit"] = JsonObject{
+			"id":         p.pitID,
+			"keep_alive": pointInTimeKeepAlive,
+		}
+	}
+	pitID, err := p.searcher.Search(ctx, body, emit)
+	if p.pitID != "" && pitID != "" {
+		// The ID may change between searches, the most recent one is to be used
+		p.pitID = pitID
+	}
+	return err
+}
+
+// Calls emit for every hit of a query (a search request body without paging parameters) in the
+// given order, a page at a time, until emit returns false or there are no more hits
+func (p *pager) each(ctx context.Context, query JsonObject, order string, emit func(Hit) bool) error {
+	var searchAfter JsonList
+	// Without a point in time: the last timestamp seen, and the IDs of the hits with that timestamp
+	var lastTimestamp *float64
+	idsAtTimestamp := make(map[string]bool)
+	for {
+		body := JsonObject{
+			"size": PageSize,
+			"sort": p.sort(order),
+		}
+		for k, v := range query {
+			body[k] = v
+		}
+		if searchAfter != nil {
+			body["search_after"] = searchAfter
+		}
+		received, fresh := 0, 0
+		stopped := false
+		var sortErr error
+		err := p.search(ctx, body, func(hit Hit) bool {
+			received++
+			if p.pitID != "" {
+				searchAfter = hit.Sort
+			} else {
+				ts, ok := hit.Sort[0].(float64)
+				if !ok {
+					sortErr = fmt.Errorf("Unexpected sort value: %v", hit.Sort[0])
+					return false
+				}
+				if lastTimestamp == nil || ts != *lastTimestamp {
+					lastTimestamp = &ts
+					idsAtTimestamp = make(map[string]bool)
+				}
+				if idsAtTimestamp[hit.ID] {
+					return true
+				}
+				idsAtTimestamp[hit.ID] = true
+			}
+			fresh++
+			if !emit(hit) {
+				stopped = true
+				return false
+			}
+			return true
+		})
+		if err == nil {
+			err = sortErr
+		}
+		if err != nil || stopped || received < PageSize {
+			return err
+		}
+		if p.pitID == "" {
+			// search_after excludes the timestamp itself, start just next to it to include it
+			next := *lastTimestamp - 1
+			if order == "desc" {
+				next = *lastTimestamp + 1
+			}
+			if fresh == 0 {
+				log.Printf("More than %d hits share timestamp %.0f, skipping the rest of them", PageSize, *lastTimestamp)
+				next = *lastTimestamp
+			}
+			searchAfter = JsonList{next}
+		}
+	}
+}
+
+// QueryMessages fetches the query.MaxResults most recent messages in one go, in ascending order
+func QueryMessages(ctx context.Context, searcher Searcher, q common.Query) ([]common.LogMessage, error) {
+	hits := make([]Hit, 0, 200)
+	_, err := searcher.Search(ctx, JsonObject{
+		"size":  q.MaxResults,
+		"sort":  sortSpec("desc"),
+		"query": queryToBoolQuery(q),
+	}, func(hit Hit) bool {
+		hits = append(hits, hit)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Hits are sorted on @timestamp descending, comparing the formatted timestamps wouldn't order them
+	// correctly as fractional seconds are left out when zero
+	for i, j := 0, len(hits)-1; i < j; i, j = i+1, j-1 {
+		hits[i], hits[j] = hits[j], hits[i]
+	}
+
+	allMessages := make([]common.LogMessage, 0, len(hits))
+	for _, hit := range hits {
+		message, err := hitToMessage(hit, q)
+		if err != nil {
+			return nil, err
+		}
+		allMessages = append(allMessages, message)
+	}
+	return allMessages, nil
+}
+
+// To stream the query.MaxResults most recent messages in ascending order, we first page
+// backwards through just the sort values to find the timestamp of the oldest one (the cutoff).
+// Since multiple messages can share that timestamp, this also returns how many of them are
+// part of the result. A nil cutoff means there are fewer than query.MaxResults messages.
+func findCutoff(ctx context.Context, p *pager, query common.Query) (*float64, int, error) {
+	var cutoff *float64
+	atCutoff := 0
+	seen := 0
+	var sortErr error
+	err := p.each(ctx, JsonObject{
+		"query":   queryToBoolQuery(query),
+		"_source": false,
+	}, "desc", func(hit Hit) bool {
+		ts, ok := hit.Sort[0].(float64)
+		if !ok {
+			sortErr = fmt.Errorf("Unexpected sort value: %v", hit.Sort[0])
+			return false
+		}
+		if cutoff != nil && *cutoff == ts {
+			atCutoff++
+		} else {
+			cutoff = &ts
+			atCutoff = 1
+		}
+		seen++
+		return seen < query.MaxResults
+	})
+	if err == nil {
+		err = sortErr
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if seen < query.MaxResults {
+		// Ran out of messages
+		return nil, 0, nil
+	}
+	return cutoff, atCutoff, nil
+}
+
+// StreamQuery sends the query.MaxResults most recent messages to resultChan in ascending order.
+// Results that fit in a page take a single search. Larger ones are paged through with search_after,
+// sending every message as soon as it is decoded.
+func StreamQuery(ctx context.Context, searcher Searcher, q common.Query, resultChan chan<- common.LogMessage) error {
+	if q.MaxResults <= PageSize {
+		messages, err := QueryMessages(ctx, searcher, q)
+		if err != nil {
+			return err
+		}
+		for _, message := range messages {
+			if !common.SendMessage(ctx, resultChan, message) {
+				return nil
+			}
+		}
+		return nil
+	}
+	p := openPager(ctx, searcher)
+	defer p.close()
+	cutoff, atCutoff, err := findCutoff(ctx, p, q)
+	if err != nil {
+		return err
+	}
+	boolQuery := queryToBoolQuery(q)
+	if cutoff != nil {
+		boolQuery = JsonObject{
+			"bool": JsonObject{
+				"must": JsonList{
+					boolQuery,
+					JsonObject{
+						"range": JsonObject{
+							"@timestamp": JsonObject{
+								"gte":    int64(*cutoff),
+								"format": "epoch_millis",
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+	sent := 0
+	seenAtCutoff := 0
+	var messageErr error
+	err = p.each(ctx, JsonObject{"query": boolQuery}, "asc", func(hit Hit) bool {
+		if ts, ok := hit.Sort[0].(float64); ok && cutoff != nil && ts == *cutoff {
+			// Only the most recent atCutoff messages with this timestamp are part of the result,
+			// but since they share a timestamp, any atCutoff of them will do
+			seenAtCutoff++
+			if seenAtCutoff > atCutoff {
+				return true
+			}
+		}
+		message, err := hitToMessage(hit, q)
+		if err != nil {
+			messageErr = err
+			return false
+		}
+		if !common.SendMessage(ctx, resultChan, message) {
+			return false
+		}
+		sent++
+		return sent < q.MaxResults
+	})
+	if err == nil {
+		err = messageErr
+	}
+	return err
+}
+
+func hitToMessage(hit Hit, q common.Query) (common.LogMessage, error) {
+	attributes := hit.Source
+	ts, err := time.Parse(time.RFC3339, attributes["@timestamp"].(string))
+	if err != nil {
+		return common.LogMessage{}, err
+	}
+	delete(attributes, "@timestamp")
+	message := common.FlattenLogMessage(common.LogMessage{
+		ID:         hit.ID,
+		Timestamp:  ts,
+		Attributes: attributes,
+	})
+	message.Attributes = common.Project(message.Attributes, q.SelectFields)
+	return message, nil
+}
+
+// Query implements common.Client's Query on top of a Searcher, name is used in error messages
+func Query(ctx context.Context, searcher Searcher, name string, q common.Query) <-chan common.LogMessage {
+	if q.Follow {
+		// Follow mode repeatedly queries for messages after a cursor
+		return common.FollowQuery(ctx, q, func(pollQuery common.Query) ([]common.LogMessage, error) {
+			if pollQuery.Before == nil {
+				before := time.Now().Add(12 * time.Hour)
+				pollQuery.Before = &before // Limit sanity
+			}
+			return QueryMessages(ctx, searcher, pollQuery)
+		})
+	}
+	resultChan := make(chan common.LogMessage)
+	if q.Before == nil {
+		before := time.Now().Add(12 * time.Hour)
+		q.Before = &before // Limit sanity
+	}
+	go func() {
+		err := StreamQuery(ctx, searcher, q, resultChan)
+		// Check if the context wasn't canceled
+		select {
+		case <-ctx.Done():
+			close(resultChan)
+			return
+		default:
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not connect to %s: %v\n", name, err)
+			os.Exit(2)
+		}
+		close(resultChan)
+	}()
+
+	return resultChan
+}
@@ -0,0 +1,178 @@
+package elasticsearch
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+)
+
+// Aggregator performs a single Elasticsearch search with the given request body (as sent to _search),
+// returning the aggregations of the response
+type Aggregator interface {
+	Aggregate(ctx context.Context, body JsonObject) (JsonObject, error)
+}
+
+// Text fields can't be aggregated on, but usually have a keyword sub-field that can. This checks which
+// of the fields have one (for any of the messages matching the query), and returns the fields to group by.
+func groupByFields(ctx context.Context, aggregator Aggregator, q common.StatsQuery) ([]string, error) {
+	fields := make([]string, len(q.GroupBy))
+	aggs := JsonObject{}
+	for i, field := range q.GroupBy {
+		fields[i] = field
+		if !strings.HasSuffix(field, ".keyword") {
+			aggs[fmt.Sprintf("keyword_%d", i)] = JsonObject{
+				"filter": JsonObject{
+					"exists": JsonObject{
+						"field": field + ".keyword",
+					},
+				},
+			}
+		}
+	}
+	if len(aggs) == 0 {
+		return fields, nil
+	}
+	aggregations, err := aggregator.Aggregate(ctx, JsonObject{
+		"size":  0,
+		"query": queryToBoolQuery(q.Query),
+		"aggs":  aggs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range fields {
+		if agg, ok := aggregations[fmt.Sprintf("keyword_%d", i)].(map[string]interface{}); ok {
+			if count, _ := agg["doc_count"].(float64); count > 0 {
+				fields[i] += ".keyword"
+			}
+		}
+	}
+	return fields, nil
+}
+
+// Builds nested terms aggregations for the fields, with the metric aggregations in the innermost one
+func statsAggregations(fields []string, q common.StatsQuery) JsonObject {
+	if len(fields) > 0 {
+		return JsonObject{
+			"group": JsonObject{
+				"terms": JsonObject{
+					"field": fields[0],
+					"size":  q.MaxGroups,
+				},
+				"aggs": statsAggregations(fields[1:], q),
+			},
+		}
+	}
+	aggs := JsonObject{}
+	percents := make(JsonList, 0, len(common.StatsPercentiles))
+	for _, p := range common.StatsPercentiles {
+		percents = append(percents, p)
+	}
+	for i, metric := range q.Metrics {
+		aggs[fmt.Sprintf("stats_%d", i)] = JsonObject{
+			"stats": JsonObject{
+				"field": metric,
+			},
+		}
+		aggs[fmt.Sprintf("percentiles_%d", i)] = JsonObject{
+			"percentiles": JsonObject{
+				"field":    metric,
+				"percents": percents,
+			},
+		}
+	}
+	return aggs
+}
+
+func bucketKey(bucket map[string]interface{}) string {
+	if key, ok := bucket["key_as_string"].(string); ok {
+		return key
+	}
+	return fmt.Sprintf("%v", bucket["key"])
+}
+
+func bucketMetrics(bucket map[string]interface{}, q common.StatsQuery) map[string]common.MetricStats {
+	metrics := make(map[string]common.MetricStats)
+	for i, metric := range q.Metrics {
+		stats, _ := bucket[fmt.Sprintf("stats_%d", i)].(map[string]interface{})
+		count, _ := stats["count"].(float64)
+		if count == 0 {
+			// No numeric values for this metric
+			continue
+		}
+		metricStats := common.MetricStats{
+			Count:       int(count),
+			Percentiles: make(map[float64]float64),
+		}
+		metricStats.Min, _ = stats["min"].(float64)
+		metricStats.Max, _ = stats["max"].(float64)
+		metricStats.Avg, _ = stats["avg"].(float64)
+		percentiles, _ := bucket[fmt.Sprintf("percentiles_%d", i)].(map[string]interface{})
+		values, _ := percentiles["values"].(map[string]interface{})
+		for key, value := range values {
+			p, err := strconv.ParseFloat(key, 64)
+			if v, ok := value.(float64); ok && err == nil {
+				metricStats.Percentiles[p] = v
+			}
+		}
+		metrics[metric] = metricStats
+	}
+	return metrics
+}
+
+// Flattens the nested terms aggregation buckets into groups
+func collectGroups(bucket map[string]interface{}, key []string, q common.StatsQuery, groups []common.StatsGroup) []common.StatsGroup {
+	if len(key) == len(q.GroupBy) {
+		count, _ := bucket["doc_count"].(float64)
+		return append(groups, common.StatsGroup{
+			Key:     key,
+			Count:   int(count),
+			Metrics: bucketMetrics(bucket, q),
+		})
+	}
+	group, _ := bucket["group"].(map[string]interface{})
+	buckets, _ := group["buckets"].([]interface{})
+	for _, b := range buckets {
+		if subBucket, ok := b.(map[string]interface{}); ok {
+			subKey := append(append([]string{}, key...), bucketKey(subBucket))
+			groups = collectGroups(subBucket, subKey, q, groups)
+		}
+	}
+	return groups
+}
+
+// Stats computes the statistics of a query using Elasticsearch aggregations
+func Stats(ctx context.Context, aggregator Aggregator, q common.StatsQuery) ([]common.StatsGroup, error) {
+	fields, err := groupByFields(ctx, aggregator, q)
+	if err != nil {
+		return nil, err
+	}
+	aggregations, err := aggregator.Aggregate(ctx, JsonObject{
+		"size":  0,
+		"query": queryToBoolQuery(q.Query),
+		"aggs": JsonObject{
+			// Wraps all matching messages in a single bucket, also when not grouping
+			"all": JsonObject{
+				"filter": JsonObject{
+					"match_all": JsonObject{},
+				},
+				"aggs": statsAggregations(fields, q),
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	all, ok := aggregations["all"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Unexpected aggregations: %s", common.MustJsonEncode(aggregations))
+	}
+	groups := collectGroups(all, []string{}, q, make([]common.StatsGroup, 0))
+	if len(q.GroupBy) == 0 && groups[0].Count == 0 {
+		return []common.StatsGroup{}, nil
+	}
+	return common.SortStatsGroups(groups, q.MaxGroups), nil
+}
@@ -0,0 +1,74 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+)
+
+// Returns canned aggregations, in the order of the searches
+type fakeAggregator struct {
+	responses []string
+	bodies    []JsonObject
+}
+
+func (aggregator *fakeAggregator) Aggregate(ctx context.Context, body JsonObject) (JsonObject, error) {
+	aggregator.bodies = append(aggregator.bodies, body)
+	var aggregations JsonObject
+	err := json.Unmarshal([]byte(aggregator.responses[len(aggregator.bodies)-1]), &aggregations)
+	return aggregations, err
+}
+
+func TestStats(t *testing.T) {
+	aggregator := &fakeAggregator{responses: []string{
+		`{"keyword_0": {"doc_count": 3}, "keyword_1": {"doc_count": 0}}`,
+		`{"all": {"doc_count": 3, "group": {"buckets": [
+			{"key": "orders", "doc_count": 2, "group": {"buckets": [
+				{"key": 200, "doc_count": 2,
+					"stats_0": {"count": 2, "min": 10, "max": 30, "avg": 20},
+					"percentiles_0": {"values": {"50.0": 10, "95.0": 30, "99.0": 30}}}
+			]}},
+			{"key": "payments", "doc_count": 1, "group": {"buckets": [
+				{"key": 500, "doc_count": 1,
+					"stats_0": {"count": 0, "min": null, "max": null, "avg": null},
+					"percentiles_0": {"values": {"50.0": null, "95.0": null, "99.0": null}}}
+			]}}
+		]}}}`,
+	}}
+	query := common.StatsQuery{GroupBy: []string{"service", "status"}, Metrics: []string{"duration_ms"}, MaxGroups: 10}
+	groups, err := Stats(context.Background(), aggregator, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []common.StatsGroup{
+		{Key: []string{"orders", "200"}, Count: 2, Metrics: map[string]common.MetricStats{
+			"duration_ms": {Count: 2, Min: 10, Max: 30, Avg: 20, Percentiles: map[float64]float64{50: 10, 95: 30, 99: 30}},
+		}},
+		{Key: []string{"payments", "500"}, Count: 1, Metrics: map[string]common.MetricStats{}},
+	}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Errorf("Unexpected groups: %+v", groups)
+	}
+	// Only service has a keyword sub-field to aggregate on
+	terms := aggregator.bodies[1]["aggs"].(JsonObject)["all"].(JsonObject)["aggs"].(JsonObject)["group"].(JsonObject)
+	if field := terms["terms"].(JsonObject)["field"]; field != "service.keyword" {
+		t.Errorf("Expected to group by service.keyword, got %v", field)
+	}
+	if field := terms["aggs"].(JsonObject)["group"].(JsonObject)["terms"].(JsonObject)["field"]; field != "status" {
+		t.Errorf("Expected to group by status, got %v", field)
+	}
+}
+
+func TestStatsWithoutGroups(t *testing.T) {
+	aggregator := &fakeAggregator{responses: []string{`{"all": {"doc_count": 0}}`}}
+	groups, err := Stats(context.Background(), aggregator, common.StatsQuery{})
+	if err != nil || len(groups) != 0 {
+		t.Errorf("Expected no groups without messages, got %+v (%v)", groups, err)
+	}
+	if len(aggregator.bodies) != 1 {
+		t.Errorf("Expected a single search without fields to group by, got %d", len(aggregator.bodies))
+	}
+}
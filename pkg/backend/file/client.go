@@ -0,0 +1,140 @@
+package file
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+)
+
+// FileClient reads log files matching a glob pattern, e.g. /var/log/app/*.log*
+type FileClient struct {
+	pattern string
+}
+
+func New(pattern string) *FileClient {
+	return &FileClient{pattern}
+}
+
+func (client *FileClient) SupportsFilter(filter common.FilterExpression) bool {
+	return true
+}
+
+// Heap of the next message of every file, to merge files in timestamp order
+type fileHeads struct {
+	files    []*logFile
+	messages []common.LogMessage
+}
+
+func (h *fileHeads) Len() int { return len(h.files) }
+func (h *fileHeads) Less(i, j int) bool {
+	return h.messages[i].Timestamp.Before(h.messages[j].Timestamp)
+}
+func (h *fileHeads) Swap(i, j int) {
+	h.files[i], h.files[j] = h.files[j], h.files[i]
+	h.messages[i], h.messages[j] = h.messages[j], h.messages[i]
+}
+func (h *fileHeads) Push(x interface{}) {
+	head := x.(fileHead)
+	h.files = append(h.files, head.file)
+	h.messages = append(h.messages, head.message)
+}
+func (h *fileHeads) Pop() interface{} {
+	n := len(h.files) - 1
+	head := fileHead{h.files[n], h.messages[n]}
+	h.files = h.files[:n]
+	h.messages = h.messages[:n]
+	return head
+}
+
+type fileHead struct {
+	file    *logFile
+	message common.LogMessage
+}
+
+// Reads the files in timestamp order, calling emit with every message until it returns false.
+// Reading a file stops at the first message after query.Before.
+func mergeFiles(ctx context.Context, files []*logFile, query common.Query, emit func(common.LogMessage) bool) {
+	heads := &fileHeads{}
+	pastBefore := func(message common.LogMessage) bool {
+		return query.Before != nil && message.Timestamp.After(*query.Before)
+	}
+	for _, lf := range files {
+		if message, ok := lf.next(true); ok && !pastBefore(message) {
+			heap.Push(heads, fileHead{lf, message})
+		}
+	}
+	for heads.Len() > 0 && ctx.Err() == nil {
+		head := heap.Pop(heads).(fileHead)
+		if !emit(head.message) {
+			return
+		}
+		if message, ok := head.file.next(true); ok && !pastBefore(message) {
+			heap.Push(heads, fileHead{head.file, message})
+		}
+	}
+}
+
+func (client *FileClient) openFiles(after *time.Time) ([]*logFile, error) {
+	paths, err := filepath.Glob(client.pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("No files matching %s", client.pattern)
+	}
+	files := make([]*logFile, 0, len(paths))
+	for _, path := range paths {
+		lf, err := openLogFile(path, after)
+		if err != nil {
+			for _, lf := range files {
+				lf.Close()
+			}
+			return nil, err
+		}
+		files = append(files, lf)
+	}
+	return files, nil
+}
+
+func (client *FileClient) Query(ctx context.Context, query common.Query) <-chan common.LogMessage {
+	resultChan := make(chan common.LogMessage)
+	go func() {
+		defer close(resultChan)
+		files, err := client.openFiles(query.After)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		// Keep the query.MaxResults most recent messages
+		messages := make([]common.LogMessage, 0, 200)
+		mergeFiles(ctx, files, query, func(message common.LogMessage) bool {
+			if common.MatchesQuery(message, query) {
+				messages = append(messages, message)
+				if len(messages) > query.MaxResults {
+					messages = messages[1:]
+				}
+			}
+			return true
+		})
+		for _, message := range messages {
+			message.Attributes = common.Project(message.Attributes, query.SelectFields)
+			if !common.SendMessage(ctx, resultChan, message) {
+				break
+			}
+		}
+		if !query.Follow || ctx.Err() != nil {
+			for _, lf := range files {
+				lf.Close()
+			}
+			return
+		}
+		newTailer(client.pattern, files).follow(ctx, query, resultChan)
+	}()
+	return resultChan
+}
+
+var _ common.Client = &FileClient{}
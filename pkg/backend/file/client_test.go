@@ -0,0 +1,104 @@
+package file
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+	"github.com/egnyte/ax/pkg/backend/stream"
+)
+
+var baseTime = time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func logLine(second int, message string) string {
+	return fmt.Sprintf("%s INFO %s\n", baseTime.Add(time.Duration(second)*time.Second).Format("2006-01-02 15:04:05"), message)
+}
+
+func writeGzipped(t *testing.T, path, content string) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	writer.Write([]byte(content))
+	writer.Close()
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "ax-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func messageTexts(messages <-chan common.LogMessage) string {
+	texts := make([]string, 0)
+	for message := range messages {
+		text := message.Attributes["message"].(string)
+		texts = append(texts, fmt.Sprintf("%s@%s", text[len(text)-2:], filepath.Base(message.Attributes["@file"].(string))))
+	}
+	return strings.Join(texts, " ")
+}
+
+func TestQueryMergesFiles(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	writeGzipped(t, filepath.Join(dir, "app.log.2.gz"), logLine(1, "m1")+logLine(3, "m3"))
+	ioutil.WriteFile(filepath.Join(dir, "app.log.1"), []byte(logLine(2, "m2")+"  continued\n"+logLine(5, "m5")), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "app.log"), []byte(logLine(4, "m4")+logLine(6, "m6")), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "other.txt"), []byte(logLine(0, "m0")), 0644)
+
+	client := New(filepath.Join(dir, "app.log*"))
+	output := messageTexts(client.Query(context.Background(), common.Query{MaxResults: 10}))
+	if output != "m1@app.log.2.gz m2@app.log.1 ed@app.log.1 m3@app.log.2.gz m4@app.log m5@app.log.1 m6@app.log" {
+		t.Errorf("Unexpected messages: %s", output)
+	}
+	after := baseTime.Add(2 * time.Second)
+	before := baseTime.Add(5 * time.Second)
+	output = messageTexts(client.Query(context.Background(), common.Query{After: &after, Before: &before, MaxResults: 3}))
+	if output != "m3@app.log.2.gz m4@app.log m5@app.log.1" {
+		t.Errorf("Unexpected messages: %s", output)
+	}
+}
+
+func TestSeekToTime(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	var content strings.Builder
+	offsets := make([]int64, 0)
+	for i := 0; i < 10000; i++ {
+		offsets = append(offsets, int64(content.Len()))
+		content.WriteString(logLine(i, fmt.Sprintf("message %d", i)))
+		if i%10 == 0 {
+			content.WriteString("  a line without timestamp\n")
+		}
+	}
+	path := filepath.Join(dir, "app.log")
+	ioutil.WriteFile(path, []byte(content.String()), 0644)
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	for _, second := range []int{0, 1, 5000, 9999, 20000} {
+		var parser stream.LineParser
+		offset := seekToTime(file, int64(content.Len()), baseTime.Add(time.Duration(second)*time.Second), &parser)
+		expected := int64(content.Len())
+		if second < len(offsets) {
+			expected = offsets[second]
+		}
+		if offset > expected || expected-offset > seekScanDistance+100 {
+			t.Errorf("Seeking to %d seconds: expected an offset just before %d, got %d", second, expected, offset)
+		}
+	}
+}
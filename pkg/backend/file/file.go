@@ -0,0 +1,162 @@
+package file
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+	"github.com/egnyte/ax/pkg/backend/stream"
+)
+
+const (
+	// Binary search for --after stops when the range left is this small, and scans from there
+	seekScanDistance = 4096
+	// Maximum number of lines looked at to find a timestamp from a random offset
+	seekMaxProbeLines = 100
+)
+
+// A log file being read line by line, keeping track of its position to support tailing
+type logFile struct {
+	path          string
+	file          *os.File
+	info          os.FileInfo
+	gzipped       bool
+	reader        *bufio.Reader
+	offset        int64  // Offset of the next line in the file (only for files that aren't gzipped)
+	partial       string // Incomplete last line read while tailing
+	parser        stream.LineParser
+	lastTimestamp time.Time
+}
+
+func isGzipped(path string) bool {
+	return strings.HasSuffix(path, ".gz")
+}
+
+// Opens a log file, if after is given (and the file isn't gzipped) it seeks to
+// (approximately) the first line with a timestamp at or after it
+func openLogFile(path string, after *time.Time) (*logFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	lf := &logFile{path: path, file: file, info: info, gzipped: isGzipped(path)}
+	if lf.gzipped {
+		gzipReader, err := gzip.NewReader(bufio.NewReader(file))
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		lf.reader = bufio.NewReader(gzipReader)
+		return lf, nil
+	}
+	if after != nil {
+		lf.offset = seekToTime(file, info.Size(), *after, &lf.parser)
+	}
+	if _, err := file.Seek(lf.offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	lf.reader = bufio.NewReader(file)
+	return lf, nil
+}
+
+func (lf *logFile) Close() error {
+	return lf.file.Close()
+}
+
+// Reads from offset (until limit) to find the first line that starts after offset and has a timestamp.
+// Returns the line's offset and timestamp, or false if there is no such line.
+func probeTimestamp(file *os.File, offset, limit int64, parser *stream.LineParser) (int64, time.Time, bool) {
+	reader := bufio.NewReader(io.NewSectionReader(file, offset, limit-offset))
+	if offset > 0 {
+		// Skip the (remainder of the) line offset is in
+		skipped, err := reader.ReadString('\n')
+		if err != nil {
+			return 0, time.Time{}, false
+		}
+		offset += int64(len(skipped))
+	}
+	for i := 0; i < seekMaxProbeLines; i++ {
+		line, err := reader.ReadString('\n')
+		if strings.TrimSpace(line) != "" {
+			if message, found := parser.Parse(line); found {
+				return offset, message.Timestamp, true
+			}
+		}
+		if err != nil {
+			break
+		}
+		offset += int64(len(line))
+	}
+	return 0, time.Time{}, false
+}
+
+// Binary searches a (timestamp ordered) log file for the first line with a timestamp at or after after.
+// Lines without timestamps (e.g. stack traces) belong to the line before them, so lines are only
+// skipped when they're followed by a line with an earlier timestamp. Returns the offset to read from.
+func seekToTime(file *os.File, size int64, after time.Time, parser *stream.LineParser) int64 {
+	// Every line before lo is before after
+	lo, hi := int64(0), size
+	for hi-lo > seekScanDistance {
+		mid := lo + (hi-lo)/2
+		lineOffset, ts, ok := probeTimestamp(file, mid, size, parser)
+		if ok && lineOffset < hi && ts.Before(after) {
+			lo = lineOffset
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
+
+// Reads the next line, returns false at the end of the file. An incomplete last line is
+// returned if final is set, otherwise it is kept until the rest of it is written (when tailing).
+func (lf *logFile) readLine(final bool) (string, bool) {
+	line, err := lf.reader.ReadString('\n')
+	line = lf.partial + line
+	lf.partial = ""
+	if err == nil || (final && line != "") {
+		lf.offset += int64(len(line))
+		return line, true
+	}
+	lf.partial = line
+	return "", false
+}
+
+// Parses a line into a message. Lines without a timestamp get the timestamp of the line before them,
+// as they're usually part of the same message (like a stack trace), or the file's modification time.
+func (lf *logFile) parse(line string) common.LogMessage {
+	message, found := lf.parser.Parse(line)
+	if !found {
+		if lf.lastTimestamp.IsZero() {
+			message.Timestamp = lf.info.ModTime()
+		} else {
+			message.Timestamp = lf.lastTimestamp
+		}
+	}
+	lf.lastTimestamp = message.Timestamp
+	message.Attributes["@file"] = lf.path
+	return message
+}
+
+// Returns the next (non-empty) line as a message, or false at the end of the file
+func (lf *logFile) next(final bool) (common.LogMessage, bool) {
+	for {
+		line, ok := lf.readLine(final)
+		if !ok {
+			return common.LogMessage{}, false
+		}
+		if strings.TrimSpace(line) != "" {
+			return lf.parse(line), true
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+)
+
+// How often files are checked for new lines in follow mode, unless --poll-interval is given
+const tailPollTime = 250 * time.Millisecond
+
+// Follows files matching a pattern like `tail -F`: files are tracked by identity rather than name,
+// so a file renamed by logrotate is read until it's gone, its replacement is read from the start,
+// and truncated files (copytruncate) are read from the start again. New files matching the pattern
+// are picked up as well. Gzipped files are skipped, as they are not expected to grow.
+type tailer struct {
+	pattern string
+	files   map[string]*logFile // By path
+}
+
+func newTailer(pattern string, files []*logFile) *tailer {
+	t := &tailer{pattern: pattern, files: make(map[string]*logFile)}
+	for _, lf := range files {
+		if lf.gzipped {
+			lf.Close()
+			continue
+		}
+		t.files[lf.path] = lf
+	}
+	return t
+}
+
+func (t *tailer) close() {
+	for _, lf := range t.files {
+		lf.Close()
+	}
+}
+
+// Reads all complete lines written since the last poll
+func (t *tailer) poll() ([]common.LogMessage, error) {
+	paths, err := filepath.Glob(t.pattern)
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]common.LogMessage, 0)
+	files := make(map[string]*logFile)
+	for _, path := range paths {
+		if isGzipped(path) {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			// Rotated away since globbing
+			continue
+		}
+		var lf *logFile
+		for trackedPath, tracked := range t.files {
+			if os.SameFile(tracked.info, info) {
+				lf = tracked
+				delete(t.files, trackedPath)
+				break
+			}
+		}
+		if lf == nil {
+			// Created (or replaced) since the last poll
+			if lf, err = openLogFile(path, nil); err != nil {
+				continue
+			}
+		} else if info.Size() < lf.offset {
+			// Truncated
+			if _, err := lf.file.Seek(0, io.SeekStart); err != nil {
+				return nil, err
+			}
+			lf.reader.Reset(lf.file)
+			lf.offset = 0
+			lf.partial = ""
+		}
+		lf.path = path
+		lf.info = info
+		files[path] = lf
+		for message, ok := lf.next(false); ok; message, ok = lf.next(false) {
+			messages = append(messages, message)
+		}
+	}
+	// Files left are gone (deleted, or renamed to a name not matching the pattern), read what's left of them
+	for _, lf := range t.files {
+		for message, ok := lf.next(true); ok; message, ok = lf.next(true) {
+			messages = append(messages, message)
+		}
+		lf.Close()
+	}
+	t.files = files
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].Timestamp.Before(messages[j].Timestamp)
+	})
+	return messages, nil
+}
+
+func (t *tailer) follow(ctx context.Context, query common.Query, resultChan chan<- common.LogMessage) {
+	defer t.close()
+	pollInterval := query.PollInterval
+	if pollInterval == 0 {
+		pollInterval = tailPollTime
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(pollInterval):
+		}
+		messages, err := t.poll()
+		if err != nil {
+			fmt.Printf("Error while following files: %v\n", err)
+			return
+		}
+		for _, message := range messages {
+			if !common.MatchesQuery(message, query) {
+				continue
+			}
+			message.Attributes = common.Project(message.Attributes, query.SelectFields)
+			if !common.SendMessage(ctx, resultChan, message) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package file
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+)
+
+func appendToFile(t *testing.T, path, content string) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.WriteString(content)
+}
+
+func pollTexts(t *testing.T, tail *tailer) string {
+	messages, err := tail.poll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	texts := make([]string, 0, len(messages))
+	for _, message := range messages {
+		text := message.Attributes["message"].(string)
+		texts = append(texts, text[len(text)-2:])
+	}
+	return strings.Join(texts, " ")
+}
+
+func TestTailerRotation(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	appendToFile(t, path, logLine(1, "m1"))
+	client := New(filepath.Join(dir, "app.log*"))
+	files, err := client.openFiles(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ok := files[0].next(true); ok; _, ok = files[0].next(true) {
+	}
+	tail := newTailer(client.pattern, files)
+	defer tail.close()
+
+	// A partial line is only read once it's complete
+	appendToFile(t, path, logLine(2, "m2")+"2018-10-01 12:00:03 INFO ")
+	if output := pollTexts(t, tail); output != "m2" {
+		t.Errorf("Unexpected messages: %s", output)
+	}
+	appendToFile(t, path, "m3\n")
+	// Rotated by renaming, with a last line written before the application reopens
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendToFile(t, path+".1", logLine(4, "m4"))
+	appendToFile(t, path, logLine(5, "m5")+logLine(5, "n5"))
+	if output := pollTexts(t, tail); output != "m3 m4 m5 n5" {
+		t.Errorf("Unexpected messages after rename: %s", output)
+	}
+	// Rotated by truncating (copytruncate), and the old file is removed. Like with tail -F,
+	// truncation is only noticed when the file is smaller than before.
+	os.Remove(path + ".1")
+	os.Truncate(path, 0)
+	appendToFile(t, path, logLine(6, "m6"))
+	if output := pollTexts(t, tail); output != "m6" {
+		t.Errorf("Unexpected messages after truncate: %s", output)
+	}
+	appendToFile(t, filepath.Join(dir, "app.log.new"), logLine(7, "m7"))
+	if output := pollTexts(t, tail); output != "m7" {
+		t.Errorf("Unexpected messages from new file: %s", output)
+	}
+}
+
+func TestFollow(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	ioutil.WriteFile(path, []byte(logLine(1, "m1")), 0644)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	results := New(path).Query(ctx, common.Query{Follow: true, MaxResults: 10, PollInterval: time.Millisecond})
+	if message := <-results; message.Attributes["message"] != "INFO m1" {
+		t.Errorf("Expected the existing line first, got %+v", message)
+	}
+	appendToFile(t, path, logLine(2, "m2"))
+	if message := <-results; message.Attributes["message"] != "INFO m2" {
+		t.Errorf("Expected the new line, got %+v", message)
+	}
+	cancel()
+	for range results {
+	}
+}
@@ -0,0 +1,238 @@
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+)
+
+// Names of fields stored in the journal itself (rather than parsed from the message),
+// e.g. _SYSTEMD_UNIT, PRIORITY or SYSLOG_IDENTIFIER, these can be matched on by journalctl
+var journalFieldName = regexp.MustCompile(`^[A-Z0-9_]+$`)
+
+// JournalClient reads the systemd journal through `journalctl --output json`
+type JournalClient struct {
+	command []string // e.g. journalctl, or ssh myhost journalctl
+}
+
+func New(command []string) *JournalClient {
+	if len(command) == 0 || command[0] == "" {
+		command = []string{"journalctl"}
+	}
+	return &JournalClient{command}
+}
+
+func (client *JournalClient) SupportsFilter(filter common.FilterExpression) bool {
+	return true
+}
+
+// Translates a query into journalctl arguments that select a superset of the matching entries;
+// field matches on the same field are OR'ed by journalctl, so all filters are still applied by Ax.
+func queryArgs(query common.Query) []string {
+	args := []string{"--output", "json", "--no-pager"}
+	minPriority, maxPriority := 0, 7
+	for _, filter := range query.EqualityFilters {
+		if !journalFieldName.MatchString(filter.FieldName) {
+			continue
+		}
+		if filter.FieldName == "PRIORITY" && common.IsOrderingOperator(filter.Operator) {
+			priority, err := strconv.Atoi(filter.Value)
+			if err != nil {
+				continue
+			}
+			switch filter.Operator {
+			case "<":
+				priority--
+				fallthrough
+			case "<=":
+				if priority < maxPriority {
+					maxPriority = priority
+				}
+			case ">":
+				priority++
+				fallthrough
+			case ">=":
+				if priority > minPriority {
+					minPriority = priority
+				}
+			}
+		} else if filter.Operator == "=" {
+			args = append(args, fmt.Sprintf("%s=%s", filter.FieldName, filter.Value))
+		}
+	}
+	for _, filter := range query.MembershipFilters {
+		if !journalFieldName.MatchString(filter.FieldName) {
+			continue
+		}
+		for _, value := range filter.ValidValues {
+			args = append(args, fmt.Sprintf("%s=%s", filter.FieldName, value))
+		}
+	}
+	if minPriority > 0 || maxPriority < 7 {
+		args = append(args, "--priority", fmt.Sprintf("%d..%d", minPriority, maxPriority))
+	}
+	// journalctl only takes whole seconds, so round outwards
+	if query.After != nil {
+		args = append(args, "--since", fmt.Sprintf("@%d", query.After.Unix()))
+	}
+	if query.Before != nil {
+		args = append(args, "--until", fmt.Sprintf("@%d", query.Before.Unix()+1))
+	}
+	return args
+}
+
+// Binary field values are exported as arrays of bytes, and fields with multiple values as arrays
+func decodeValue(value interface{}) interface{} {
+	values, ok := value.([]interface{})
+	if !ok {
+		return value
+	}
+	buf := make([]byte, 0, len(values))
+	for _, v := range values {
+		b, ok := v.(float64)
+		if !ok {
+			// Multiple values for the same field
+			decoded := make([]interface{}, 0, len(values))
+			for _, v := range values {
+				decoded = append(decoded, decodeValue(v))
+			}
+			return decoded
+		}
+		buf = append(buf, byte(b))
+	}
+	return string(buf)
+}
+
+// Parses an entry in journalctl's JSON output; __REALTIME_TIMESTAMP becomes the message's timestamp
+// and __CURSOR its ID. MESSAGE becomes "message", and is parsed when it contains JSON.
+func parseEntry(line []byte) (common.LogMessage, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return common.LogMessage{}, err
+	}
+	message := common.NewLogMessage()
+	message.ID, _ = fields["__CURSOR"].(string)
+	micros, err := strconv.ParseInt(fmt.Sprintf("%v", fields["__REALTIME_TIMESTAMP"]), 10, 64)
+	if err != nil {
+		return common.LogMessage{}, fmt.Errorf("Invalid __REALTIME_TIMESTAMP in journal entry: %v", fields["__REALTIME_TIMESTAMP"])
+	}
+	message.Timestamp = time.Unix(0, micros*int64(time.Microsecond))
+	for key, value := range fields {
+		if strings.HasPrefix(key, "__") {
+			// Cursor, timestamps and other address fields
+			continue
+		}
+		value = decodeValue(value)
+		if key != "MESSAGE" {
+			message.Attributes[key] = value
+			continue
+		}
+		text := fmt.Sprintf("%v", value)
+		message.Attributes["message"] = text
+		var structured map[string]interface{}
+		if strings.HasPrefix(strings.TrimSpace(text), "{") && json.Unmarshal([]byte(text), &structured) == nil {
+			for structuredKey, structuredValue := range structured {
+				message.Attributes[structuredKey] = structuredValue
+			}
+		}
+	}
+	return common.FlattenLogMessage(message), nil
+}
+
+// Runs journalctl with the given arguments, calling emit for every entry until it returns false
+func (client *JournalClient) read(ctx context.Context, args []string, emit func(common.LogMessage) bool) error {
+	cmd := exec.CommandContext(ctx, client.command[0], append(client.command[1:], args...)...)
+	stdOut, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	var stdErr bytes.Buffer
+	cmd.Stderr = &stdErr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("Could not start %s: %v", client.command[0], err)
+	}
+	reader := bufio.NewReader(stdOut)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			message, err := parseEntry(line)
+			if err != nil {
+				cmd.Process.Kill()
+				cmd.Wait()
+				return err
+			}
+			if !emit(message) {
+				cmd.Process.Kill()
+				// Killed, so ignoring the exit status
+				cmd.Wait()
+				return nil
+			}
+		}
+		if readErr != nil {
+			break
+		}
+	}
+	if err := cmd.Wait(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("%s exited with error: %v %s", client.command[0], err, strings.TrimSpace(stdErr.String()))
+	}
+	return nil
+}
+
+func (client *JournalClient) Query(ctx context.Context, query common.Query) <-chan common.LogMessage {
+	resultChan := make(chan common.LogMessage)
+	go func() {
+		defer close(resultChan)
+		start := time.Now()
+		args := queryArgs(query)
+		// Read backwards until enough entries match, to show the most recent ones
+		messages := make([]common.LogMessage, 0, 200)
+		err := client.read(ctx, append(args, "--reverse"), func(message common.LogMessage) bool {
+			if common.MatchesQuery(message, query) {
+				messages = append(messages, message)
+			}
+			return len(messages) < query.MaxResults
+		})
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		for i := len(messages) - 1; i >= 0; i-- {
+			message := messages[i]
+			message.Attributes = common.Project(message.Attributes, query.SelectFields)
+			if !common.SendMessage(ctx, resultChan, message) {
+				return
+			}
+		}
+		if !query.Follow {
+			return
+		}
+		followArgs := append(args, "--follow", "--lines", "all")
+		if len(messages) > 0 {
+			followArgs = append(followArgs, "--after-cursor", messages[0].ID)
+		} else if query.After == nil {
+			followArgs = append(followArgs, "--since", fmt.Sprintf("@%d", start.Unix()))
+		}
+		err = client.read(ctx, followArgs, func(message common.LogMessage) bool {
+			if !common.MatchesQuery(message, query) {
+				return true
+			}
+			message.Attributes = common.Project(message.Attributes, query.SelectFields)
+			return common.SendMessage(ctx, resultChan, message)
+		})
+		if err != nil {
+			fmt.Println(err)
+		}
+	}()
+	return resultChan
+}
+
+var _ common.Client = &JournalClient{}
@@ -0,0 +1,85 @@
+package journal
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+)
+
+func TestQueryArgs(t *testing.T) {
+	after := time.Unix(1538395200, 500)
+	args := queryArgs(common.Query{
+		EqualityFilters: []common.EqualityFilter{
+			{FieldName: "_SYSTEMD_UNIT", Operator: "=", Value: "nginx.service"},
+			{FieldName: "PRIORITY", Operator: "<", Value: "4"},
+			{FieldName: "PRIORITY", Operator: ">=", Value: "1"},
+			{FieldName: "level", Operator: "=", Value: "error"},
+		},
+		MembershipFilters: []common.MembershipFilter{
+			{FieldName: "_HOSTNAME", ValidValues: []string{"web-1", "web-2"}},
+		},
+		After: &after,
+	})
+	expected := "--output json --no-pager _SYSTEMD_UNIT=nginx.service _HOSTNAME=web-1 _HOSTNAME=web-2 --priority 1..3 --since @1538395200"
+	if strings.Join(args, " ") != expected {
+		t.Errorf("Unexpected arguments: %s", strings.Join(args, " "))
+	}
+}
+
+func TestParseEntry(t *testing.T) {
+	message, err := parseEntry([]byte(`{"__CURSOR": "s=1;i=2", "__REALTIME_TIMESTAMP": "1538395200123456", "_SYSTEMD_UNIT": "api.service", ` +
+		`"PRIORITY": "3", "MESSAGE": "{\"message\": \"Request failed\", \"request\": {\"path\": \"/\"}}"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message.ID != "s=1;i=2" || !message.Timestamp.Equal(time.Unix(1538395200, 123456000)) {
+		t.Errorf("Unexpected ID or timestamp: %s %s", message.ID, message.Timestamp)
+	}
+	expected := map[string]interface{}{
+		"_SYSTEMD_UNIT": "api.service",
+		"PRIORITY":      "3",
+		"message":       "Request failed",
+		"request.path":  "/",
+	}
+	if common.MustJsonEncode(message.Attributes) != common.MustJsonEncode(expected) {
+		t.Errorf("Unexpected attributes: %+v", message.Attributes)
+	}
+	// Binary messages are exported as byte arrays
+	message, err = parseEntry([]byte(`{"__REALTIME_TIMESTAMP": "1538395200000000", "MESSAGE": [104, 105, 7]}`))
+	if err != nil || message.Attributes["message"] != "hi\a" {
+		t.Errorf("Unexpected binary message: %+v %v", message.Attributes, err)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ax-journalctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// A fake journalctl that prints three entries in reverse order
+	script := "#!/bin/sh\n" +
+		"echo '{\"__CURSOR\": \"3\", \"__REALTIME_TIMESTAMP\": \"3000000\", \"MESSAGE\": \"third\", \"PRIORITY\": \"3\"}'\n" +
+		"echo '{\"__CURSOR\": \"2\", \"__REALTIME_TIMESTAMP\": \"2000000\", \"MESSAGE\": \"second\", \"PRIORITY\": \"6\"}'\n" +
+		"echo '{\"__CURSOR\": \"1\", \"__REALTIME_TIMESTAMP\": \"1000000\", \"MESSAGE\": \"first\", \"PRIORITY\": \"3\"}'\n"
+	command := filepath.Join(dir, "journalctl")
+	if err := ioutil.WriteFile(command, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	messages := make([]string, 0)
+	for message := range New([]string{command}).Query(context.Background(), common.Query{
+		EqualityFilters: []common.EqualityFilter{{FieldName: "PRIORITY", Operator: "<=", Value: "3"}},
+		MaxResults:      10,
+	}) {
+		messages = append(messages, message.Attributes["message"].(string))
+	}
+	if strings.Join(messages, " ") != "first third" {
+		t.Errorf("Unexpected messages: %v", messages)
+	}
+}
@@ -5,8 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/egnyte/ax/pkg/backend/common"
+	"github.com/egnyte/ax/pkg/backend/elasticsearch"
 )
 
 type Client struct {
@@ -23,8 +25,8 @@ func New(url, authHeader, index string) *Client {
 	}
 }
 
-func (client *Client) ImplementsAdvancedFilters() bool {
-	return false
+func (client *Client) SupportsFilter(filter common.FilterExpression) bool {
+	return elasticsearch.SupportsFilter(filter)
 }
 
 func (client *Client) addHeaders(req *http.Request) {
@@ -39,11 +41,13 @@ type indexList struct {
 		Type       string `json:"type"`
 		Attributes struct {
 			Title string `json:"title"`
+			// JSON encoded list of the index pattern's fields
+			Fields string `json:"fields"`
 		}
 	} `json:"saved_objects"`
 }
 
-func (client *Client) ListIndices() ([]string, error) {
+func (client *Client) indexPatterns() (*indexList, error) {
 	req, err := http.NewRequest("GET", fmt.Sprintf("%s/api/saved_objects/?type=index-pattern&per_page=10000", client.URL), nil)
 	if err != nil {
 		return nil, err
@@ -66,6 +70,14 @@ func (client *Client) ListIndices() ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
+	return &data, nil
+}
+
+func (client *Client) ListIndices() ([]string, error) {
+	data, err := client.indexPatterns()
+	if err != nil {
+		return nil, err
+	}
 	// Build list
 	indexNames := make([]string, 0, len(data.SavedObjects))
 	for _, indexInfo := range data.SavedObjects {
@@ -76,4 +88,50 @@ func (client *Client) ListIndices() ([]string, error) {
 	return indexNames, nil
 }
 
+// Kibana field types that have a different name in ax
+var kibanaFieldTypes = map[string]string{
+	"date":    "timestamp",
+	"boolean": "bool",
+}
+
+// ListFields returns the fields of the client's index pattern with their types, leaving out
+// Elasticsearch's metadata fields like _id
+func (client *Client) ListFields() (map[string]string, error) {
+	data, err := client.indexPatterns()
+	if err != nil {
+		return nil, err
+	}
+	for _, indexInfo := range data.SavedObjects {
+		if indexInfo.Type != "index-pattern" || indexInfo.Attributes.Title != client.Index {
+			continue
+		}
+		var fieldList []struct {
+			Name string `json:"name"`
+			Type string `json:"type"`
+		}
+		if indexInfo.Attributes.Fields != "" {
+			if err := json.Unmarshal([]byte(indexInfo.Attributes.Fields), &fieldList); err != nil {
+				return nil, err
+			}
+		}
+		fields := make(map[string]string)
+		for _, field := range fieldList {
+			if strings.HasPrefix(field.Name, "_") {
+				continue
+			}
+			if fieldType, ok := kibanaFieldTypes[field.Type]; ok {
+				fields[field.Name] = fieldType
+			} else {
+				fields[field.Name] = field.Type
+			}
+		}
+		return fields, nil
+	}
+	return nil, fmt.Errorf("Index pattern %s not found", client.Index)
+}
+
 var _ common.Client = &Client{}
+var _ common.StatsClient = &Client{}
+var _ common.HistogramClient = &Client{}
+var _ common.FieldLister = &Client{}
+var _ elasticsearch.Searcher = &Client{}
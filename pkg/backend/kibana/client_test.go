@@ -0,0 +1,139 @@
+package kibana
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+)
+
+func TestQueryThroughProxy(t *testing.T) {
+	openPITs := make(map[string]bool)
+	pitSupported := true
+	pitRequests, pitSearches := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Basic secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if _, ok := r.Header["Kbn-Version"]; !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/console/proxy":
+			if !pitSupported {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			switch path := r.URL.Query().Get("path"); {
+			case r.URL.Query().Get("method") == "POST" && path == "logs-*/_pit?keep_alive=5m&ignore_unavailable=true":
+				pitRequests++
+				openPITs["pit-1"] = true
+				w.Write([]byte(`{"id": "pit-1"}`))
+			case r.URL.Query().Get("method") == "DELETE" && path == "_pit":
+				var body map[string]string
+				json.NewDecoder(r.Body).Decode(&body)
+				delete(openPITs, body["id"])
+				w.Write([]byte(`{"succeeded": true}`))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case "/elasticsearch/_msearch":
+			scanner := bufio.NewScanner(r.Body)
+			scanner.Scan()
+			var header map[string]interface{}
+			if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+				t.Fatal(err)
+			}
+			headerText := scanner.Text()
+			scanner.Scan()
+			var body struct {
+				PIT  map[string]string        `json:"pit"`
+				Sort []map[string]interface{} `json:"sort"`
+			}
+			if err := json.Unmarshal(scanner.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.PIT != nil {
+				pitSearches++
+				if len(header) != 0 {
+					t.Errorf("Unexpected header, searching a point in time mustn't name indices: %s", headerText)
+				}
+				if !openPITs[body.PIT["id"]] {
+					t.Errorf("Expected search of an open point in time: %s", scanner.Text())
+				}
+			} else if len(body.Sort) != 1 || !reflect.DeepEqual(header["index"], []interface{}{"logs-*"}) {
+				t.Errorf("Expected a search of the index sorted on @timestamp: %s %s", headerText, scanner.Text())
+			}
+			for _, spec := range body.Sort {
+				if _, ok := spec["_id"]; ok {
+					t.Errorf("Sorting on _id is rejected by Elasticsearch 8: %s", scanner.Text())
+				}
+			}
+			w.Write([]byte(`{"responses": [{"pit_id": "pit-1", "hits": {"hits": [
+				{"_id": "1", "_source": {"@timestamp": "2018-10-01T12:00:00Z", "message": "Sup"}, "sort": [1538395200000, 7]}
+			]}, "status": 200}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	client := New(server.URL, "Basic secret", "logs-*")
+	tests := []struct {
+		maxResults   int
+		pitSupported bool
+		pitSearches  int
+	}{
+		{10, true, 0},   // Results that fit in one page don't need a point in time
+		{2000, true, 2}, // Finding the cutoff and streaming the results
+		{2000, false, 0},
+	}
+	for _, test := range tests {
+		pitSupported = test.pitSupported
+		pitRequests, pitSearches = 0, 0
+		messages := make([]common.LogMessage, 0)
+		for message := range client.Query(context.Background(), common.Query{MaxResults: test.maxResults}) {
+			messages = append(messages, message)
+		}
+		if len(messages) != 1 || messages[0].ID != "1" || messages[0].Attributes["message"] != "Sup" {
+			t.Errorf("Unexpected messages for %+v: %+v", test, messages)
+		}
+		if pitSearches != test.pitSearches || (test.maxResults <= 1000 && pitRequests != 0) {
+			t.Errorf("Expected %d searches of a point in time for %+v, got %d (%d opened)", test.pitSearches, test, pitSearches, pitRequests)
+		}
+		if len(openPITs) != 0 {
+			t.Errorf("Expected the point in time to be closed, still open: %v", openPITs)
+		}
+	}
+}
+
+func TestListFields(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/saved_objects/" || r.URL.Query().Get("type") != "index-pattern" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"saved_objects": [
+			{"type": "index-pattern", "attributes": {"title": "other-*", "fields": "[{\"name\": \"other\", \"type\": \"string\"}]"}},
+			{"type": "index-pattern", "attributes": {"title": "logs-*", "fields": "[{\"name\": \"_id\", \"type\": \"string\"}, {\"name\": \"@timestamp\", \"type\": \"date\"}, {\"name\": \"message\", \"type\": \"string\"}, {\"name\": \"took\", \"type\": \"number\"}, {\"name\": \"ok\", \"type\": \"boolean\"}]"}}
+		]}`))
+	}))
+	defer server.Close()
+	fields, err := New(server.URL, "", "logs-*").ListFields()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"@timestamp": "timestamp", "message": "string", "took": "number", "ok": "bool"}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("Unexpected fields: %v", fields)
+	}
+	if _, err := New(server.URL, "", "missing-*").ListFields(); err == nil {
+		t.Error("Expected an error for an unknown index pattern")
+	}
+}
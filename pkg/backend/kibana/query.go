@@ -1,212 +1,136 @@
 package kibana
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"sort"
-
-	"github.com/egnyte/ax/pkg/backend/common"
-
+	"net/url"
 	"os"
 
-	"time"
+	"github.com/egnyte/ax/pkg/backend/common"
+	"github.com/egnyte/ax/pkg/backend/elasticsearch"
 )
 
-type JsonObject map[string]interface{}
-type JsonList []interface{}
-
-type QueryResult struct {
-	Responses []struct {
-		Hits struct {
-			Hits []Hit `json:"hits"`
-		} `json:"hits"`
-	} `json:"responses"`
-}
-
-type Hit struct {
-	ID     string     `json:"_id"`
-	Source JsonObject `json:"_source"`
-}
-
-type hitsByAscDate []Hit
-
-func (a hitsByAscDate) Len() int      { return len(a) }
-func (a hitsByAscDate) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
-func (a hitsByAscDate) Less(i, j int) bool {
-	return a[i].Source["@timestamp"].(string) < a[j].Source["@timestamp"].(string)
-}
-
-func (client *Client) queryMessages(ctx context.Context, subIndex string, query common.Query) ([]Hit, error) {
-	queryString := fmt.Sprintf("\"%s\"", query.QueryString) // TODO: Handle quotes properly
-	if query.QueryString == "" {
-		queryString = "*"
-	}
-	mustFilters := JsonList{
-		JsonObject{
-			"query_string": JsonObject{
-				"analyze_wildcard": true,
-				"query":            queryString,
-			},
-		},
+// Sends a single search through Kibana's Elasticsearch _msearch proxy
+func (client *Client) post(ctx context.Context, searchBody elasticsearch.JsonObject) (*http.Response, error) {
+	header := elasticsearch.JsonObject{
+		"index":              elasticsearch.JsonList{client.Index},
+		"ignore_unavailable": true,
 	}
-
-	if query.After != nil || query.Before != nil {
-		rangeObj := JsonObject{
-			"range": JsonObject{
-				"@timestamp": JsonObject{
-					"format": "epoch_millis",
-				},
-			},
-		}
-		if query.After != nil {
-			rangeObj["range"].(JsonObject)["@timestamp"].(JsonObject)["gt"] = unixMillis(*query.After)
-		}
-		if query.Before != nil {
-			rangeObj["range"].(JsonObject)["@timestamp"].(JsonObject)["lt"] = unixMillis(*query.Before)
-		}
-		mustFilters = append(mustFilters, rangeObj)
-	}
-	mustNotFilters := JsonList{}
-	for _, filter := range query.EqualityFilters {
-		m := JsonObject{}
-		switch filter.Operator {
-		case "=":
-			m[filter.FieldName] = JsonObject{
-				"query": filter.Value,
-				"type":  "phrase",
-			}
-			mustFilters = append(mustFilters, JsonObject{
-				"match": m,
-			})
-		case "!=":
-			m[filter.FieldName] = JsonObject{
-				"query": filter.Value,
-				"type":  "phrase",
-			}
-			mustNotFilters = append(mustNotFilters, JsonObject{
-				"match": m,
-			})
-		}
+	if _, ok := searchBody["pit"]; ok {
+		// A point in time already determines the indices to search
+		header = elasticsearch.JsonObject{}
 	}
-	body, err := createMultiSearch(
-		JsonObject{
-			"index":              JsonList{subIndex},
-			"ignore_unavailable": true,
-		},
-		JsonObject{
-			"size": query.MaxResults,
-			"sort": JsonList{
-				JsonObject{
-					"@timestamp": JsonObject{
-						"order":         "desc",
-						"unmapped_type": "boolean",
-					},
-				},
-			},
-			"query": JsonObject{
-				"bool": JsonObject{
-					"must":     mustFilters,
-					"must_not": mustNotFilters,
-				},
-			},
-		})
+	body, err := createMultiSearch(header, searchBody)
 	if err != nil {
 		return nil, err
 	}
 	req, err := http.NewRequest("POST", fmt.Sprintf("%s/elasticsearch/_msearch", client.URL), body)
-	req = req.WithContext(ctx)
 	if err != nil {
 		return nil, err
 	}
+	req = req.WithContext(ctx)
 	client.addHeaders(req)
+	return http.DefaultClient.Do(req)
+}
 
-	resp, err := http.DefaultClient.Do(req)
+// Sends a request to Elasticsearch through Kibana's Console proxy, for APIs that the _msearch proxy doesn't cover
+func (client *Client) consoleProxy(ctx context.Context, method, path string, requestBody elasticsearch.JsonObject) (*http.Response, error) {
+	var body bytes.Buffer
+	if requestBody != nil {
+		if err := json.NewEncoder(&body).Encode(requestBody); err != nil {
+			return nil, err
+		}
+	}
+	proxyURL := fmt.Sprintf("%s/api/console/proxy?path=%s&method=%s", client.URL, url.QueryEscape(path), method)
+	req, err := http.NewRequest("POST", proxyURL, &body)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-	decoder := json.NewDecoder(resp.Body)
-	var data QueryResult
-	err = decoder.Decode(&data)
+	req = req.WithContext(ctx)
+	client.addHeaders(req)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
-	hits := data.Responses[0].Hits.Hits
-	sort.Sort(hitsByAscDate(hits))
-	return hits, nil
+	if resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+		return nil, errors.New("Authentication failed")
+	} else if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errors.New(resp.Status)
+	}
+	return resp, nil
+}
+
+// OpenPointInTime opens a point in time of the index pattern to page through consistently
+func (client *Client) OpenPointInTime(ctx context.Context, keepAlive string) (string, error) {
+	resp, err := client.consoleProxy(ctx, "POST", fmt.Sprintf("%s/_pit?keep_alive=%s&ignore_unavailable=true", client.Index, keepAlive), nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var data struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return "", err
+	}
+	return data.ID, nil
 }
 
-// Implements "follow" mode for Kibana.
-// Effectively this repeats the query every 5s and skips messages already seen
-// Previously this was implemented by only requesting messages with a timestamp
-// after the last seen one, but because sometimes logs arrive out of order, this
-// resulted in skipping logs.
-func (client *Client) queryFollow(ctx context.Context, q common.Query) <-chan common.LogMessage {
-	return common.ReQueryFollow(ctx, func() ([]common.LogMessage, error) {
-		return client.querySubIndex(ctx, client.Index, q)
-	})
+func (client *Client) ClosePointInTime(ctx context.Context, id string) error {
+	resp, err := client.consoleProxy(ctx, "DELETE", "_pit", elasticsearch.JsonObject{"id": id})
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
 }
 
-func (client *Client) Query(ctx context.Context, q common.Query) <-chan common.LogMessage {
-	resultChan := make(chan common.LogMessage)
-	if q.Before == nil {
-		before := time.Now().Add(12 * time.Hour)
-		q.Before = &before // Limit sanity
+// Search performs a single search through Kibana's Elasticsearch _msearch proxy,
+// calling emit for every hit as it is decoded from the response
+func (client *Client) Search(ctx context.Context, searchBody elasticsearch.JsonObject, emit func(elasticsearch.Hit) bool) (string, error) {
+	resp, err := client.post(ctx, searchBody)
+	if err != nil {
+		return "", err
 	}
-	if q.Follow {
-		return client.queryFollow(ctx, q)
+	defer resp.Body.Close()
+	pitID, err := elasticsearch.DecodeMultiSearchHits(resp.Body, emit)
+	if err != nil {
+		return "", fmt.Errorf("%v (%s)", err, resp.Status)
 	}
-	go func() {
-		printedResultsCount := 0
-		fmt.Fprintf(os.Stderr, "Querying index %s\n", client.Index)
-		allMessages, err := client.querySubIndex(ctx, client.Index, q)
-		// Check if the context wasn't canceled
-		select {
-		case <-ctx.Done():
-			close(resultChan)
-			return
-		default:
-		}
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Could not connect to Kibana: %v", err)
-			os.Exit(2)
-		}
-		for _, message := range allMessages {
-			resultChan <- message
-			printedResultsCount++
-			if printedResultsCount >= q.MaxResults {
-				break
-			}
-		}
-		close(resultChan)
-	}()
-
-	return resultChan
+	return pitID, nil
 }
 
-func (client *Client) querySubIndex(ctx context.Context, subIndex string, q common.Query) ([]common.LogMessage, error) {
-	hits, err := client.queryMessages(ctx, subIndex, q)
+// Aggregate performs a single search through Kibana's Elasticsearch _msearch proxy, returning its aggregations
+func (client *Client) Aggregate(ctx context.Context, searchBody elasticsearch.JsonObject) (elasticsearch.JsonObject, error) {
+	resp, err := client.post(ctx, searchBody)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
+	aggregations, err := elasticsearch.DecodeMultiSearchAggregations(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%v (%s)", err, resp.Status)
+	}
+	return aggregations, nil
+}
 
-	allMessages := make([]common.LogMessage, 0, 200)
-	for _, hit := range hits {
-		attributes := hit.Source
-		ts, err := time.Parse(time.RFC3339, attributes["@timestamp"].(string))
-		if err != nil {
-			return nil, err
-		}
-		delete(attributes, "@timestamp")
-		message := common.FlattenLogMessage(common.LogMessage{
-			ID:         hit.ID,
-			Timestamp:  ts,
-			Attributes: attributes,
-		})
-		message.Attributes = common.Project(message.Attributes, q.SelectFields)
-		allMessages = append(allMessages, message)
-	}
-	return allMessages, nil
+func (client *Client) Query(ctx context.Context, q common.Query) <-chan common.LogMessage {
+	if !q.Follow {
+		fmt.Fprintf(os.Stderr, "Querying index %s\n", client.Index)
+	}
+	return elasticsearch.Query(ctx, client, "Kibana", q)
+}
+
+func (client *Client) Stats(ctx context.Context, q common.StatsQuery) ([]common.StatsGroup, error) {
+	return elasticsearch.Stats(ctx, client, q)
+}
+
+func (client *Client) Histogram(ctx context.Context, q common.HistogramQuery) ([]common.HistogramBucket, error) {
+	return elasticsearch.Histogram(ctx, client, q)
 }
@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"io"
 	"regexp"
-	"time"
 )
 
 func createMultiSearch(objs ...interface{}) (io.Reader, error) {
@@ -25,7 +24,3 @@ func safeFilename(name string) string {
 	re := regexp.MustCompile(`[^\w\-]`)
 	return re.ReplaceAllString(name, "_")
 }
-
-func unixMillis(t time.Time) int64 {
-	return t.Unix() * 1000
-}
@@ -0,0 +1,218 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+	"github.com/egnyte/ax/pkg/backend/subprocess"
+)
+
+// Kubectl is the kubectl binary used to list pods and stream their logs
+var Kubectl = "kubectl"
+
+type Pod struct {
+	Namespace  string
+	Name       string
+	Containers []string
+}
+
+type KubernetesClient struct {
+	namespace  string // Empty for kubectl's current namespace
+	selector   string // Label selector, e.g. app=web
+	podPattern string // Substring pod names have to contain
+}
+
+type podList struct {
+	Items []struct {
+		Metadata struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"metadata"`
+		Spec struct {
+			Containers []struct {
+				Name string `json:"name"`
+			} `json:"containers"`
+		} `json:"spec"`
+		Status struct {
+			Phase string `json:"phase"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+// Parses the output of `kubectl get pods -o json`, only returning pods that have (or had) running containers
+func parsePods(output []byte, podPattern string) ([]Pod, error) {
+	var list podList
+	if err := json.Unmarshal(output, &list); err != nil {
+		return nil, err
+	}
+	pods := make([]Pod, 0, len(list.Items))
+	for _, item := range list.Items {
+		if item.Status.Phase == "Pending" || item.Status.Phase == "Unknown" {
+			// No logs to fetch (yet)
+			continue
+		}
+		if !strings.Contains(item.Metadata.Name, podPattern) {
+			continue
+		}
+		pod := Pod{Namespace: item.Metadata.Namespace, Name: item.Metadata.Name}
+		for _, container := range item.Spec.Containers {
+			pod.Containers = append(pod.Containers, container.Name)
+		}
+		pods = append(pods, pod)
+	}
+	return pods, nil
+}
+
+func namespaceFlags(namespace string) []string {
+	if namespace == "" {
+		return []string{}
+	}
+	return []string{"--namespace", namespace}
+}
+
+func GetPods(namespace, selector, podPattern string) ([]Pod, error) {
+	flags := append([]string{"get", "pods", "--output", "json"}, namespaceFlags(namespace)...)
+	if selector != "" {
+		flags = append(flags, "--selector", selector)
+	}
+	output, err := exec.Command(Kubectl, flags...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("Retrieving pods failed: %v", err)
+	}
+	return parsePods(output, podPattern)
+}
+
+func PodHintAction() []string {
+	pods, err := GetPods("", "", "")
+	if err != nil {
+		log.Println(err)
+		return []string{}
+	}
+	podNames := make([]string, 0, len(pods))
+	for _, pod := range pods {
+		podNames = append(podNames, pod.Name)
+	}
+	return podNames
+}
+
+func NamespaceHintAction() []string {
+	output, err := exec.Command(Kubectl, "get", "namespaces", "--output", "jsonpath={.items[*].metadata.name}").Output()
+	if err != nil {
+		log.Printf("Retrieving namespaces failed: %v\n", err)
+		return []string{}
+	}
+	return strings.Fields(string(output))
+}
+
+// Builds the kubectl logs command for a container, pods that started after the query began
+// (in follow mode) have all of their logs fetched instead of the last query.MaxResults lines.
+// Lines are prefixed with the time they were logged, to merge them by.
+func logsCommand(pod Pod, container string, query common.Query, newPod bool) []string {
+	command := []string{Kubectl, "logs", pod.Name, "--container", container, "--namespace", pod.Namespace, "--timestamps"}
+	if !newPod {
+		command = append(command, "--tail", fmt.Sprintf("%d", query.MaxResults))
+	}
+	if query.Follow {
+		command = append(command, "--follow")
+	}
+	return command
+}
+
+func (client *KubernetesClient) SupportsFilter(filter common.FilterExpression) bool {
+	return true
+}
+
+// Adds @namespace, @pod and @container attributes to all messages
+func tagMessages(ctx context.Context, pod Pod, container string, messages <-chan common.LogMessage) <-chan common.LogMessage {
+	resultChan := make(chan common.LogMessage)
+	go func() {
+		defer close(resultChan)
+		for message := range messages {
+			message.Attributes["@namespace"] = pod.Namespace
+			message.Attributes["@pod"] = pod.Name
+			message.Attributes["@container"] = container
+			if !common.SendMessage(ctx, resultChan, message) {
+				return
+			}
+		}
+	}()
+	return resultChan
+}
+
+func (client *KubernetesClient) Query(ctx context.Context, query common.Query) <-chan common.LogMessage {
+	sources := make(chan (<-chan common.LogMessage))
+	window := time.Duration(0)
+	if query.Follow {
+		window = common.FollowReorderWindow
+	}
+	merged := common.MergeByTimestamp(ctx, sources, window)
+	go func() {
+		defer close(sources)
+		started := make(map[string]bool)
+		streamLogs := func(pods []Pod, newPods bool) bool {
+			for _, pod := range pods {
+				for _, container := range pod.Containers {
+					key := fmt.Sprintf("%s/%s/%s", pod.Namespace, pod.Name, container)
+					if started[key] {
+						continue
+					}
+					started[key] = true
+					source := tagMessages(ctx, pod, container, subprocess.NewTimestamped(logsCommand(pod, container, query, newPods)).Query(ctx, query))
+					select {
+					case sources <- source:
+					case <-ctx.Done():
+						return false
+					}
+				}
+			}
+			return true
+		}
+
+		pods, err := GetPods(client.namespace, client.selector, client.podPattern)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if !streamLogs(pods, false) || !query.Follow {
+			return
+		}
+		// Look for pods that started after the query began
+		pollInterval := query.PollInterval
+		if pollInterval == 0 {
+			pollInterval = common.FollowPollTime
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(pollInterval):
+			}
+			pods, err := GetPods(client.namespace, client.selector, client.podPattern)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				continue
+			}
+			if !streamLogs(pods, true) {
+				return
+			}
+		}
+	}()
+	if query.Follow {
+		return merged
+	}
+	// Every container returns its query.MaxResults most recent messages, keep the most recent of all of those
+	return common.MostRecent(ctx, merged, query.MaxResults)
+}
+
+func New(namespace, selector, podPattern string) *KubernetesClient {
+	return &KubernetesClient{namespace, selector, podPattern}
+}
+
+var _ common.Client = &KubernetesClient{}
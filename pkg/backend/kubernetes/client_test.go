@@ -0,0 +1,96 @@
+package kubernetes
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+)
+
+const podsJSON = `{"items": [
+	{"metadata": {"name": "web-1", "namespace": "prod"}, "spec": {"containers": [{"name": "app"}, {"name": "proxy"}]}, "status": {"phase": "Running"}},
+	{"metadata": {"name": "web-2", "namespace": "prod"}, "spec": {"containers": [{"name": "app"}]}, "status": {"phase": "Pending"}},
+	{"metadata": {"name": "worker-1", "namespace": "prod"}, "spec": {"containers": [{"name": "app"}]}, "status": {"phase": "Succeeded"}}
+]}`
+
+func TestParsePods(t *testing.T) {
+	pods, err := parsePods([]byte(podsJSON), "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Pod{{Namespace: "prod", Name: "web-1", Containers: []string{"app", "proxy"}}}
+	if !reflect.DeepEqual(pods, expected) {
+		t.Errorf("Unexpected pods: %+v", pods)
+	}
+	if pods, _ := parsePods([]byte(podsJSON), ""); len(pods) != 2 {
+		t.Errorf("Expected all pods with logs, got %+v", pods)
+	}
+}
+
+func TestLogsCommand(t *testing.T) {
+	pod := Pod{Namespace: "prod", Name: "web-1"}
+	command := strings.Join(logsCommand(pod, "app", common.Query{MaxResults: 20, Follow: true}, false), " ")
+	if command != "kubectl logs web-1 --container app --namespace prod --timestamps --tail 20 --follow" {
+		t.Error(command)
+	}
+	command = strings.Join(logsCommand(pod, "app", common.Query{MaxResults: 20, Follow: true}, true), " ")
+	if command != "kubectl logs web-1 --container app --namespace prod --timestamps --follow" {
+		t.Error(command)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ax-kubectl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// A fake kubectl that lists the pods above, and prints log lines naming the pod and container, prefixed
+	// with their timestamp. The line on stderr is older than the one on stdout, but printed after it.
+	script := "#!/bin/sh\n" +
+		"if [ \"$1\" = get ]; then\n" +
+		"  echo '" + podsJSON + "'\n" +
+		"  exit\n" +
+		"fi\n" +
+		"case \"$2 $4\" in\n" +
+		"  'web-1 app') n=3;;\n" +
+		"  'web-1 proxy') n=1;;\n" +
+		"  *) n=2;;\n" +
+		"esac\n" +
+		"echo \"2018-10-01T12:00:0$n.000000000Z {\\\"message\\\": \\\"Hello from $2 $4\\\"}\"\n" +
+		"sleep 0.1\n" +
+		"echo \"2018-10-01T12:00:00.${n}00000000Z Starting $2 $4\" >&2\n"
+	Kubectl = filepath.Join(dir, "kubectl")
+	defer func() { Kubectl = "kubectl" }()
+	if err := ioutil.WriteFile(Kubectl, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := make([]string, 0)
+	for message := range New("prod", "", "").Query(context.Background(), common.Query{MaxResults: 10}) {
+		messages = append(messages, strings.Join([]string{
+			message.Timestamp.Format("05.0"),
+			message.Attributes["@namespace"].(string),
+			message.Attributes["@pod"].(string),
+			message.Attributes["@container"].(string),
+			message.Attributes["message"].(string),
+		}, " "))
+	}
+	// Ordered by the timestamps kubectl prefixed the lines with, across pods as well as stdout and stderr
+	expected := []string{
+		"00.1 prod web-1 proxy Starting web-1 proxy",
+		"00.2 prod worker-1 app Starting worker-1 app",
+		"00.3 prod web-1 app Starting web-1 app",
+		"01.0 prod web-1 proxy Hello from web-1 proxy",
+		"02.0 prod worker-1 app Hello from worker-1 app",
+		"03.0 prod web-1 app Hello from web-1 app",
+	}
+	if !reflect.DeepEqual(messages, expected) {
+		t.Errorf("Unexpected messages: %v", messages)
+	}
+}
@@ -0,0 +1,376 @@
+package loki
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Maximum number of entries requested from Loki at once (Loki's default limit is 5000)
+	PageSize = 1000
+	// How far back to look when no --after or --last is given, Loki doesn't allow unbounded queries
+	DefaultLookback = 24 * time.Hour
+)
+
+type Client struct {
+	URL        string
+	AuthHeader string
+	Selector   string // Stream selector all queries start from, e.g. {namespace="prod"}
+	labels     map[string]bool
+	labelsOnce sync.Once
+}
+
+func New(url, authHeader, selector string) *Client {
+	return &Client{
+		URL:        strings.TrimSuffix(url, "/"),
+		AuthHeader: authHeader,
+		Selector:   selector,
+	}
+}
+
+func (client *Client) SupportsFilter(filter common.FilterExpression) bool {
+	return supportsFilter(filter)
+}
+
+func (client *Client) addHeaders(header http.Header) {
+	if client.AuthHeader != "" {
+		header.Set("Authorization", client.AuthHeader)
+	}
+}
+
+func (client *Client) get(ctx context.Context, path string, params url.Values, dst interface{}) error {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s%s?%s", client.URL, path, params.Encode()), nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	client.addHeaders(req.Header)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		return errors.New("Authentication failed")
+	} else if resp.StatusCode != http.StatusOK {
+		var body strings.Builder
+		fmt.Fprintf(&body, "%s: ", resp.Status)
+		buf := make([]byte, 1024)
+		n, _ := resp.Body.Read(buf)
+		body.Write(buf[:n])
+		return errors.New(strings.TrimSpace(body.String()))
+	}
+	return json.NewDecoder(resp.Body).Decode(dst)
+}
+
+// ListLabels lists the names of all labels (which streams are selected by)
+func (client *Client) ListLabels() ([]string, error) {
+	var data struct {
+		Data []string `json:"data"`
+	}
+	err := client.get(context.Background(), "/loki/api/v1/labels", url.Values{}, &data)
+	if err != nil {
+		return nil, err
+	}
+	return data.Data, nil
+}
+
+// Label names are fetched once, if that fails all filters are applied as label filters after parsing
+func (client *Client) labelNames() map[string]bool {
+	client.labelsOnce.Do(func() {
+		client.labels = make(map[string]bool)
+		names, err := client.ListLabels()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not list Loki labels: %v\n", err)
+			return
+		}
+		for _, name := range names {
+			client.labels[name] = true
+		}
+	})
+	return client.labels
+}
+
+type stream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+type entry struct {
+	labels    map[string]string
+	timestamp int64 // Unix nanoseconds
+	line      string
+}
+
+func streamsToEntries(streams []stream) ([]entry, error) {
+	entries := make([]entry, 0)
+	for _, s := range streams {
+		for _, value := range s.Values {
+			ts, err := strconv.ParseInt(value[0], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid timestamp from Loki: %s", value[0])
+			}
+			entries = append(entries, entry{labels: s.Stream, timestamp: ts, line: value[1]})
+		}
+	}
+	return entries, nil
+}
+
+func (e entry) id() string {
+	keys := make([]string, 0, len(e.labels))
+	for key := range e.labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	h := sha1.New()
+	for _, key := range keys {
+		fmt.Fprintf(h, "%s=%s,", key, e.labels[key])
+	}
+	fmt.Fprintf(h, "%d %s", e.timestamp, e.line)
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+func (e entry) toMessage(query common.Query) common.LogMessage {
+	message := common.NewLogMessage()
+	message.ID = e.id()
+	message.Timestamp = time.Unix(0, e.timestamp)
+	for key, value := range e.labels {
+		message.Attributes[key] = value
+	}
+	var parsed map[string]interface{}
+	if strings.HasPrefix(strings.TrimSpace(e.line), "{") && json.Unmarshal([]byte(e.line), &parsed) == nil {
+		for key, value := range parsed {
+			message.Attributes[key] = value
+		}
+	} else {
+		message.Attributes["message"] = e.line
+	}
+	message = common.FlattenLogMessage(message)
+	message.Attributes = common.Project(message.Attributes, query.SelectFields)
+	return message
+}
+
+func (client *Client) queryRange(ctx context.Context, logQL string, start, end time.Time, limit int) ([]entry, error) {
+	var data struct {
+		Data struct {
+			ResultType string   `json:"resultType"`
+			Result     []stream `json:"result"`
+		} `json:"data"`
+	}
+	err := client.get(ctx, "/loki/api/v1/query_range", url.Values{
+		"query":     {logQL},
+		"start":     {strconv.FormatInt(start.UnixNano(), 10)},
+		"end":       {strconv.FormatInt(end.UnixNano(), 10)},
+		"limit":     {strconv.Itoa(limit)},
+		"direction": {"backward"},
+	}, &data)
+	if err != nil {
+		return nil, err
+	}
+	if data.Data.ResultType != "streams" {
+		return nil, fmt.Errorf("Unexpected result type from Loki: %s", data.Data.ResultType)
+	}
+	return streamsToEntries(data.Data.Result)
+}
+
+// Pages backwards through the query.MaxResults most recent entries, and returns them in ascending order
+func (client *Client) queryEntries(ctx context.Context, logQL string, query common.Query) ([]entry, error) {
+	end := time.Now()
+	if query.Before != nil {
+		end = *query.Before
+	}
+	start := end.Add(-DefaultLookback)
+	if query.After != nil {
+		start = *query.After
+	}
+	result := make([]entry, 0, 200)
+	// Pages overlap by a nanosecond (in case there are more entries at the page boundary), so skip entries seen already
+	seenAtBoundary := make(map[string]bool)
+	for len(result) < query.MaxResults {
+		// Entries at the boundary are returned again, so ask for that many more
+		limit := query.MaxResults - len(result) + len(seenAtBoundary)
+		if limit > PageSize {
+			limit = PageSize
+		}
+		entries, err := client.queryRange(ctx, logQL, start, end, limit)
+		if err != nil {
+			return nil, err
+		}
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].timestamp > entries[j].timestamp
+		})
+		added := 0
+		for _, e := range entries {
+			if seenAtBoundary[e.id()] || len(result) >= query.MaxResults {
+				continue
+			}
+			result = append(result, e)
+			added++
+		}
+		if len(entries) < limit || added == 0 {
+			break
+		}
+		boundary := result[len(result)-1].timestamp
+		seenAtBoundary = make(map[string]bool)
+		for i := len(result) - 1; i >= 0 && result[i].timestamp == boundary; i-- {
+			seenAtBoundary[result[i].id()] = true
+		}
+		end = time.Unix(0, boundary+1)
+	}
+	// Reverse into ascending order
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result, nil
+}
+
+func (client *Client) sendEntries(ctx context.Context, logQL string, query common.Query, resultChan chan<- common.LogMessage) error {
+	entries, err := client.queryEntries(ctx, logQL, query)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !common.SendMessage(ctx, resultChan, e.toMessage(query)) {
+			return nil
+		}
+	}
+	return nil
+}
+
+type tailResponse struct {
+	Streams        []stream `json:"streams"`
+	DroppedEntries []struct {
+		Labels    map[string]string `json:"labels"`
+		Timestamp string            `json:"timestamp"`
+	} `json:"dropped_entries"`
+}
+
+// Streams entries from Loki's tail websocket, starting at start, until the connection fails or ctx is canceled.
+// Returns the timestamp of the last entry received, so tailing can resume from there.
+func (client *Client) tail(ctx context.Context, logQL string, query common.Query, start time.Time, seen map[string]bool, resultChan chan<- common.LogMessage) (time.Time, error) {
+	tailURL := strings.Replace(client.URL, "http", "ws", 1) + "/loki/api/v1/tail?" + url.Values{
+		"query": {logQL},
+		"start": {strconv.FormatInt(start.UnixNano(), 10)},
+		"limit": {strconv.Itoa(PageSize)},
+	}.Encode()
+	header := http.Header{}
+	client.addHeaders(header)
+	conn, resp, err := websocket.DefaultDialer.Dial(tailURL, header)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusUnauthorized {
+			return start, errors.New("Authentication failed")
+		}
+		return start, err
+	}
+	defer conn.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	for {
+		var data tailResponse
+		if err := conn.ReadJSON(&data); err != nil {
+			return start, err
+		}
+		if len(data.DroppedEntries) > 0 {
+			fmt.Fprintf(os.Stderr, "Loki dropped %d entries while tailing\n", len(data.DroppedEntries))
+		}
+		entries, err := streamsToEntries(data.Streams)
+		if err != nil {
+			return start, err
+		}
+		for _, e := range entries {
+			id := e.id()
+			if seen[id] {
+				continue
+			}
+			if e.timestamp > start.UnixNano() {
+				// Only entries at the latest timestamp can be received again when resuming
+				for key := range seen {
+					delete(seen, key)
+				}
+				start = time.Unix(0, e.timestamp)
+			}
+			seen[id] = true
+			if !common.SendMessage(ctx, resultChan, e.toMessage(query)) {
+				return start, nil
+			}
+		}
+	}
+}
+
+// Implements "follow" mode: first sends the most recent messages, then tails new ones through
+// Loki's tail websocket, reconnecting (from the last entry received) when the connection drops
+func (client *Client) follow(ctx context.Context, logQL string, query common.Query, resultChan chan<- common.LogMessage) {
+	start := time.Now()
+	backlogQuery := query
+	backlogQuery.Before = &start
+	if err := client.sendEntries(ctx, logQL, backlogQuery, resultChan); err != nil && ctx.Err() == nil {
+		fmt.Printf("Error while fetching logs: %s\n", err)
+	}
+	seen := make(map[string]bool)
+	retries := 0
+	for ctx.Err() == nil {
+		resumed, err := client.tail(ctx, logQL, query, start, seen, resultChan)
+		if ctx.Err() != nil {
+			return
+		}
+		if resumed.After(start) {
+			// Received entries, so reset retry count
+			retries = 0
+			start = resumed
+		}
+		retries++
+		if retries >= common.ConnectionRetries {
+			fmt.Fprintf(os.Stderr, "Could not connect: %v\nExceeded total number of retries, exiting.\n", err)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Could not connect: %v retrying in %s\n", err, common.FollowPollTime)
+		select {
+		case <-time.After(common.FollowPollTime):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (client *Client) Query(ctx context.Context, query common.Query) <-chan common.LogMessage {
+	resultChan := make(chan common.LogMessage)
+	go func() {
+		defer close(resultChan)
+		logQL, err := queryToLogQL(query, client.Selector, client.labelNames())
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if query.Follow {
+			client.follow(ctx, logQL, query, resultChan)
+			return
+		}
+		if err := client.sendEntries(ctx, logQL, query, resultChan); err != nil && ctx.Err() == nil {
+			fmt.Printf("Error while fetching logs: %s\n", err)
+		}
+	}()
+	return resultChan
+}
+
+var _ common.Client = &Client{}
@@ -0,0 +1,159 @@
+package loki
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+	"github.com/gorilla/websocket"
+)
+
+type fakeLine struct {
+	ts   int64 // Unix nanoseconds
+	line string
+}
+
+// A minimal stand-in for Loki that serves a single stream, query_range only implements
+// start, end, limit and backward direction (lines must be added in ascending order), tail sends everything pushed to its channel
+type fakeLoki struct {
+	mutex    sync.Mutex
+	lines    []fakeLine
+	queries  []string
+	tailFrom []string
+	tail     chan fakeLine
+}
+
+func (f *fakeLoki) streams(lines []fakeLine) []stream {
+	values := make([][2]string, 0, len(lines))
+	for _, l := range lines {
+		values = append(values, [2]string{strconv.FormatInt(l.ts, 10), l.line})
+	}
+	return []stream{{Stream: map[string]string{"app": "api"}, Values: values}}
+}
+
+func (f *fakeLoki) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	params := r.URL.Query()
+	switch r.URL.Path {
+	case "/loki/api/v1/labels":
+		fmt.Fprint(w, `{"status": "success", "data": ["app"]}`)
+	case "/loki/api/v1/query_range":
+		f.queries = append(f.queries, params.Get("query"))
+		start, _ := strconv.ParseInt(params.Get("start"), 10, 64)
+		end, _ := strconv.ParseInt(params.Get("end"), 10, 64)
+		limit, _ := strconv.Atoi(params.Get("limit"))
+		// Lines are kept in ascending order, so iterate backwards
+		lines := make([]fakeLine, 0)
+		for i := len(f.lines) - 1; i >= 0; i-- {
+			// Like Loki, start is inclusive and end is exclusive
+			if l := f.lines[i]; l.ts >= start && l.ts < end {
+				lines = append(lines, l)
+			}
+		}
+		if len(lines) > limit {
+			lines = lines[:limit]
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "success",
+			"data":   map[string]interface{}{"resultType": "streams", "result": f.streams(lines)},
+		})
+	case "/loki/api/v1/tail":
+		f.tailFrom = append(f.tailFrom, params.Get("start"))
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		f.mutex.Unlock()
+		defer f.mutex.Lock()
+		defer conn.Close()
+		for l := range f.tail {
+			if err := conn.WriteJSON(tailResponse{Streams: f.streams([]fakeLine{l})}); err != nil {
+				return
+			}
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestQueryPaging(t *testing.T) {
+	base := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC).UnixNano()
+	loki := &fakeLoki{}
+	for i := 0; i < 2500; i++ {
+		// Two lines per timestamp, so page boundaries split timestamps
+		loki.lines = append(loki.lines, fakeLine{ts: base + int64(i/2), line: fmt.Sprintf(`{"level": "info", "n": %d}`, i)})
+	}
+	server := httptest.NewServer(loki)
+	defer server.Close()
+
+	client := New(server.URL+"/", "Bearer secret", `{app="api"}`)
+	after := time.Unix(0, base)
+	before := time.Unix(0, base+10000)
+	messages := make([]common.LogMessage, 0)
+	for message := range client.Query(context.Background(), common.Query{
+		QueryString:     "info",
+		EqualityFilters: []common.EqualityFilter{{FieldName: "level", Operator: "=", Value: "info"}},
+		After:           &after,
+		Before:          &before,
+		MaxResults:      2100,
+	}) {
+		messages = append(messages, message)
+	}
+	if len(messages) != 2100 {
+		t.Fatalf("Expected 2100 messages, got %d", len(messages))
+	}
+	for i, message := range messages {
+		if n := message.Attributes["n"]; n != float64(400+i) {
+			t.Fatalf("Expected message %d to be n=%d, got %v", i, 400+i, n)
+		}
+		if message.Attributes["app"] != "api" {
+			t.Fatalf("Expected stream labels in attributes, got %+v", message.Attributes)
+		}
+	}
+	if len(loki.queries) != 3 || loki.queries[0] != `{app="api"} |~ "(?i)info" | json | level="info"` {
+		t.Errorf("Unexpected queries: %v", loki.queries)
+	}
+}
+
+func TestFollow(t *testing.T) {
+	now := time.Now().UnixNano()
+	loki := &fakeLoki{
+		lines: []fakeLine{{ts: now - int64(time.Second), line: "backlog"}},
+		tail:  make(chan fakeLine),
+	}
+	server := httptest.NewServer(loki)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := New(server.URL, "Bearer secret", `{app="api"}`)
+	results := client.Query(ctx, common.Query{Follow: true, MaxResults: 10})
+	if message := <-results; message.Attributes["message"] != "backlog" {
+		t.Errorf("Expected the existing line first, got %+v", message)
+	}
+	loki.tail <- fakeLine{ts: now + int64(time.Second), line: "new"}
+	if message := <-results; message.Attributes["message"] != "new" {
+		t.Errorf("Expected the new line, got %+v", message)
+	}
+	cancel()
+	for range results {
+	}
+	close(loki.tail)
+	loki.mutex.Lock()
+	defer loki.mutex.Unlock()
+	if len(loki.tailFrom) != 1 {
+		t.Errorf("Expected to tail once, got %v", loki.tailFrom)
+	}
+}
@@ -0,0 +1,191 @@
+package loki
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+)
+
+// LogQL label names only allow [a-zA-Z0-9_], the json parser replaces anything else
+// (including the dots separating nested fields) with underscores
+var invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+func labelName(fieldName string) string {
+	return invalidLabelChars.ReplaceAllString(fieldName, "_")
+}
+
+// LogQL regexes (in stream selectors and label filters) are always anchored, so we translate
+// Go's "find anywhere" semantics by padding with .* unless explicitly anchored
+func anchoredPattern(re *regexp.Regexp) string {
+	pattern, caseInsensitive := common.AnchoredPattern(re)
+	if caseInsensitive {
+		return "(?i)" + pattern
+	}
+	return pattern
+}
+
+func membersPattern(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, value := range values {
+		quoted = append(quoted, regexp.QuoteMeta(value))
+	}
+	return strings.Join(quoted, "|")
+}
+
+func equalityFilterToLogQL(filter common.EqualityFilter) string {
+	if common.IsOrderingOperator(filter.Operator) {
+		// Numbers are compared numerically when unquoted
+		return fmt.Sprintf("%s%s%s", labelName(filter.FieldName), filter.Operator, filter.Value)
+	}
+	return fmt.Sprintf("%s%s%s", labelName(filter.FieldName), filter.Operator, strconv.Quote(filter.Value))
+}
+
+func regexFilterToLogQL(filter common.RegexFilter) string {
+	operator := "=~"
+	if filter.Negated {
+		operator = "!~"
+	}
+	return fmt.Sprintf("%s%s%s", labelName(filter.FieldName), operator, strconv.Quote(anchoredPattern(filter.Regexp)))
+}
+
+// Translates a filter expression (with negations pushed down) into a LogQL label filter expression
+func filterExpressionToLogQL(expr common.FilterExpression) string {
+	switch e := expr.(type) {
+	case common.AndExpression:
+		return fmt.Sprintf("(%s)", strings.Join(filterExpressionsToLogQL(e.Operands), " and "))
+	case common.OrExpression:
+		return fmt.Sprintf("(%s)", strings.Join(filterExpressionsToLogQL(e.Operands), " or "))
+	case common.EqualityFilter:
+		return equalityFilterToLogQL(e)
+	case common.RegexFilter:
+		return regexFilterToLogQL(e)
+	default:
+		panic(fmt.Sprintf("Unsupported filter expression: %+v", expr))
+	}
+}
+
+func filterExpressionsToLogQL(exprs []common.FilterExpression) []string {
+	parts := make([]string, 0, len(exprs))
+	for _, expr := range exprs {
+		parts = append(parts, filterExpressionToLogQL(expr))
+	}
+	return parts
+}
+
+// LogQL label filters have no NOT, and only compare numbers with >, >=, < and <=
+func supportsFilter(filter common.FilterExpression) bool {
+	filter = common.PushDownNegations(filter)
+	if containsNegation(filter) {
+		return false
+	}
+	return common.AllFiltersSupported(filter, func(leaf common.FilterExpression) bool {
+		switch f := leaf.(type) {
+		case common.EqualityFilter:
+			if common.IsOrderingOperator(f.Operator) {
+				_, ok := common.ParseNumber(f.Value)
+				return ok
+			}
+			return true
+		case common.RegexFilter, common.ExistenceFilter, common.MembershipFilter:
+			return true
+		default:
+			return false
+		}
+	})
+}
+
+// Whether a NOT is left that couldn't be pushed into its operand (e.g. NOT on a range comparison)
+func containsNegation(expr common.FilterExpression) bool {
+	switch e := expr.(type) {
+	case common.AndExpression:
+		return anyContainsNegation(e.Operands)
+	case common.OrExpression:
+		return anyContainsNegation(e.Operands)
+	case common.NotExpression:
+		return true
+	default:
+		return false
+	}
+}
+
+func anyContainsNegation(exprs []common.FilterExpression) bool {
+	for _, expr := range exprs {
+		if containsNegation(expr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Translates a query into LogQL, see https://grafana.com/docs/loki/latest/query/
+// Filters on fields in labels become part of the stream selector (which is a lot more efficient),
+// all others are applied as label filters after parsing the log line as JSON.
+// baseSelector is the stream selector to start from, e.g. {namespace="prod"}
+func queryToLogQL(query common.Query, baseSelector string, labels map[string]bool) (string, error) {
+	matchers := make([]string, 0)
+	baseSelector = strings.TrimSpace(baseSelector)
+	baseSelector = strings.TrimSuffix(strings.TrimPrefix(baseSelector, "{"), "}")
+	if strings.TrimSpace(baseSelector) != "" {
+		matchers = append(matchers, baseSelector)
+	}
+	labelFilters := make([]string, 0)
+	for _, filter := range query.EqualityFilters {
+		if labels[filter.FieldName] && !common.IsOrderingOperator(filter.Operator) {
+			matchers = append(matchers, equalityFilterToLogQL(filter))
+		} else {
+			labelFilters = append(labelFilters, equalityFilterToLogQL(filter))
+		}
+	}
+	for _, filter := range query.RegexFilters {
+		if labels[filter.FieldName] {
+			matchers = append(matchers, regexFilterToLogQL(filter))
+		} else {
+			labelFilters = append(labelFilters, regexFilterToLogQL(filter))
+		}
+	}
+	for _, filter := range query.MembershipFilters {
+		name := labelName(filter.FieldName)
+		parts := make([]string, 0, 2)
+		if len(filter.ValidValues) > 0 {
+			parts = append(parts, fmt.Sprintf("%s=~%s", name, strconv.Quote(membersPattern(filter.ValidValues))))
+		}
+		if len(filter.InvalidValues) > 0 {
+			parts = append(parts, fmt.Sprintf("%s!~%s", name, strconv.Quote(membersPattern(filter.InvalidValues))))
+		}
+		if labels[filter.FieldName] {
+			matchers = append(matchers, parts...)
+		} else {
+			labelFilters = append(labelFilters, parts...)
+		}
+	}
+	for _, filter := range query.ExistenceFilters {
+		if filter.Exists {
+			labelFilters = append(labelFilters, fmt.Sprintf(`%s!=""`, labelName(filter.FieldName)))
+		} else {
+			labelFilters = append(labelFilters, fmt.Sprintf(`%s=""`, labelName(filter.FieldName)))
+		}
+	}
+	if query.Filter != nil {
+		labelFilters = append(labelFilters, filterExpressionToLogQL(common.PushDownNegations(query.Filter)))
+	}
+	if len(matchers) == 0 {
+		return "", fmt.Errorf("Loki needs a stream selector, configure one for this environment or filter on a label")
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "{%s}", strings.Join(matchers, ", "))
+	if query.QueryString != "" {
+		// Phrase search is case-insensitive like on other backends, which |= isn't
+		fmt.Fprintf(&sb, " |~ %s", strconv.Quote("(?i)"+regexp.QuoteMeta(query.QueryString)))
+	}
+	if len(labelFilters) > 0 {
+		sb.WriteString(" | json")
+		for _, labelFilter := range labelFilters {
+			fmt.Fprintf(&sb, " | %s", labelFilter)
+		}
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,99 @@
+package loki
+
+import (
+	"testing"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+)
+
+func TestQueryToLogQL(t *testing.T) {
+	labels := map[string]bool{"app": true, "namespace": true}
+	regexFilter, err := common.NewRegexFilter("path", "^/api/", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter, err := common.ParseFilterExpression("NOT (level=error OR path~^/health) AND duration_ms>500")
+	if err != nil {
+		t.Fatal(err)
+	}
+	alternationFilter, err := common.NewRegexFilter("path", "(?i)^/api|users$", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		query    common.Query
+		selector string
+		expected string
+	}{
+		{
+			common.Query{QueryString: "timeout"},
+			`{namespace="prod"}`,
+			`{namespace="prod"} |~ "(?i)timeout"`,
+		},
+		{
+			common.Query{QueryString: `GET /api?id=1 "x"`},
+			`{namespace="prod"}`,
+			`{namespace="prod"} |~ "(?i)GET /api\\?id=1 \"x\""`,
+		},
+		{
+			common.Query{EqualityFilters: []common.EqualityFilter{
+				{FieldName: "app", Operator: "=", Value: "api"},
+				{FieldName: "user.name", Operator: "!=", Value: "zef"},
+			}},
+			"",
+			`{app="api"} | json | user_name!="zef"`,
+		},
+		{
+			common.Query{
+				RegexFilters: []common.RegexFilter{regexFilter},
+				MembershipFilters: []common.MembershipFilter{
+					{FieldName: "app", ValidValues: []string{"api", "web.1"}},
+				},
+				ExistenceFilters: []common.ExistenceFilter{{FieldName: "error", Exists: true}},
+			},
+			`{namespace="prod"}`,
+			`{namespace="prod", app=~"api|web\\.1"} | json | path=~"/api/.*" | error!=""`,
+		},
+		{
+			common.Query{RegexFilters: []common.RegexFilter{alternationFilter}},
+			`{namespace="prod"}`,
+			`{namespace="prod"} | json | path=~"(?i)(/api.*|.*users)"`,
+		},
+		{
+			common.Query{Filter: filter},
+			`{namespace="prod"}`,
+			`{namespace="prod"} | json | ((level!="error" and path!~"/health.*") and duration_ms>500)`,
+		},
+	}
+	for _, test := range tests {
+		output, err := queryToLogQL(test.query, test.selector, labels)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output != test.expected {
+			t.Errorf("Expected %s, got %s", test.expected, output)
+		}
+	}
+	if _, err := queryToLogQL(common.Query{QueryString: "timeout"}, "", labels); err == nil {
+		t.Error("Expected an error for a query without stream selector")
+	}
+}
+
+func TestSupportsFilter(t *testing.T) {
+	tests := map[string]bool{
+		"level=error OR level=fatal": true,
+		"NOT path~^/health":          true,
+		"NOT duration_ms>500":        false,
+		"duration_ms>=500":           true,
+		"version<v2":                 false,
+	}
+	for input, expected := range tests {
+		expr, err := common.ParseFilterExpression(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if supportsFilter(expr) != expected {
+			t.Errorf("%s: expected %v", input, expected)
+		}
+	}
+}
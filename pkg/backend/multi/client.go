@@ -0,0 +1,78 @@
+package multi
+
+import (
+	"context"
+	"sort"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+)
+
+// Client queries multiple environments concurrently, and merges their messages by timestamp
+type Client struct {
+	names   []string
+	clients []common.Client
+}
+
+func New(clients map[string]common.Client) *Client {
+	client := &Client{}
+	for name := range clients {
+		client.names = append(client.names, name)
+	}
+	sort.Strings(client.names)
+	for _, name := range client.names {
+		client.clients = append(client.clients, clients[name])
+	}
+	return client
+}
+
+// Every environment evaluates the filters its backend doesn't support itself
+func (client *Client) SupportsFilter(filter common.FilterExpression) bool {
+	return true
+}
+
+// Adds an @env attribute to all messages
+func tagMessages(ctx context.Context, env string, messages <-chan common.LogMessage) <-chan common.LogMessage {
+	resultChan := make(chan common.LogMessage)
+	go func() {
+		defer close(resultChan)
+		for message := range messages {
+			message.Attributes["@env"] = env
+			if !common.SendMessage(ctx, resultChan, message) {
+				return
+			}
+		}
+	}()
+	return resultChan
+}
+
+func (client *Client) Query(ctx context.Context, query common.Query) <-chan common.LogMessage {
+	queries := make(map[string]common.Query)
+	for _, name := range client.names {
+		queries[name] = query
+	}
+	return client.QueryEach(ctx, queries)
+}
+
+// QueryEach queries every environment with its own query, e.g. to filter on a field that is named
+// differently per environment. Environments without a query are skipped, all queries are expected
+// to have the same MaxResults and Follow.
+func (client *Client) QueryEach(ctx context.Context, queries map[string]common.Query) <-chan common.LogMessage {
+	sources := make([]<-chan common.LogMessage, 0, len(client.clients))
+	var follow bool
+	var maxResults int
+	for i, envClient := range client.clients {
+		query, ok := queries[client.names[i]]
+		if !ok {
+			continue
+		}
+		follow, maxResults = query.Follow, query.MaxResults
+		sources = append(sources, tagMessages(ctx, client.names[i], common.QueryWithFallback(ctx, envClient, query)))
+	}
+	if follow {
+		return common.MergeSources(ctx, sources, common.FollowReorderWindow)
+	}
+	// Every environment returns its query.MaxResults most recent messages, keep the most recent of all of those
+	return common.MostRecent(ctx, common.MergeSources(ctx, sources, 0), maxResults)
+}
+
+var _ common.Client = &Client{}
@@ -0,0 +1,130 @@
+package multi
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+)
+
+var baseTime = time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func messageAt(second int, text string) common.LogMessage {
+	message := common.NewLogMessage()
+	message.Timestamp = baseTime.Add(time.Duration(second) * time.Second)
+	message.Attributes["message"] = text
+	return message
+}
+
+// Sends its messages, then (in follow mode) whatever is sent to follow until it's closed
+type fakeClient struct {
+	messages []common.LogMessage
+	follow   chan common.LogMessage
+}
+
+func (client *fakeClient) SupportsFilter(filter common.FilterExpression) bool {
+	return true
+}
+
+func (client *fakeClient) Query(ctx context.Context, query common.Query) <-chan common.LogMessage {
+	resultChan := make(chan common.LogMessage)
+	go func() {
+		defer close(resultChan)
+		for _, message := range client.messages {
+			if common.MatchesQuery(message, query) && !common.SendMessage(ctx, resultChan, message) {
+				return
+			}
+		}
+		if query.Follow {
+			for message := range client.follow {
+				if !common.SendMessage(ctx, resultChan, message) {
+					return
+				}
+			}
+		}
+	}()
+	return resultChan
+}
+
+func messageTexts(messages []common.LogMessage) string {
+	texts := make([]string, 0, len(messages))
+	for _, message := range messages {
+		texts = append(texts, fmt.Sprintf("%s@%s", message.Attributes["message"], message.Attributes["@env"]))
+	}
+	return strings.Join(texts, " ")
+}
+
+func TestQuery(t *testing.T) {
+	client := New(map[string]common.Client{
+		"eu": &fakeClient{messages: []common.LogMessage{messageAt(1, "a"), messageAt(4, "d"), messageAt(5, "e")}},
+		"us": &fakeClient{messages: []common.LogMessage{messageAt(2, "b"), messageAt(3, "c"), messageAt(6, "f")}},
+		"ap": &fakeClient{},
+	})
+	messages := make([]common.LogMessage, 0)
+	for message := range client.Query(context.Background(), common.Query{MaxResults: 4}) {
+		messages = append(messages, message)
+	}
+	if output := messageTexts(messages); output != "c@us d@eu e@eu f@us" {
+		t.Errorf("Unexpected messages: %s", output)
+	}
+}
+
+func TestQueryFollow(t *testing.T) {
+	eu := &fakeClient{messages: []common.LogMessage{messageAt(1, "a")}, follow: make(chan common.LogMessage)}
+	us := &fakeClient{messages: []common.LogMessage{messageAt(2, "b")}, follow: make(chan common.LogMessage)}
+	client := New(map[string]common.Client{"eu": eu, "us": us})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	results := client.Query(ctx, common.Query{Follow: true, MaxResults: 10})
+	// Both environments have a message pending, so the oldest can be sent right away
+	if message := <-results; message.Attributes["message"] != "a" {
+		t.Errorf("Expected the oldest message first, got %+v", message)
+	}
+	eu.follow <- messageAt(4, "d")
+	us.follow <- messageAt(3, "c")
+	for _, expected := range []string{"b", "c"} {
+		if message := <-results; message.Attributes["message"] != expected {
+			t.Errorf("Expected %s, got %+v", expected, message)
+		}
+	}
+	// No message pending for us, so d is only sent after the reorder window
+	start := time.Now()
+	if message := <-results; message.Attributes["message"] != "d" {
+		t.Errorf("Expected d, got %+v", message)
+	}
+	if waited := time.Since(start); waited < common.FollowReorderWindow/2 {
+		t.Errorf("Expected d to be held back, but it was sent after %s", waited)
+	}
+	cancel()
+	for range results {
+	}
+}
+
+func TestQueryEach(t *testing.T) {
+	backendTraced := messageAt(2, "b")
+	backendTraced.Attributes["request_id"] = "abc"
+	gatewayTraced := messageAt(3, "c")
+	gatewayTraced.Attributes["x-request-id"] = "abc"
+	// Environments name the field differently, and local isn't queried at all
+	client := New(map[string]common.Client{
+		"gateway": &fakeClient{messages: []common.LogMessage{messageAt(1, "a"), gatewayTraced}},
+		"backend": &fakeClient{messages: []common.LogMessage{backendTraced, messageAt(4, "d")}},
+		"local":   &fakeClient{messages: []common.LogMessage{messageAt(5, "e")}},
+	})
+	filter := func(field string) common.Query {
+		return common.Query{MaxResults: 10, EqualityFilters: []common.EqualityFilter{{FieldName: field, Operator: "=", Value: "abc"}}}
+	}
+	messages := make([]common.LogMessage, 0)
+	for message := range client.QueryEach(context.Background(), map[string]common.Query{
+		"gateway": filter("x-request-id"),
+		"backend": filter("request_id"),
+	}) {
+		messages = append(messages, message)
+	}
+	if output := messageTexts(messages); output != "b@backend c@gateway" {
+		t.Errorf("Unexpected messages: %s", output)
+	}
+}
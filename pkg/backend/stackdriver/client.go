@@ -100,13 +100,90 @@ func entryToLogMessage(entry *logging.Entry) common.LogMessage {
 	return message
 }
 
+func equalityFilterToFilter(filter common.EqualityFilter) string {
+	if _, ok := common.ParseNumber(filter.Value); ok && common.IsOrderingOperator(filter.Operator) {
+		// Unquoted, so that Stackdriver compares numerically
+		return fmt.Sprintf(`jsonPayload.%s %s %s`, filter.FieldName, filter.Operator, filter.Value)
+	}
+	return fmt.Sprintf(`jsonPayload.%s %s "%s"`, filter.FieldName, filter.Operator, filter.Value)
+}
+
+func membershipToFilter(fieldName string, values []string) string {
+	alternatives := make([]string, 0, len(values))
+	for _, value := range values {
+		alternatives = append(alternatives, equalityFilterToFilter(common.EqualityFilter{
+			FieldName: fieldName,
+			Operator:  "=",
+			Value:     value,
+		}))
+	}
+	return fmt.Sprintf("(%s)", strings.Join(alternatives, " OR "))
+}
+
+var stringEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+func regexFilterToFilter(filter common.RegexFilter) string {
+	operator := "=~"
+	if filter.Negated {
+		operator = "!~"
+	}
+	return fmt.Sprintf(`jsonPayload.%s %s "%s"`, filter.FieldName, operator, stringEscaper.Replace(filter.Regexp.String()))
+}
+
+// The Stackdriver filter language supports AND, OR, NOT and grouping natively
+func filterExpressionToFilter(expr common.FilterExpression) string {
+	switch e := expr.(type) {
+	case common.AndExpression:
+		return fmt.Sprintf("(%s)", strings.Join(filterExpressionsToFilters(e.Operands), " AND "))
+	case common.OrExpression:
+		return fmt.Sprintf("(%s)", strings.Join(filterExpressionsToFilters(e.Operands), " OR "))
+	case common.NotExpression:
+		return fmt.Sprintf("NOT %s", filterExpressionToFilter(e.Operand))
+	case common.EqualityFilter:
+		return equalityFilterToFilter(e)
+	case common.RegexFilter:
+		return regexFilterToFilter(e)
+	default:
+		panic(fmt.Sprintf("Unsupported filter expression: %+v", expr))
+	}
+}
+
+func filterExpressionsToFilters(exprs []common.FilterExpression) []string {
+	filters := make([]string, 0, len(exprs))
+	for _, expr := range exprs {
+		filters = append(filters, filterExpressionToFilter(expr))
+	}
+	return filters
+}
+
 func queryToFilter(query common.Query, projectName string, logName string) string {
 	pieces := []string{fmt.Sprintf(`logName = "projects/%s/logs/%s"`, projectName, logName)}
 	if query.QueryString != "" {
 		pieces = append(pieces, fmt.Sprintf(`"%s"`, query.QueryString))
 	}
 	for _, filter := range query.EqualityFilters {
-		pieces = append(pieces, fmt.Sprintf(`jsonPayload.%s %s "%s"`, filter.FieldName, filter.Operator, filter.Value))
+		pieces = append(pieces, equalityFilterToFilter(filter))
+	}
+	for _, filter := range query.ExistenceFilters {
+		if filter.Exists {
+			pieces = append(pieces, fmt.Sprintf(`jsonPayload.%s:*`, filter.FieldName))
+		} else {
+			pieces = append(pieces, fmt.Sprintf(`NOT jsonPayload.%s:*`, filter.FieldName))
+		}
+	}
+	for _, filter := range query.MembershipFilters {
+		if len(filter.ValidValues) > 0 {
+			pieces = append(pieces, membershipToFilter(filter.FieldName, filter.ValidValues))
+		}
+		if len(filter.InvalidValues) > 0 {
+			pieces = append(pieces, fmt.Sprintf("NOT %s", membershipToFilter(filter.FieldName, filter.InvalidValues)))
+		}
+	}
+	for _, filter := range query.RegexFilters {
+		pieces = append(pieces, regexFilterToFilter(filter))
+	}
+	if query.Filter != nil {
+		pieces = append(pieces, filterExpressionToFilter(query.Filter))
 	}
 	if query.After != nil {
 		pieces = append(pieces, fmt.Sprintf(`timestamp > "%s"`, (*query.After).Format(time.RFC3339)))
@@ -117,51 +194,76 @@ func queryToFilter(query common.Query, projectName string, logName string) strin
 	return strings.Join(pieces, " AND ")
 }
 
-func (client *StackdriverClient) ImplementsAdvancedFilters() bool {
-	return false
+func (client *StackdriverClient) SupportsFilter(filter common.FilterExpression) bool {
+	return true
 }
 
-func (client *StackdriverClient) readLogBatch(ctx context.Context, query common.Query) ([]common.LogMessage, error) {
-	ctx, cancel := context.WithTimeout(ctx, QueryLogTimeout)
+// Maximum number of entries requested from Stackdriver per page
+const pageSize = 1000
+
+// Iterates over the entries matching the query (the iterator fetches them page by page),
+// calling emit for every message until query.MaxResults messages were emitted,
+// the entries run out, or emit returns false
+func (client *StackdriverClient) readLogEntries(ctx context.Context, query common.Query, emit func(common.LogMessage) bool) error {
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
+	// Somehow, if no results can be found, it.Next() just runs forever, hence canceling the context
+	// when no entry arrived for QueryLogTimeout
+	idleTimer := time.AfterFunc(QueryLogTimeout, cancel)
+	defer idleTimer.Stop()
 	it := client.stackdriverClient.Entries(ctx, logadmin.Filter(queryToFilter(query, client.projectName, client.logName)))
-	messages := make([]common.LogMessage, 0, 20)
-	entry, err := it.Next()
-	// Somehow, if no results can be found, it.Next() just runs forever, hence the adding a timeout to the context
-	if ctx.Err() == context.DeadlineExceeded {
-		return messages, ctx.Err()
-	}
-	if err != nil && err != iterator.Done {
-		return nil, err
+	if query.MaxResults < pageSize {
+		it.PageInfo().MaxSize = query.MaxResults
+	} else {
+		it.PageInfo().MaxSize = pageSize
 	}
-	resultCounter := 1
-	for err != iterator.Done && resultCounter <= query.MaxResults {
+	for emitted := 0; emitted < query.MaxResults; emitted++ {
+		entry, err := it.Next()
+		if !idleTimer.Stop() {
+			return context.DeadlineExceeded
+		}
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
 		msg := entryToLogMessage(entry)
 		msg.Attributes = common.Project(msg.Attributes, query.SelectFields)
-		messages = append(messages, msg)
-		entry, err = it.Next()
-		resultCounter++
+		if !emit(msg) {
+			return nil
+		}
+		idleTimer.Reset(QueryLogTimeout)
+	}
+	return nil
+}
+
+func (client *StackdriverClient) readLogBatch(ctx context.Context, query common.Query) ([]common.LogMessage, error) {
+	messages := make([]common.LogMessage, 0, 20)
+	err := client.readLogEntries(ctx, query, func(message common.LogMessage) bool {
+		messages = append(messages, message)
+		return true
+	})
+	if err != nil {
+		return nil, err
 	}
 	return messages, nil
 }
 
 func (client *StackdriverClient) Query(ctx context.Context, query common.Query) <-chan common.LogMessage {
 	if query.Follow {
-		return common.ReQueryFollow(ctx, func() ([]common.LogMessage, error) {
-			return client.readLogBatch(ctx, query)
+		return common.FollowQuery(ctx, query, func(pollQuery common.Query) ([]common.LogMessage, error) {
+			return client.readLogBatch(ctx, pollQuery)
 		})
 	}
 	resultChan := make(chan common.LogMessage)
 
 	go func() {
-		messages, err := client.readLogBatch(ctx, query)
-		if err != nil {
+		err := client.readLogEntries(ctx, query, func(message common.LogMessage) bool {
+			return common.SendMessage(ctx, resultChan, message)
+		})
+		if err != nil && ctx.Err() == nil {
 			fmt.Printf("Error while fetching logs: %s\n", err)
-			close(resultChan)
-			return
-		}
-		for _, message := range messages {
-			resultChan <- message
 		}
 		close(resultChan)
 	}()
@@ -50,4 +50,51 @@ func TestQueryToFilter(t *testing.T) {
 		}}, "my-project", "my-log") != `logName = "projects/my-project/logs/my-log" AND jsonPayload.name = "pete"` {
 		t.Error("Where filter fail")
 	}
+	if queryToFilter(common.Query{
+		EqualityFilters: []common.EqualityFilter{
+			{
+				FieldName: "duration_ms",
+				Operator:  ">",
+				Value:     "500",
+			},
+		}}, "my-project", "my-log") != `logName = "projects/my-project/logs/my-log" AND jsonPayload.duration_ms > 500` {
+		t.Error("Numeric where filter fail")
+	}
+}
+
+func TestFilterExpressionToFilter(t *testing.T) {
+	expr, err := common.ParseFilterExpression("(level=error OR level=fatal) AND NOT service=healthcheck")
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := queryToFilter(common.Query{Filter: expr}, "my-project", "my-log")
+	if output != `logName = "projects/my-project/logs/my-log" AND ((jsonPayload.level = "error" OR jsonPayload.level = "fatal") AND NOT jsonPayload.service = "healthcheck")` {
+		t.Error("Filter expression fail", output)
+	}
+}
+
+func TestRegexFilterToFilter(t *testing.T) {
+	filter, err := common.NewRegexFilter("path", `^/api/v\d+/`, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := queryToFilter(common.Query{RegexFilters: []common.RegexFilter{filter}}, "my-project", "my-log")
+	if output != `logName = "projects/my-project/logs/my-log" AND jsonPayload.path !~ "^/api/v\\d+/"` {
+		t.Error("Regex filter fail", output)
+	}
+}
+
+func TestAdvancedFiltersToFilter(t *testing.T) {
+	output := queryToFilter(common.Query{
+		ExistenceFilters: []common.ExistenceFilter{
+			{FieldName: "domain", Exists: true},
+			{FieldName: "traceback", Exists: false},
+		},
+		MembershipFilters: []common.MembershipFilter{
+			{FieldName: "level", ValidValues: []string{"error", "fatal"}, InvalidValues: []string{"warn"}},
+		},
+	}, "my-project", "my-log")
+	if output != `logName = "projects/my-project/logs/my-log" AND jsonPayload.domain:* AND NOT jsonPayload.traceback:* AND (jsonPayload.level = "error" OR jsonPayload.level = "fatal") AND NOT (jsonPayload.level = "warn")` {
+		t.Error("Advanced filters fail", output)
+	}
 }
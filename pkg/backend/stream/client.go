@@ -16,11 +16,18 @@ import (
 )
 
 type Client struct {
-	reader io.Reader
+	reader          io.Reader
+	timestampPrefix bool
 }
 
 func New(file io.Reader) *Client {
-	return &Client{file}
+	return &Client{reader: file}
+}
+
+// NewTimestamped reads lines prefixed with an RFC3339Nano timestamp, like the output of docker logs and
+// kubectl logs with --timestamps, using those timestamps rather than finding one in the lines themselves
+func NewTimestamped(file io.Reader) *Client {
+	return &Client{reader: file, timestampPrefix: true}
 }
 
 func parseLine(line string) common.LogMessage {
@@ -40,7 +47,55 @@ func parseLine(line string) common.LogMessage {
 	}
 }
 
-func (client *Client) ImplementsAdvancedFilters() bool {
+// Splits "2018-10-01T12:00:00.123456789Z message" into its timestamp and the rest of the line
+func splitTimestampPrefix(line string) (time.Time, string, bool) {
+	i := strings.IndexByte(line, ' ')
+	if i < 0 {
+		return time.Time{}, line, false
+	}
+	ts, err := time.Parse(time.RFC3339Nano, line[:i])
+	if err != nil {
+		return time.Time{}, line, false
+	}
+	return ts, line[i+1:], true
+}
+
+// LineParser parses log lines into messages, finding the timestamp in them
+// based on the format detected in earlier lines
+type LineParser struct {
+	ltFunc heuristic.LogTimestampParser
+	// Lines start with an RFC3339Nano timestamp, which is used when present
+	TimestampPrefix bool
+}
+
+// Parse parses a line, and returns whether a timestamp was found in it (if not, the message's timestamp is time.Now())
+func (parser *LineParser) Parse(line string) (common.LogMessage, bool) {
+	if parser.TimestampPrefix {
+		if ts, rest, ok := splitTimestampPrefix(line); ok {
+			message := parseLine(rest)
+			message.Timestamp = ts
+			return message, true
+		}
+	}
+	message := parseLine(line)
+	if parser.ltFunc != nil {
+		if ts := parser.ltFunc(message); ts != nil {
+			message.Timestamp = *ts
+			return message, true
+		}
+	}
+	// No timestamp in the expected format, maybe the format changed
+	parser.ltFunc = heuristic.FindTimestampFunc(message)
+	if parser.ltFunc != nil {
+		if ts := parser.ltFunc(message); ts != nil {
+			message.Timestamp = *ts
+			return message, true
+		}
+	}
+	return message, false
+}
+
+func (client *Client) SupportsFilter(filter common.FilterExpression) bool {
 	return true
 }
 
@@ -48,7 +103,7 @@ func (client *Client) Query(ctx context.Context, q common.Query) <-chan common.L
 	resultChan := make(chan common.LogMessage)
 	reader := bufio.NewReader(client.reader)
 	go func() {
-		var ltFunc heuristic.LogTimestampParser
+		parser := LineParser{TimestampPrefix: client.timestampPrefix}
 	LFor:
 		for {
 			select {
@@ -66,25 +121,12 @@ func (client *Client) Query(ctx context.Context, q common.Query) <-chan common.L
 				//fmt.Println("Error: ", err)
 				break
 			}
-			message := parseLine(line)
-			if ltFunc == nil {
-				ltFunc = heuristic.FindTimestampFunc(message)
-			}
-			if ltFunc != nil {
-				ts := ltFunc(message)
-				if ts != nil {
-					message.Timestamp = *ts
-				} else {
-					ltFunc = heuristic.FindTimestampFunc(message)
-					if ltFunc != nil {
-						ts := ltFunc(message)
-						message.Timestamp = *ts
-					}
-				}
-			}
+			message, _ := parser.Parse(line)
 			if common.MatchesQuery(message, q) {
 				message.Attributes = common.Project(message.Attributes, q.SelectFields)
-				resultChan <- message
+				if !common.SendMessage(ctx, resultChan, message) {
+					break LFor
+				}
 			}
 		}
 		close(resultChan)
@@ -47,3 +47,26 @@ func TestFindTimestampInMessage(t *testing.T) {
 	}
 
 }
+
+func TestTimestampPrefix(t *testing.T) {
+	sampleData := `2017-08-04T11:16:52.088123456Z {"ts": "2016-01-01T00:00:00Z", "message": "Sup yo"}
+2017-08-04T11:16:53Z No timestamp of its own
+`
+	expected := []time.Time{
+		time.Date(2017, 8, 4, 11, 16, 52, 88123456, time.UTC),
+		time.Date(2017, 8, 4, 11, 16, 53, 0, time.UTC),
+	}
+	counter := 0
+	for msg := range NewTimestamped(strings.NewReader(sampleData)).Query(context.Background(), common.Query{}) {
+		if !msg.Timestamp.Equal(expected[counter]) {
+			t.Errorf("Expected timestamp %s, got %s", expected[counter], msg.Timestamp)
+		}
+		if counter == 1 && msg.Attributes["message"] != "No timestamp of its own" {
+			t.Errorf("Expected the timestamp to be stripped, got %q", msg.Attributes["message"])
+		}
+		counter++
+	}
+	if counter != 2 {
+		t.Errorf("Expected 2 messages, got %d", counter)
+	}
+}
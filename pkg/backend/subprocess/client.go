@@ -3,21 +3,31 @@ package subprocess
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
 	"os/exec"
+	"time"
 
 	"github.com/egnyte/ax/pkg/backend/common"
 	"github.com/egnyte/ax/pkg/backend/stream"
 )
 
 type SubprocessClient struct {
-	command []string
+	command         []string
+	timestampPrefix bool
 }
 
-func (client *SubprocessClient) ImplementsAdvancedFilters() bool {
+func (client *SubprocessClient) SupportsFilter(filter common.FilterExpression) bool {
 	return true
 }
 
+func (client *SubprocessClient) newStream(reader io.Reader) *stream.Client {
+	if client.timestampPrefix {
+		return stream.NewTimestamped(reader)
+	}
+	return stream.New(reader)
+}
+
 func (client *SubprocessClient) Query(ctx context.Context, query common.Query) <-chan common.LogMessage {
 	resultChan := make(chan common.LogMessage)
 	cmd := exec.Command(client.command[0], client.command[1:]...)
@@ -27,47 +37,41 @@ func (client *SubprocessClient) Query(ctx context.Context, query common.Query) <
 		close(resultChan)
 		return resultChan
 	}
-	stdOutStream := stream.New(stdOut)
+	stdOutStream := client.newStream(stdOut)
 	stdErr, err := cmd.StderrPipe()
 	if err != nil {
 		log.Printf("Could not get stderr pipe: %v", err)
 		close(resultChan)
 		return resultChan
 	}
-	stdErrStream := stream.New(stdErr)
+	stdErrStream := client.newStream(stdErr)
 	if err := cmd.Start(); err != nil {
 		fmt.Printf("Could not start process: %s because: %v\n", client.command[0], err)
 		close(resultChan)
 		return resultChan
 	}
 	go func() {
-		stdOutQuery := stdOutStream.Query(ctx, query)
-		stdErrQuery := stdErrStream.Query(ctx, query)
-		stdOutOpen := true
-		stdErrOpen := true
-		for stdOutOpen || stdErrOpen {
-			select {
-			case message, ok := <-stdOutQuery:
-				if !ok {
-					stdOutOpen = false
-					continue
-				}
-				resultChan <- message
-			case message, ok := <-stdErrQuery:
-				if !ok {
-					stdErrOpen = false
-					continue
-				}
-				resultChan <- message
-			case <-ctx.Done():
-				close(resultChan)
-				cmd.Process.Kill() // Ignoring error, not sure if that's ok
-				// Returning to avoid the Wait()
-				return
+		// Messages are read from stdout and stderr as they arrive, so merge them by timestamp
+		// to send them in order, like MergeByTimestamp's callers expect from every source
+		window := time.Duration(0)
+		if query.Follow {
+			window = common.FollowReorderWindow
+		}
+		merged := common.MergeSources(ctx, []<-chan common.LogMessage{
+			stdOutStream.Query(ctx, query),
+			stdErrStream.Query(ctx, query),
+		}, window)
+		for message := range merged {
+			if !common.SendMessage(ctx, resultChan, message) {
+				break
 			}
-
 		}
 		close(resultChan)
+		if ctx.Err() != nil {
+			cmd.Process.Kill() // Ignoring error, not sure if that's ok
+			// Returning to avoid the Wait()
+			return
+		}
 		if err := cmd.Wait(); err != nil {
 			fmt.Printf("Process exited with error: %v\n", err)
 		}
@@ -76,7 +80,13 @@ func (client *SubprocessClient) Query(ctx context.Context, query common.Query) <
 }
 
 func New(command []string) *SubprocessClient {
-	return &SubprocessClient{command}
+	return &SubprocessClient{command: command}
+}
+
+// NewTimestamped runs a command that prefixes every line with an RFC3339Nano timestamp,
+// like docker logs and kubectl logs with --timestamps, see stream.NewTimestamped
+func NewTimestamped(command []string) *SubprocessClient {
+	return &SubprocessClient{command: command, timestampPrefix: true}
 }
 
 var _ common.Client = &SubprocessClient{}
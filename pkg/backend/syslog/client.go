@@ -0,0 +1,187 @@
+package syslog
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+)
+
+// Maximum size of a message, UDP datagrams can't be larger anyway
+const maxMessageSize = 64 * 1024
+
+// SyslogClient receives syslog messages on a local address, over both UDP and TCP
+type SyslogClient struct {
+	address string // e.g. :5514 or 127.0.0.1:514
+}
+
+func New(address string) *SyslogClient {
+	if !strings.Contains(address, ":") {
+		// Just a port
+		address = ":" + address
+	}
+	return &SyslogClient{address}
+}
+
+// Any filter can be applied, as messages are filtered by Ax itself
+func (client *SyslogClient) SupportsFilter(filter common.FilterExpression) bool {
+	return true
+}
+
+func parseAndSend(ctx context.Context, line string, messages chan<- common.LogMessage) bool {
+	if strings.TrimSpace(line) == "" {
+		return true
+	}
+	message, err := parseMessage(line, time.Now())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return true
+	}
+	return common.SendMessage(ctx, messages, message)
+}
+
+// Every UDP datagram contains a single message
+func receiveUDP(ctx context.Context, conn net.PacketConn, messages chan<- common.LogMessage) {
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() == nil {
+				fmt.Fprintf(os.Stderr, "Could not receive syslog message: %v\n", err)
+			}
+			return
+		}
+		if !parseAndSend(ctx, string(buf[:n]), messages) {
+			return
+		}
+	}
+}
+
+// Reads a message from a TCP connection, which are either framed by octet counting ("<length> <message>")
+// or terminated by a newline (RFC 6587)
+func readFramedMessage(reader *bufio.Reader) (string, error) {
+	first, err := reader.Peek(1)
+	if err != nil {
+		return "", err
+	}
+	if first[0] < '0' || first[0] > '9' {
+		return reader.ReadString('\n')
+	}
+	lengthString, err := reader.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+	length, err := strconv.Atoi(strings.TrimSpace(lengthString))
+	if err != nil || length > maxMessageSize {
+		return "", fmt.Errorf("Invalid syslog message length: %q", lengthString)
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+func receiveTCPConnection(ctx context.Context, conn net.Conn, messages chan<- common.LogMessage) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := readFramedMessage(reader)
+		if !parseAndSend(ctx, line, messages) {
+			return
+		}
+		if err != nil {
+			if err != io.EOF && ctx.Err() == nil {
+				fmt.Fprintf(os.Stderr, "Could not receive syslog message from %s: %v\n", conn.RemoteAddr(), err)
+			}
+			return
+		}
+	}
+}
+
+func receiveTCP(ctx context.Context, listener net.Listener, messages chan<- common.LogMessage) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				fmt.Fprintf(os.Stderr, "Could not accept syslog connection: %v\n", err)
+			}
+			return
+		}
+		go func() {
+			<-ctx.Done()
+			conn.Close()
+		}()
+		go receiveTCPConnection(ctx, conn, messages)
+	}
+}
+
+func (client *SyslogClient) listen() (net.PacketConn, net.Listener, error) {
+	udpConn, err := net.ListenPacket("udp", client.address)
+	if err != nil {
+		return nil, nil, err
+	}
+	listener, err := net.Listen("tcp", client.address)
+	if err != nil {
+		udpConn.Close()
+		return nil, nil, err
+	}
+	return udpConn, listener, nil
+}
+
+// Receives messages until ctx is canceled, or (when not following) query.MaxResults messages matched
+func receive(ctx context.Context, udpConn net.PacketConn, listener net.Listener, query common.Query, resultChan chan<- common.LogMessage) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		udpConn.Close()
+		listener.Close()
+	}()
+	messages := make(chan common.LogMessage)
+	go receiveUDP(ctx, udpConn, messages)
+	go receiveTCP(ctx, listener, messages)
+	matched := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case message := <-messages:
+			if !common.MatchesQuery(message, query) {
+				continue
+			}
+			message.Attributes = common.Project(message.Attributes, query.SelectFields)
+			if !common.SendMessage(ctx, resultChan, message) {
+				return
+			}
+			matched++
+			if !query.Follow && matched >= query.MaxResults {
+				return
+			}
+		}
+	}
+}
+
+func (client *SyslogClient) Query(ctx context.Context, query common.Query) <-chan common.LogMessage {
+	resultChan := make(chan common.LogMessage)
+	go func() {
+		defer close(resultChan)
+		udpConn, listener, err := client.listen()
+		if err != nil {
+			fmt.Printf("Could not listen for syslog messages: %v\n", err)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Listening for syslog messages on %s (UDP and TCP)\n", client.address)
+		receive(ctx, udpConn, listener, query, resultChan)
+	}()
+	return resultChan
+}
+
+var _ common.Client = &SyslogClient{}
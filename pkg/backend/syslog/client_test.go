@@ -0,0 +1,57 @@
+package syslog
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+)
+
+func TestReceive(t *testing.T) {
+	// Listening on separate (random) ports for UDP and TCP, to not collide with anything else
+	udpConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resultChan := make(chan common.LogMessage)
+	query := common.Query{
+		EqualityFilters: []common.EqualityFilter{{FieldName: "severity", Operator: "=", Value: "err"}},
+		MaxResults:      3,
+	}
+	go func() {
+		defer close(resultChan)
+		receive(context.Background(), udpConn, listener, query, resultChan)
+	}()
+
+	udpClient, err := net.Dial("udp", udpConn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udpClient.Close()
+	fmt.Fprint(udpClient, "<11>1 - host udp - - - over UDP")
+	tcpClient, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpClient.Close()
+	// Newline terminated, then octet counted (and containing a newline), with an info message in between
+	octetCounted := "<11>1 - host tcp - - - counted\nover TCP"
+	fmt.Fprintf(tcpClient, "<14>Oct 11 22:14:15 host tcp: not an error\n<11>Oct 11 22:14:15 host tcp: newline over TCP\n%d %s", len(octetCounted), octetCounted)
+
+	messages := make([]string, 0)
+	for message := range resultChan {
+		messages = append(messages, message.Attributes["message"].(string))
+	}
+	sort.Strings(messages)
+	if strings.Join(messages, ", ") != "counted\nover TCP, newline over TCP, over UDP" {
+		t.Errorf("Unexpected messages: %q", messages)
+	}
+}
@@ -0,0 +1,182 @@
+package syslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+)
+
+var facilityNames = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+var severityNames = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// RFC 3164 tag, e.g. "sshd[1234]: "
+var tagRegex = regexp.MustCompile(`^([^\s\[\]:]+)(?:\[([^\]]*)\])?:\s?`)
+
+const rfc3164TimestampLayout = "Jan _2 15:04:05"
+
+// Parses "<PRI>", returns the remainder
+func parsePriority(line string, message common.LogMessage) (string, error) {
+	end := strings.IndexByte(line, '>')
+	if !strings.HasPrefix(line, "<") || end < 2 || end > 4 {
+		return "", fmt.Errorf("Missing priority in syslog message: %q", line)
+	}
+	priority, err := strconv.Atoi(line[1:end])
+	if err != nil || priority >= len(facilityNames)*8 {
+		return "", fmt.Errorf("Invalid priority in syslog message: %q", line)
+	}
+	message.Attributes["facility"] = facilityNames[priority/8]
+	message.Attributes["severity"] = severityNames[priority%8]
+	return line[end+1:], nil
+}
+
+// Parses a syslog message in either RFC 5424 or (the older, BSD) RFC 3164 format,
+// now is used for messages without timestamp, and to determine the year for RFC 3164 timestamps
+func parseMessage(line string, now time.Time) (common.LogMessage, error) {
+	message := common.NewLogMessage()
+	message.Timestamp = now
+	rest, err := parsePriority(strings.TrimRight(line, "\r\n\x00"), message)
+	if err != nil {
+		return message, err
+	}
+	if strings.HasPrefix(rest, "1 ") {
+		err = parseRFC5424(rest[2:], now, &message)
+	} else {
+		parseRFC3164(rest, now, &message)
+	}
+	if err != nil {
+		return message, err
+	}
+	// Messages containing JSON are parsed, like in other backends
+	text, _ := message.Attributes["message"].(string)
+	var structured map[string]interface{}
+	if strings.HasPrefix(strings.TrimSpace(text), "{") && json.Unmarshal([]byte(text), &structured) == nil {
+		for key, value := range structured {
+			message.Attributes[key] = value
+		}
+	}
+	return common.FlattenLogMessage(message), nil
+}
+
+// Sets an attribute unless it's the nil value ("-")
+func setHeaderField(message *common.LogMessage, name, value string) {
+	if value != "-" {
+		message.Attributes[name] = value
+	}
+}
+
+// TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG] (after "<PRI>1 ")
+func parseRFC5424(rest string, now time.Time, message *common.LogMessage) error {
+	fields := strings.SplitN(rest, " ", 6)
+	if len(fields) < 6 {
+		return fmt.Errorf("Invalid RFC 5424 syslog message: %q", rest)
+	}
+	if fields[0] != "-" {
+		ts, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return fmt.Errorf("Invalid timestamp in syslog message: %q", fields[0])
+		}
+		message.Timestamp = ts
+	}
+	setHeaderField(message, "hostname", fields[1])
+	setHeaderField(message, "app_name", fields[2])
+	setHeaderField(message, "proc_id", fields[3])
+	setHeaderField(message, "msg_id", fields[4])
+	rest, err := parseStructuredData(fields[5], message.Attributes)
+	if err != nil {
+		return err
+	}
+	if rest != "" {
+		message.Attributes["message"] = strings.TrimPrefix(strings.TrimPrefix(rest, " "), "\xEF\xBB\xBF")
+	}
+	return nil
+}
+
+// Parses STRUCTURED-DATA, e.g. [exampleSDID@32473 iut="3" eventSource="Application"], into attributes
+// (one object per element, so they end up as e.g. exampleSDID@32473.iut). Returns what comes after it.
+func parseStructuredData(s string, attributes map[string]interface{}) (string, error) {
+	if strings.HasPrefix(s, "-") {
+		return s[1:], nil
+	}
+	invalid := fmt.Errorf("Invalid structured data in syslog message: %q", s)
+	for strings.HasPrefix(s, "[") {
+		end := strings.IndexAny(s, " ]")
+		if end < 0 {
+			return "", invalid
+		}
+		id := s[1:end]
+		params := make(map[string]interface{})
+		s = s[end:]
+		for strings.HasPrefix(s, " ") {
+			equals := strings.Index(s, `="`)
+			if equals < 0 {
+				return "", invalid
+			}
+			name := s[1:equals]
+			s = s[equals+2:]
+			// Parameter values escape '"', '\' and ']' with a backslash
+			var value strings.Builder
+			closed := false
+			for i := 0; i < len(s); i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(`"\]`, s[i+1]) >= 0 {
+					i++
+				} else if s[i] == '"' {
+					s = s[i+1:]
+					closed = true
+					break
+				}
+				value.WriteByte(s[i])
+			}
+			if !closed {
+				return "", invalid
+			}
+			params[name] = value.String()
+		}
+		if !strings.HasPrefix(s, "]") {
+			return "", invalid
+		}
+		s = s[1:]
+		attributes[id] = params
+	}
+	return s, nil
+}
+
+// Mmm dd hh:mm:ss [HOSTNAME] TAG[PID]: MSG (after "<PRI>"), anything not matching this is kept as the message
+func parseRFC3164(rest string, now time.Time, message *common.LogMessage) {
+	if len(rest) > len(rfc3164TimestampLayout) {
+		ts, err := time.ParseInLocation(rfc3164TimestampLayout, rest[:len(rfc3164TimestampLayout)], now.Location())
+		if err == nil {
+			// No year in the timestamp, so assume the most recent one (allowing for some clock skew)
+			ts = ts.AddDate(now.Year(), 0, 0)
+			if ts.After(now.Add(24 * time.Hour)) {
+				ts = ts.AddDate(-1, 0, 0)
+			}
+			message.Timestamp = ts
+			rest = strings.TrimPrefix(rest[len(rfc3164TimestampLayout):], " ")
+			// Local daemons usually leave out the hostname
+			if !tagRegex.MatchString(rest) {
+				if space := strings.IndexByte(rest, ' '); space > 0 {
+					message.Attributes["hostname"] = rest[:space]
+					rest = rest[space+1:]
+				}
+			}
+		}
+	}
+	if match := tagRegex.FindStringSubmatch(rest); match != nil {
+		message.Attributes["app_name"] = match[1]
+		if match[2] != "" {
+			message.Attributes["proc_id"] = match[2]
+		}
+		rest = rest[len(match[0]):]
+	}
+	message.Attributes["message"] = rest
+}
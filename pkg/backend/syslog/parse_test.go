@@ -0,0 +1,98 @@
+package syslog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+)
+
+func TestParseMessage(t *testing.T) {
+	now := time.Date(2018, 1, 2, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		line       string
+		timestamp  time.Time
+		attributes map[string]interface{}
+	}{
+		{
+			`<165>1 2018-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="App\"lication\]"][origin ip="192.0.2.1"] ` + "\xEF\xBB\xBFAn application event",
+			time.Date(2018, 10, 11, 22, 14, 15, 3000000, time.UTC),
+			map[string]interface{}{
+				"facility":                      "local4",
+				"severity":                      "notice",
+				"hostname":                      "mymachine.example.com",
+				"app_name":                      "evntslog",
+				"msg_id":                        "ID47",
+				"exampleSDID@32473.iut":         "3",
+				"exampleSDID@32473.eventSource": `App"lication]`,
+				"origin.ip":                     "192.0.2.1",
+				"message":                       "An application event",
+			},
+		},
+		{
+			`<11>1 - - api 1234 - - {"message": "Request failed", "status": 500}`,
+			now,
+			map[string]interface{}{
+				"facility": "user",
+				"severity": "err",
+				"app_name": "api",
+				"proc_id":  "1234",
+				"message":  "Request failed",
+				"status":   float64(500),
+			},
+		},
+		{
+			`<34>Oct 11 22:14:15 mymachine su: 'su root' failed for lonvick on /dev/pts/8`,
+			// In the future, so last year
+			time.Date(2017, 10, 11, 22, 14, 15, 0, time.UTC),
+			map[string]interface{}{
+				"facility": "auth",
+				"severity": "crit",
+				"hostname": "mymachine",
+				"app_name": "su",
+				"message":  "'su root' failed for lonvick on /dev/pts/8",
+			},
+		},
+		{
+			`<30>Jan  2 11:59:00 sshd[42]: Accepted publickey for zef`,
+			time.Date(2018, 1, 2, 11, 59, 0, 0, time.UTC),
+			map[string]interface{}{
+				"facility": "daemon",
+				"severity": "info",
+				"app_name": "sshd",
+				"proc_id":  "42",
+				"message":  "Accepted publickey for zef",
+			},
+		},
+		{
+			`<13>Not really syslog`,
+			now,
+			map[string]interface{}{
+				"facility": "user",
+				"severity": "notice",
+				"message":  "Not really syslog",
+			},
+		},
+	}
+	for _, test := range tests {
+		message, err := parseMessage(test.line, now)
+		if err != nil {
+			t.Errorf("%s: %v", test.line, err)
+			continue
+		}
+		if !message.Timestamp.Equal(test.timestamp) {
+			t.Errorf("%s: expected timestamp %s, got %s", test.line, test.timestamp, message.Timestamp)
+		}
+		if common.MustJsonEncode(message.Attributes) != common.MustJsonEncode(test.attributes) {
+			t.Errorf("%s: unexpected attributes %s", test.line, common.MustJsonEncode(message.Attributes))
+		}
+	}
+}
+
+func TestParseInvalidMessage(t *testing.T) {
+	for _, line := range []string{"no priority", "<200>1 - - - - - -", `<13>1 - - - - - [id param="unterminated]`} {
+		if _, err := parseMessage(line, time.Now()); err == nil {
+			t.Errorf("Expected an error for %q", line)
+		}
+	}
+}
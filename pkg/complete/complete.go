@@ -2,6 +2,7 @@ package complete
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	"log"
@@ -13,10 +14,15 @@ import (
 
 const cacheFilename = "attribute-cache.json"
 
-func GatherCompletionInfo(rc config.RuntimeConfig, messages <-chan common.LogMessage) <-chan common.LogMessage {
+// GatherCompletionInfo passes on messages, while recording their attribute names and the values of
+// low-cardinality attributes for auto completion, as well as statistics on their fields for ax fields
+// (which need to know the fields the query selected). The cache is flushed before the result channel is closed.
+func GatherCompletionInfo(rc config.RuntimeConfig, query common.Query, messages <-chan common.LogMessage) <-chan common.LogMessage {
 	cache := cache.New(fmt.Sprintf("%s/%s", rc.DataDir, cacheFilename))
 	completionsKey := fmt.Sprintf("completions:%s", rc.ActiveEnv)
 	attrNames := make(map[string]bool)
+	values := newValueTracker(cache, rc.ActiveEnv)
+	fields := newFieldTracker(cache, rc.ActiveEnv, query.SelectFields)
 
 	// This will be read back as a map[string]interface{} not a bool
 	if existingAttributes, ok := cache.Get(completionsKey).(map[string]interface{}); ok {
@@ -25,21 +31,31 @@ func GatherCompletionInfo(rc config.RuntimeConfig, messages <-chan common.LogMes
 			attrNames[existingAttr] = true
 		}
 	}
+	var mutex sync.Mutex
 	changed := true
 	stopFlushing := make(chan struct{})
+	flushed := make(chan struct{})
 	resultChan := make(chan common.LogMessage)
 	go func() {
 		for message := range messages {
 			resultChan <- message
-			for k := range message.Attributes {
+			mutex.Lock()
+			fields.add(message)
+			changed = true
+			for k, v := range message.Attributes {
 				if !attrNames[k] {
 					attrNames[k] = true
 					changed = true
 				}
+				if values.add(k, v) {
+					changed = true
+				}
 			}
+			mutex.Unlock()
 		}
+		close(stopFlushing)
+		<-flushed
 		close(resultChan)
-		stopFlushing <- struct{}{}
 	}()
 	go func() {
 		// Flushes cache to disk every 5 seconds until completed
@@ -50,20 +66,25 @@ func GatherCompletionInfo(rc config.RuntimeConfig, messages <-chan common.LogMes
 				shouldBreak = true
 			case <-time.After(5 * time.Second):
 			}
+			mutex.Lock()
 			if changed {
 				log.Println("Flushing cache")
 				cache.Set(completionsKey, attrNames, nil)
+				values.save(cache, rc.ActiveEnv)
+				fields.save(cache, rc.ActiveEnv)
 				err := cache.Flush()
 				if err != nil {
 					log.Println("Could not flush cache:", err)
 				}
 				changed = false
 			}
+			mutex.Unlock()
 			if shouldBreak {
 				break
 			}
 		}
 		log.Println("Stopped flush loop")
+		close(flushed)
 	}()
 	return resultChan
 }
@@ -79,3 +100,13 @@ func GetCompletions(rc config.RuntimeConfig) map[string]bool {
 	}
 	return result
 }
+
+// GetValueCompletions returns the values seen per field in the active environment, most frequent first
+func GetValueCompletions(rc config.RuntimeConfig) map[string][]string {
+	c := cache.New(fmt.Sprintf("%s/%s", rc.DataDir, cacheFilename))
+	result := make(map[string][]string)
+	for field, counts := range cachedValueCounts(c, rc.ActiveEnv) {
+		result[field] = rankValues(counts)
+	}
+	return result
+}
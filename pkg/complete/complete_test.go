@@ -0,0 +1,154 @@
+package complete
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+	"github.com/egnyte/ax/pkg/config"
+)
+
+func gather(rc config.RuntimeConfig, attributes ...map[string]interface{}) {
+	gatherSelected(rc, nil, attributes...)
+}
+
+func gatherSelected(rc config.RuntimeConfig, selectFields []string, attributes ...map[string]interface{}) {
+	messages := make(chan common.LogMessage, len(attributes))
+	for _, a := range attributes {
+		messages <- common.LogMessage{Attributes: a}
+	}
+	close(messages)
+	for range GatherCompletionInfo(rc, common.Query{SelectFields: selectFields}, messages) {
+	}
+}
+
+func TestGatherCompletionInfo(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "ax-complete")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	rc := config.RuntimeConfig{ActiveEnv: "prod", DataDir: dataDir}
+
+	messages := make([]map[string]interface{}, 0, 60)
+	for i := 0; i < 60; i++ {
+		level := "info"
+		if i%3 == 0 {
+			level = "error"
+		}
+		messages = append(messages, map[string]interface{}{
+			"level":      level,
+			"status":     200.0,
+			"request_id": fmt.Sprintf("req-%d", i),
+			"nested":     map[string]interface{}{"a": 1},
+		})
+	}
+	gather(rc, messages...)
+	gather(rc, map[string]interface{}{"level": "warn"}, map[string]interface{}{"level": "warn"})
+
+	if names := GetCompletions(rc); !names["level"] || !names["request_id"] || !names["nested"] {
+		t.Errorf("Expected all attribute names, got %v", names)
+	}
+	values := GetValueCompletions(rc)
+	if !reflect.DeepEqual(values["level"], []string{"info", "error", "warn"}) {
+		t.Errorf("Expected level values ranked by count, got %v", values["level"])
+	}
+	if !reflect.DeepEqual(values["status"], []string{"200"}) {
+		t.Errorf("Unexpected status values: %v", values["status"])
+	}
+	if _, ok := values["request_id"]; ok {
+		t.Errorf("Expected request_id to be detected as high-cardinality, got %v", values["request_id"])
+	}
+	if _, ok := values["nested"]; ok {
+		t.Errorf("Expected objects not to be completed, got %v", values["nested"])
+	}
+	// High-cardinality fields stay out, also when they look fine in a later query
+	gather(rc, map[string]interface{}{"request_id": "req-1"})
+	if _, ok := GetValueCompletions(rc)["request_id"]; ok {
+		t.Error("Expected request_id to stay out of the cache")
+	}
+	if values := GetValueCompletions(config.RuntimeConfig{ActiveEnv: "dev", DataDir: dataDir}); len(values) != 0 {
+		t.Errorf("Expected values per environment, got %v", values)
+	}
+}
+
+func TestValuesPerFieldBounded(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "ax-complete")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	rc := config.RuntimeConfig{ActiveEnv: "prod", DataDir: dataDir}
+	// Enough repetition not to be high-cardinality, but more values than are kept
+	messages := make([]map[string]interface{}, 0)
+	for i := 0; i < MaxValuesPerField+10; i++ {
+		for j := 0; j <= i; j++ {
+			messages = append(messages, map[string]interface{}{"service": fmt.Sprintf("service%03d", i)})
+		}
+	}
+	gather(rc, messages...)
+	values := GetValueCompletions(rc)["service"]
+	if len(values) != MaxValuesPerField || values[0] != fmt.Sprintf("service%03d", MaxValuesPerField+9) {
+		t.Errorf("Expected the %d most frequent values, got %v", MaxValuesPerField, values)
+	}
+}
+
+func TestFieldStats(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "ax-complete")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+	rc := config.RuntimeConfig{ActiveEnv: "prod", DataDir: dataDir}
+
+	gather(rc,
+		map[string]interface{}{"status": 200.0, "user": "alice", "tags": []interface{}{"a"}},
+		map[string]interface{}{"status": "timeout", "user": "bob", "at": "2018-10-01T12:00:00Z"},
+		map[string]interface{}{"status": 500.0, "user": "carol", "ok": true},
+	)
+	gather(rc, map[string]interface{}{"user": "dave", "nested": map[string]interface{}{"a": 1}, "gone": nil})
+	// Selecting fields only tells about the selected ones, not about the ones projected away
+	gatherSelected(rc, []string{"status", "took"},
+		map[string]interface{}{"status": 200.0, "took": 12.0, "@env": "prod"},
+		map[string]interface{}{"status": 200.0, "@env": "prod"},
+	)
+
+	stats := GetFieldStats(rc)
+	if stats.Messages != 4 {
+		t.Errorf("Expected 4 messages, got %d", stats.Messages)
+	}
+	if _, ok := stats.Fields["@env"]; ok {
+		t.Error("Expected fields added after selecting to be left out")
+	}
+	if info := stats.Fields["took"]; info.Count != 1 || stats.Observed("took") != 6 || stats.Observed("user") != 4 {
+		t.Errorf("Unexpected took stats: %+v", info)
+	}
+	expectedTypes := map[string]map[string]int{
+		"status": {"number": 4, "string": 1},
+		"user":   {"string": 4},
+		"tags":   {"array": 1},
+		"at":     {"timestamp": 1},
+		"ok":     {"bool": 1},
+		"nested": {"object": 1},
+		"gone":   {"null": 1},
+	}
+	for field, types := range expectedTypes {
+		info, ok := stats.Fields[field]
+		if !ok {
+			t.Errorf("Field %s missing", field)
+			continue
+		}
+		if !reflect.DeepEqual(info.Types, types) {
+			t.Errorf("Unexpected types for %s: %v", field, info.Types)
+		}
+	}
+	if info := stats.Fields["user"]; info.Count != 4 || !reflect.DeepEqual(info.Samples, []string{"alice", "bob", "carol"}) {
+		t.Errorf("Unexpected user stats: %+v", info)
+	}
+	if info := stats.Fields["status"]; info.Count != 5 || info.Selected != 2 || !reflect.DeepEqual(info.Samples, []string{"200", "timeout", "500"}) {
+		t.Errorf("Unexpected status stats: %+v", info)
+	}
+}
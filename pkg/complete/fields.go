@@ -0,0 +1,169 @@
+package complete
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+	"github.com/egnyte/ax/pkg/cache"
+	"github.com/egnyte/ax/pkg/config"
+)
+
+const (
+	fieldsKeyFormat = "fields:%s"
+	// Number of sample values kept per field
+	MaxSamplesPerField = 3
+)
+
+type FieldInfo struct {
+	Count    int            `json:"count"`              // Number of messages the field was present in
+	Selected int            `json:"selected,omitempty"` // Number of messages of queries selecting only some fields, this one included
+	Types    map[string]int `json:"types"`              // Number of values per inferred type
+	Samples  []string       `json:"samples"`
+}
+
+type FieldStats struct {
+	Messages int                   `json:"messages"` // Number of messages of queries that kept all fields
+	Fields   map[string]*FieldInfo `json:"fields"`
+}
+
+// Observed returns the number of messages a field could have been present in, as queries
+// selecting fields only tell which of the selected fields their messages have
+func (stats FieldStats) Observed(name string) int {
+	if info, ok := stats.Fields[name]; ok {
+		return stats.Messages + info.Selected
+	}
+	return stats.Messages
+}
+
+func newFieldStats() FieldStats {
+	return FieldStats{Fields: make(map[string]*FieldInfo)}
+}
+
+// Adds the statistics of other, keeping the samples already there first
+func (stats *FieldStats) merge(other FieldStats) {
+	stats.Messages += other.Messages
+	for name, otherInfo := range other.Fields {
+		info := stats.field(name)
+		info.Count += otherInfo.Count
+		info.Selected += otherInfo.Selected
+		for t, count := range otherInfo.Types {
+			info.Types[t] += count
+		}
+		for _, sample := range otherInfo.Samples {
+			info.addSample(sample)
+		}
+	}
+}
+
+func (stats *FieldStats) field(name string) *FieldInfo {
+	info, ok := stats.Fields[name]
+	if !ok {
+		info = &FieldInfo{Types: make(map[string]int)}
+		stats.Fields[name] = info
+	}
+	return info
+}
+
+func (info *FieldInfo) addSample(sample string) {
+	if len(info.Samples) >= MaxSamplesPerField {
+		return
+	}
+	for _, existing := range info.Samples {
+		if existing == sample {
+			return
+		}
+	}
+	info.Samples = append(info.Samples, sample)
+}
+
+// Infers the type of an attribute value: string, number, bool, object, array, timestamp or null
+func ValueType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		if _, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return "timestamp"
+		}
+		return "string"
+	case bool:
+		return "bool"
+	case float64, float32, int, int64, int32, json.Number:
+		return "number"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// Keeps track of which fields messages have, of which types, with some sample values
+type fieldTracker struct {
+	cached   FieldStats      // From earlier queries
+	stats    FieldStats      // From this query
+	selected map[string]bool // Fields this query selected, if it didn't keep all of them
+}
+
+// Reads the field statistics from the cache, where they're stored as nested maps
+func cachedFieldStats(c *cache.Cache, env string) FieldStats {
+	stats := newFieldStats()
+	cached := c.Get(fmt.Sprintf(fieldsKeyFormat, env))
+	if cached == nil {
+		return stats
+	}
+	buf, err := json.Marshal(cached)
+	if err == nil {
+		err = json.Unmarshal(buf, &stats)
+	}
+	if err != nil || stats.Fields == nil {
+		log.Println("Could not read field statistics from cache:", err)
+		return newFieldStats()
+	}
+	return stats
+}
+
+func newFieldTracker(c *cache.Cache, env string, selectFields []string) *fieldTracker {
+	selected := make(map[string]bool)
+	for _, name := range selectFields {
+		selected[name] = true
+	}
+	return &fieldTracker{cachedFieldStats(c, env), newFieldStats(), selected}
+}
+
+func (tracker *fieldTracker) add(message common.LogMessage) {
+	if len(tracker.selected) == 0 {
+		tracker.stats.Messages++
+	}
+	for name := range tracker.selected {
+		tracker.stats.field(name).Selected++
+	}
+	for name, value := range message.Attributes {
+		if len(tracker.selected) > 0 && !tracker.selected[name] {
+			// Added after selecting, like the @env of multiple environments
+			continue
+		}
+		info := tracker.stats.field(name)
+		info.Count++
+		info.Types[ValueType(value)]++
+		if sample, ok := completionValue(value); ok {
+			info.addSample(sample)
+		}
+	}
+}
+
+func (tracker *fieldTracker) save(c *cache.Cache, env string) {
+	merged := newFieldStats()
+	merged.merge(tracker.cached)
+	merged.merge(tracker.stats)
+	c.Set(fmt.Sprintf(fieldsKeyFormat, env), merged, nil)
+}
+
+// GetFieldStats returns the statistics of the fields seen in messages of the active environment
+func GetFieldStats(rc config.RuntimeConfig) FieldStats {
+	return cachedFieldStats(cache.New(fmt.Sprintf("%s/%s", rc.DataDir, cacheFilename)), rc.ActiveEnv)
+}
@@ -0,0 +1,164 @@
+package complete
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/egnyte/ax/pkg/cache"
+)
+
+const (
+	valuesKeyFormat          = "values:%s"
+	highCardinalityKeyFormat = "high-cardinality:%s"
+	// Number of values kept per field, the most frequent ones
+	MaxValuesPerField = 50
+	// Fields with more distinct values than this in a single query are high-cardinality
+	HighCardinalityThreshold = 100
+	// Fields are also high-cardinality when most of their values are distinct, once seen at least this often
+	minCardinalitySamples = 50
+	// Longer values (e.g. stack traces) aren't worth completing
+	maxValueLength = 100
+)
+
+// Keeps track of the values seen per field, to complete the values of low-cardinality fields like
+// log levels. Fields like request IDs, with (nearly) unique values, are detected and remembered as
+// high-cardinality, to keep them out of the cache.
+type valueTracker struct {
+	cached          map[string]map[string]int // Counts from earlier queries
+	counts          map[string]map[string]int // Counts from this query
+	occurrences     map[string]int
+	highCardinality map[string]bool
+}
+
+func newValueTracker(c *cache.Cache, env string) *valueTracker {
+	tracker := &valueTracker{
+		cached:          cachedValueCounts(c, env),
+		counts:          make(map[string]map[string]int),
+		occurrences:     make(map[string]int),
+		highCardinality: make(map[string]bool),
+	}
+	if fields, ok := c.Get(fmt.Sprintf(highCardinalityKeyFormat, env)).(map[string]interface{}); ok {
+		for field := range fields {
+			tracker.highCardinality[field] = true
+		}
+	}
+	return tracker
+}
+
+// Returns the string to complete for scalar values, objects and lists aren't completed
+func completionValue(value interface{}) (string, bool) {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case bool:
+		s = strconv.FormatBool(v)
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case int, int64, json.Number:
+		s = fmt.Sprintf("%v", v)
+	default:
+		return "", false
+	}
+	if s == "" || len(s) > maxValueLength {
+		return "", false
+	}
+	return s, true
+}
+
+func (tracker *valueTracker) isHighCardinality(field string) bool {
+	distinct := len(tracker.counts[field])
+	return distinct > HighCardinalityThreshold || (tracker.occurrences[field] >= minCardinalitySamples && distinct*2 > tracker.occurrences[field])
+}
+
+// Records a value of a field, returns whether anything changed
+func (tracker *valueTracker) add(field string, value interface{}) bool {
+	if tracker.highCardinality[field] {
+		return false
+	}
+	s, ok := completionValue(value)
+	if !ok {
+		return false
+	}
+	if tracker.counts[field] == nil {
+		tracker.counts[field] = make(map[string]int)
+	}
+	tracker.counts[field][s]++
+	tracker.occurrences[field]++
+	if len(tracker.counts[field]) > HighCardinalityThreshold {
+		// No need to keep counting these
+		tracker.highCardinality[field] = true
+		delete(tracker.counts, field)
+	}
+	return true
+}
+
+// Stores the values seen so far, together with those from earlier queries, in the cache
+func (tracker *valueTracker) save(c *cache.Cache, env string) {
+	for field := range tracker.counts {
+		if tracker.isHighCardinality(field) {
+			tracker.highCardinality[field] = true
+		}
+	}
+	merged := make(map[string]map[string]int)
+	for _, counts := range []map[string]map[string]int{tracker.cached, tracker.counts} {
+		for field, values := range counts {
+			if tracker.highCardinality[field] {
+				continue
+			}
+			if merged[field] == nil {
+				merged[field] = make(map[string]int)
+			}
+			for value, count := range values {
+				merged[field][value] += count
+			}
+		}
+	}
+	for field, values := range merged {
+		if ranked := rankValues(values); len(ranked) > MaxValuesPerField {
+			for _, value := range ranked[MaxValuesPerField:] {
+				delete(merged[field], value)
+			}
+		}
+	}
+	c.Set(fmt.Sprintf(valuesKeyFormat, env), merged, nil)
+	c.Set(fmt.Sprintf(highCardinalityKeyFormat, env), tracker.highCardinality, nil)
+}
+
+// Reads the values seen per field, with how often they were seen, from the cache
+func cachedValueCounts(c *cache.Cache, env string) map[string]map[string]int {
+	counts := make(map[string]map[string]int)
+	// This will be read back as nested map[string]interface{}s with float64 counts
+	if fields, ok := c.Get(fmt.Sprintf(valuesKeyFormat, env)).(map[string]interface{}); ok {
+		for field, values := range fields {
+			valueMap, ok := values.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			counts[field] = make(map[string]int)
+			for value, count := range valueMap {
+				if n, ok := count.(float64); ok {
+					counts[field][value] = int(n)
+				}
+			}
+		}
+	}
+	return counts
+}
+
+// Returns the values of a field ordered by count (most frequent first), then by value
+func rankValues(counts map[string]int) []string {
+	values := make([]string, 0, len(counts))
+	for value := range counts {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if counts[values[i]] != counts[values[j]] {
+			return counts[values[i]] > counts[values[j]]
+		}
+		return values[i] < values[j]
+	})
+	return values
+}
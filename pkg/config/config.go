@@ -19,6 +19,7 @@ import (
 
 	"github.com/egnyte/ax/pkg/backend/common"
 	"github.com/egnyte/ax/pkg/backend/docker"
+	"github.com/egnyte/ax/pkg/backend/kubernetes"
 	"github.com/olekukonko/tablewriter"
 )
 
@@ -27,10 +28,12 @@ var dataDir string
 type EnvMap map[string]string
 
 type Config struct {
-	DefaultEnv   string            `yaml:"default"`
-	Colors       ColorConfig       `yaml:"colors"`
-	Environments map[string]EnvMap `yaml:"env"`
-	Alerts       []AlertConfig     `yaml:"alerts"`
+	DefaultEnv   string                `yaml:"default"`
+	Colors       ColorConfig           `yaml:"colors"`
+	Environments map[string]EnvMap     `yaml:"env"`
+	Groups       map[string][]string   `yaml:"groups,omitempty"` // Groups of environments to query together
+	Alerts       []AlertConfig         `yaml:"alerts"`
+	Queries      map[string]SavedQuery `yaml:"queries,omitempty"` // Saved with ax query save, by name
 }
 
 type AlertConfig struct {
@@ -42,16 +45,43 @@ type AlertConfig struct {
 
 type AlertServiceConfig map[string]string
 
+// Where to query, as given with --env or the flags that replace it, like --docker
+type QuerySource struct {
+	Env          []string `yaml:"env,omitempty"`
+	Docker       string   `yaml:"docker,omitempty"`
+	K8s          string   `yaml:"k8s,omitempty"`
+	K8sNamespace string   `yaml:"k8s_namespace,omitempty"`
+	K8sSelector  string   `yaml:"k8s_selector,omitempty"`
+	Journal      bool     `yaml:"journal,omitempty"`
+	File         string   `yaml:"file,omitempty"`
+	Syslog       string   `yaml:"syslog,omitempty"`
+}
+
+type SavedQuery struct {
+	QuerySource `yaml:",inline"`
+	Output      string                `yaml:"output,omitempty"`
+	Results     int                   `yaml:"results,omitempty"`
+	Follow      bool                  `yaml:"follow,omitempty"`
+	Selector    common.QuerySelectors `yaml:"selector"`
+}
+
 type RuntimeConfig struct {
 	ActiveEnv string
 	DataDir   string
 	Env       EnvMap
+	Envs      map[string]EnvMap // When querying multiple environments, by name (Env is empty then)
 	Config    Config
 }
 
 var (
-	activeEnv      = kingpin.Flag("env", "Environment to connect to").Short('e').HintAction(envHintAction).String()
+	activeEnvs     = kingpin.Flag("env", "Environment (or group of environments) to connect to, repeat to query multiple").Short('e').HintAction(envHintAction).Strings()
 	dockerFlag     = kingpin.Flag("docker", "Query docker container logs").HintAction(docker.DockerHintAction).String()
+	k8sFlag        = kingpin.Flag("k8s", "Query Kubernetes pod logs, for pods with names containing this pattern").HintAction(kubernetes.PodHintAction).String()
+	k8sNamespace   = kingpin.Flag("k8s-namespace", "Kubernetes namespace to query pod logs in").HintAction(kubernetes.NamespaceHintAction).String()
+	k8sSelector    = kingpin.Flag("k8s-selector", "Kubernetes label selector to query pod logs for, e.g. app=web").String()
+	journalFlag    = kingpin.Flag("journal", "Query the systemd journal of this host").Bool()
+	fileFlag       = kingpin.Flag("file", "Query log files matching a pattern, e.g. '/var/log/app/*.log*'").String()
+	syslogFlag     = kingpin.Flag("syslog", "Receive syslog messages (over UDP and TCP) on an address, e.g. :5514").String()
 	envCommand     = kingpin.Command("env", "Environment management commands")
 	envInitCommand = envCommand.Command("add", "Add an environment")
 	envEditCommand = envCommand.Command("edit", "Edit your environment configuration file in a text editor")
@@ -92,6 +122,63 @@ func configPathName() string {
 	return fmt.Sprintf("%s/ax.yaml", dataDir)
 }
 
+// ResolveEnvs expands groups in a list of environment names, and checks all environments exist
+func ResolveEnvs(config Config, names []string) ([]string, error) {
+	envNames := make([]string, 0, len(names))
+	seen := make(map[string]bool)
+	for _, name := range names {
+		members, isGroup := config.Groups[name]
+		if !isGroup {
+			members = []string{name}
+		}
+		for _, member := range members {
+			if _, ok := config.Environments[member]; !ok {
+				return nil, fmt.Errorf("Undefined active environment: %s", member)
+			}
+			if !seen[member] {
+				seen[member] = true
+				envNames = append(envNames, member)
+			}
+		}
+	}
+	return envNames, nil
+}
+
+// SourceFlags returns the environments (or groups) given with --env, as opposed to the default one,
+// and the flags that replace them
+func SourceFlags() QuerySource {
+	return QuerySource{
+		Env:          *activeEnvs,
+		Docker:       *dockerFlag,
+		K8s:          *k8sFlag,
+		K8sNamespace: *k8sNamespace,
+		K8sSelector:  *k8sSelector,
+		Journal:      *journalFlag,
+		File:         *fileFlag,
+		Syslog:       *syslogFlag,
+	}
+}
+
+func (rc *RuntimeConfig) setEnvs(envNames []string) {
+	if len(envNames) == 1 {
+		rc.Env = rc.Config.Environments[envNames[0]]
+		rc.Envs = nil
+		return
+	}
+	rc.Env = make(EnvMap)
+	rc.Envs = make(map[string]EnvMap)
+	for _, name := range envNames {
+		rc.Envs[name] = rc.Config.Environments[name]
+	}
+}
+
+// Flags like --docker replace the environment(s) from the config
+func (rc *RuntimeConfig) setFlagEnv(activeEnv string, em EnvMap) {
+	rc.ActiveEnv = activeEnv
+	rc.Env = em
+	rc.Envs = nil
+}
+
 func BuildConfig() RuntimeConfig {
 	config := LoadConfig()
 	rc := RuntimeConfig{
@@ -99,26 +186,54 @@ func BuildConfig() RuntimeConfig {
 		Env:     make(EnvMap),
 		Config:  config,
 	}
-	var ok bool
 	if config.DefaultEnv != "" {
-		rc.Env, ok = config.Environments[config.DefaultEnv]
-		if !ok {
-			fmt.Println("Undefined active environment:", config.DefaultEnv)
+		envNames, err := ResolveEnvs(config, []string{config.DefaultEnv})
+		if err != nil {
+			fmt.Println(err)
 			os.Exit(1)
 		}
+		rc.setEnvs(envNames)
 	}
-	if *activeEnv != "" {
-		rc.Env, ok = config.Environments[*activeEnv]
-		rc.ActiveEnv = *activeEnv
-		if !ok {
-			fmt.Println("Undefined active environment:", *activeEnv)
+	if len(*activeEnvs) > 0 {
+		envNames, err := ResolveEnvs(config, *activeEnvs)
+		if err != nil {
+			fmt.Println(err)
 			os.Exit(1)
 		}
+		rc.setEnvs(envNames)
+		rc.ActiveEnv = strings.Join(envNames, ",")
 	}
 	if *dockerFlag != "" {
-		rc.ActiveEnv = fmt.Sprintf("docker.%s", *dockerFlag)
-		rc.Env["backend"] = "docker"
-		rc.Env["pattern"] = *dockerFlag
+		rc.setFlagEnv(fmt.Sprintf("docker.%s", *dockerFlag), EnvMap{
+			"backend": "docker",
+			"pattern": *dockerFlag,
+		})
+	}
+	if *fileFlag != "" {
+		rc.setFlagEnv(fmt.Sprintf("file.%s", *fileFlag), EnvMap{
+			"backend": "file",
+			"pattern": *fileFlag,
+		})
+	}
+	if *syslogFlag != "" {
+		rc.setFlagEnv("syslog", EnvMap{
+			"backend": "syslog",
+			"address": *syslogFlag,
+		})
+	}
+	if *journalFlag {
+		rc.setFlagEnv("journal", EnvMap{
+			"backend": "journal",
+			"command": "journalctl",
+		})
+	}
+	if *k8sFlag != "" || *k8sNamespace != "" || *k8sSelector != "" {
+		rc.setFlagEnv(fmt.Sprintf("k8s.%s.%s.%s", *k8sNamespace, *k8sSelector, *k8sFlag), EnvMap{
+			"backend":   "kubernetes",
+			"namespace": *k8sNamespace,
+			"selector":  *k8sSelector,
+			"pattern":   *k8sFlag,
+		})
 	}
 	return rc
 }
@@ -170,6 +285,16 @@ func SaveConfig(config Config) {
 	}
 }
 
+// SaveQuery adds a saved query to ax.yaml, replacing any query with the same name
+func SaveQuery(name string, query SavedQuery) {
+	config := LoadConfig()
+	if config.Queries == nil {
+		config.Queries = make(map[string]SavedQuery)
+	}
+	config.Queries[name] = query
+	SaveConfig(config)
+}
+
 func AddEnv() {
 	config := LoadConfig()
 	reader := bufio.NewReader(os.Stdin)
@@ -178,7 +303,7 @@ func AddEnv() {
 	if name == "" {
 		name = "default"
 	}
-	fmt.Print("Choose a backend (kibana,cloudwatch,stackdriver) [kibana]: ")
+	fmt.Print("Choose a backend (kibana,elasticsearch,loki,cloudwatch,stackdriver,journal,file,syslog) [kibana]: ")
 	backend := readLine(reader)
 	if backend == "" {
 		backend = "kibana"
@@ -191,6 +316,16 @@ func AddEnv() {
 		if err != nil {
 			return
 		}
+	case "elasticsearch":
+		em, err = elasticsearchConfig(reader, config)
+		if err != nil {
+			return
+		}
+	case "loki":
+		em, err = lokiConfig(reader, config)
+		if err != nil {
+			return
+		}
 	case "cloudwatch":
 		em, err = cloudwatchConfig(reader, config)
 		if err != nil {
@@ -201,10 +336,29 @@ func AddEnv() {
 		if err != nil {
 			return
 		}
+	case "journal":
+		em, err = journalConfig(reader, config)
+		if err != nil {
+			return
+		}
+	case "file":
+		em, err = fileConfig(reader, config)
+		if err != nil {
+			return
+		}
+	case "syslog":
+		em, err = syslogConfig(reader, config)
+		if err != nil {
+			return
+		}
 	default:
 		fmt.Println("Unsupported backend")
 		return
 	}
+	fmt.Print("Field correlating requests across environments, for ax trace (e.g. trace_id, optional): ")
+	if traceField := readLine(reader); traceField != "" {
+		em["trace_field"] = traceField
+	}
 	if config.DefaultEnv == "" {
 		config.DefaultEnv = name
 	}
@@ -218,6 +372,9 @@ func envHintAction() []string {
 	for k := range config.Environments {
 		results = append(results, k)
 	}
+	for k := range config.Groups {
+		results = append(results, k)
+	}
 	return results
 }
 func ListEnvs() {
@@ -231,6 +388,13 @@ func ListEnvs() {
 		}
 		table.Append([]string{def, k, v["backend"], v["index"]})
 	}
+	for k, members := range config.Groups {
+		def := ""
+		if config.DefaultEnv == k {
+			def = "*"
+		}
+		table.Append([]string{def, k, "group", strings.Join(members, ",")})
+	}
 	table.Render() // Send output
 }
 
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+
+	"github.com/egnyte/ax/pkg/backend/elasticsearch"
+)
+
+func elasticsearchConfig(reader *bufio.Reader, existingConfig Config) (EnvMap, error) {
+	em := EnvMap{
+		"backend": "elasticsearch",
+	}
+	existingEsEnv := findFirstEnvWhere(existingConfig.Environments, func(em EnvMap) bool {
+		return em["backend"] == "elasticsearch"
+	})
+	if existingEsEnv != nil {
+		defaultUrl := (*existingEsEnv)["url"]
+		fmt.Printf("URL [%s]: ", defaultUrl)
+		em["url"] = readLine(reader)
+		if em["url"] == "" {
+			em["auth"] = (*existingEsEnv)["auth"]
+			em["url"] = defaultUrl
+		}
+	} else {
+		fmt.Print("URL (e.g. https://localhost:9200): ")
+		em["url"] = readLine(reader)
+	}
+	var esClient *elasticsearch.Client
+	var indices []string
+	var err error
+	for {
+		fmt.Println("Attempting to connect to Elasticsearch on ", em["url"])
+		esClient = elasticsearch.New(em["url"], em["auth"], "")
+		indices, err = esClient.ListIndices()
+		if err != nil && err.Error() == "Authentication failed" {
+			fmt.Print("Authenticate with an API key instead of a username and password? [n]: ")
+			if readLine(reader) == "y" {
+				fmt.Print("API key (base64 encoded id:api_key): ")
+				em["auth"] = fmt.Sprintf("ApiKey %s", readLine(reader))
+			} else {
+				user, pass := credentials(reader)
+				em["auth"] = fmt.Sprintf("Basic %s", b64Encode(fmt.Sprintf("%s:%s", user, pass)))
+			}
+			continue
+		} else if err != nil {
+			fmt.Printf("Got error connecting to Elasticsearch: %s\n", err)
+			return em, err
+		}
+		break
+	}
+	fmt.Println("List of indices:")
+	for _, index := range indices {
+		fmt.Println("  ", index)
+	}
+	fmt.Print("Index (or pattern, e.g. logs-*): ")
+	em["index"] = readLine(reader)
+	return em, nil
+}
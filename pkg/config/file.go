@@ -0,0 +1,22 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"path/filepath"
+)
+
+func fileConfig(reader *bufio.Reader, existingConfig Config) (EnvMap, error) {
+	em := EnvMap{
+		"backend": "file",
+	}
+	fmt.Print("File name pattern (e.g. /var/log/app/*.log*): ")
+	em["pattern"] = readLine(reader)
+	paths, err := filepath.Glob(em["pattern"])
+	if err != nil {
+		fmt.Printf("Invalid pattern: %s\n", err)
+		return em, err
+	}
+	fmt.Printf("Pattern currently matches %d files\n", len(paths))
+	return em, nil
+}
@@ -0,0 +1,18 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+)
+
+func journalConfig(reader *bufio.Reader, existingConfig Config) (EnvMap, error) {
+	em := EnvMap{
+		"backend": "journal",
+	}
+	fmt.Print("Command to run journalctl, e.g. to read the journal of another host: ssh myhost journalctl [journalctl]: ")
+	em["command"] = readLine(reader)
+	if em["command"] == "" {
+		em["command"] = "journalctl"
+	}
+	return em, nil
+}
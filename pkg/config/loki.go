@@ -0,0 +1,57 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+
+	"github.com/egnyte/ax/pkg/backend/loki"
+)
+
+func lokiConfig(reader *bufio.Reader, existingConfig Config) (EnvMap, error) {
+	em := EnvMap{
+		"backend": "loki",
+	}
+	existingLokiEnv := findFirstEnvWhere(existingConfig.Environments, func(em EnvMap) bool {
+		return em["backend"] == "loki"
+	})
+	if existingLokiEnv != nil {
+		defaultUrl := (*existingLokiEnv)["url"]
+		fmt.Printf("URL [%s]: ", defaultUrl)
+		em["url"] = readLine(reader)
+		if em["url"] == "" {
+			em["auth"] = (*existingLokiEnv)["auth"]
+			em["url"] = defaultUrl
+		}
+	} else {
+		fmt.Print("URL (e.g. http://localhost:3100): ")
+		em["url"] = readLine(reader)
+	}
+	var labels []string
+	var err error
+	for {
+		fmt.Println("Attempting to connect to Loki on ", em["url"])
+		labels, err = loki.New(em["url"], em["auth"], "").ListLabels()
+		if err != nil && err.Error() == "Authentication failed" {
+			fmt.Print("Authenticate with a bearer token instead of a username and password? [n]: ")
+			if readLine(reader) == "y" {
+				fmt.Print("Token: ")
+				em["auth"] = fmt.Sprintf("Bearer %s", readLine(reader))
+			} else {
+				user, pass := credentials(reader)
+				em["auth"] = fmt.Sprintf("Basic %s", b64Encode(fmt.Sprintf("%s:%s", user, pass)))
+			}
+			continue
+		} else if err != nil {
+			fmt.Printf("Got error connecting to Loki: %s\n", err)
+			return em, err
+		}
+		break
+	}
+	fmt.Println("List of labels:")
+	for _, label := range labels {
+		fmt.Println("  ", label)
+	}
+	fmt.Print("Stream selector to use for all queries (e.g. {namespace=\"prod\"}, may be empty): ")
+	em["selector"] = readLine(reader)
+	return em, nil
+}
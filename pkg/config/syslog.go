@@ -0,0 +1,18 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+)
+
+func syslogConfig(reader *bufio.Reader, existingConfig Config) (EnvMap, error) {
+	em := EnvMap{
+		"backend": "syslog",
+	}
+	fmt.Print("Address to listen on for syslog messages (UDP and TCP) [:5514]: ")
+	em["address"] = readLine(reader)
+	if em["address"] == "" {
+		em["address"] = ":5514"
+	}
+	return em, nil
+}
@@ -0,0 +1,97 @@
+package patterns
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+)
+
+type mask struct {
+	regexp      *regexp.Regexp
+	placeholder string
+	// Optionally checks whether a match is really a variable token, when the regexp can't express that
+	matches func(token string) bool
+}
+
+// Masks for tokens that vary between messages of the same kind, applied in order
+var masks = []mask{
+	{regexp: regexp.MustCompile(`"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'`), placeholder: "<STR>"},
+	{regexp: regexp.MustCompile(`\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b`), placeholder: "<UUID>"},
+	{regexp: regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}(?::\d+)?\b`), placeholder: "<IP>"},
+	{regexp: regexp.MustCompile(`\b(?:[0-9a-fA-F]{1,4}:){7}[0-9a-fA-F]{1,4}\b`), placeholder: "<IP>"},
+	{regexp: regexp.MustCompile(`\b0x[0-9a-fA-F]+\b`), placeholder: "<HEX>"},
+	// Hex IDs like git hashes and trace IDs, as opposed to words that happen to only contain a-f
+	{regexp: regexp.MustCompile(`\b[0-9a-fA-F]{8,}\b`), placeholder: "<HEX>", matches: func(token string) bool {
+		return strings.ContainsAny(token, "0123456789") && strings.ContainsAny(token, "abcdefABCDEF")
+	}},
+	// Numbers, including those followed by a unit like 30ms, but not those that are part of a name like http2
+	{regexp: regexp.MustCompile(`\b\d+(?:\.\d+)?`), placeholder: "<NUM>"},
+}
+
+// Template masks the variable tokens in a message (numbers, UUIDs, IP addresses, hex IDs and quoted
+// strings), so that messages that only differ in those end up with the same template
+func Template(message string) string {
+	for _, m := range masks {
+		if m.matches == nil {
+			message = m.regexp.ReplaceAllLiteralString(message, m.placeholder)
+			continue
+		}
+		message = m.regexp.ReplaceAllStringFunc(message, func(token string) string {
+			if m.matches(token) {
+				return m.placeholder
+			}
+			return token
+		})
+	}
+	return message
+}
+
+type Pattern struct {
+	Template  string
+	Count     int
+	FirstSeen time.Time
+	LastSeen  time.Time
+	Example   common.LogMessage // The first message with this template
+}
+
+// Cluster groups messages by the template of their field (usually "message"),
+// returning the maxPatterns (if not 0) most frequent templates
+func Cluster(messages <-chan common.LogMessage, field string, maxPatterns int) []Pattern {
+	byTemplate := make(map[string]*Pattern)
+	for message := range messages {
+		value, _ := message.Attributes[field].(string)
+		template := Template(value)
+		pattern, ok := byTemplate[template]
+		if !ok {
+			pattern = &Pattern{Template: template, FirstSeen: message.Timestamp, LastSeen: message.Timestamp, Example: message}
+			byTemplate[template] = pattern
+		}
+		pattern.Count++
+		if message.Timestamp.Before(pattern.FirstSeen) {
+			pattern.FirstSeen = message.Timestamp
+		}
+		if message.Timestamp.After(pattern.LastSeen) {
+			pattern.LastSeen = message.Timestamp
+		}
+	}
+	patterns := make([]Pattern, 0, len(byTemplate))
+	for _, pattern := range byTemplate {
+		patterns = append(patterns, *pattern)
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if patterns[i].Count != patterns[j].Count {
+			return patterns[i].Count > patterns[j].Count
+		}
+		if !patterns[i].FirstSeen.Equal(patterns[j].FirstSeen) {
+			return patterns[i].FirstSeen.Before(patterns[j].FirstSeen)
+		}
+		return patterns[i].Template < patterns[j].Template
+	})
+	if maxPatterns > 0 && len(patterns) > maxPatterns {
+		patterns = patterns[:maxPatterns]
+	}
+	return patterns
+}
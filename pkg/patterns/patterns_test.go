@@ -0,0 +1,54 @@
+package patterns
+
+import (
+	"testing"
+	"time"
+
+	"github.com/egnyte/ax/pkg/backend/common"
+)
+
+func TestTemplate(t *testing.T) {
+	tests := map[string]string{
+		"Connection to 10.0.0.12:5432 failed after 30ms":                   "Connection to <IP> failed after <NUM>ms",
+		"Request 3f2b8c1e-9a4d-4e2f-8b1a-0c6d5e4f3a2b took 1.25 seconds":   "Request <UUID> took <NUM> seconds",
+		`User "alice" not found in 'eu-west'`:                              "User <STR> not found in <STR>",
+		"Commit 9fceb02d0ae598e95dc970b74767f19372d61af8 at 0x7ffe4a2c":    "Commit <HEX> at <HEX>",
+		"Listening on fe80:0:0:0:200:f8ff:fe21:67cf":                       "Listening on <IP>",
+		"worker-12 restarted, http2 enabled, cache defaced (deadbeefcafe)": "worker-<NUM> restarted, http2 enabled, cache defaced (deadbeefcafe)",
+	}
+	for message, expected := range tests {
+		if template := Template(message); template != expected {
+			t.Errorf("Expected %q for %q, got %q", expected, message, template)
+		}
+	}
+}
+
+func TestCluster(t *testing.T) {
+	start := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+	messages := make(chan common.LogMessage, 10)
+	for i, text := range []string{
+		"Timeout after 30ms",
+		"User 12 logged in",
+		"Timeout after 45ms",
+		"Timeout after 12ms",
+		"User 7 logged in",
+		"Disk full",
+	} {
+		messages <- common.LogMessage{Timestamp: start.Add(time.Duration(i) * time.Second), Attributes: map[string]interface{}{"message": text}}
+	}
+	close(messages)
+	patterns := Cluster(messages, "message", 2)
+	if len(patterns) != 2 {
+		t.Fatalf("Expected the 2 most frequent patterns, got %+v", patterns)
+	}
+	timeout := patterns[0]
+	if timeout.Template != "Timeout after <NUM>ms" || timeout.Count != 3 {
+		t.Errorf("Unexpected most frequent pattern: %+v", timeout)
+	}
+	if !timeout.FirstSeen.Equal(start) || !timeout.LastSeen.Equal(start.Add(3*time.Second)) || timeout.Example.Attributes["message"] != "Timeout after 30ms" {
+		t.Errorf("Unexpected first/last seen or example: %+v", timeout)
+	}
+	if patterns[1].Template != "User <NUM> logged in" || patterns[1].Count != 2 {
+		t.Errorf("Unexpected second pattern: %+v", patterns[1])
+	}
+}